@@ -0,0 +1,170 @@
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxBotCommands is the maximum number of commands accepted by setMyCommands.
+	maxBotCommands = 100
+	// maxBotCommandDescription is the maximum length of a command description accepted by setMyCommands.
+	maxBotCommandDescription = 256
+)
+
+var (
+	// errInvalidBotCommand is returned for help entries whose command or description Telegram would reject.
+	errInvalidBotCommand = errors.New("invalid bot command")
+	// errTooManyBotCommands is returned when more commands are registered than Telegram accepts.
+	errTooManyBotCommands = errors.New("too many bot commands")
+)
+
+// botCommandPattern matches the command names accepted by setMyCommands.
+var botCommandPattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// BotCommand is a command as listed in BotFather and the Bot API setMyCommands call.
+type BotCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+// BotCommandScope is the scope of a setMyCommands call, either the default scope or a single chat.
+type BotCommandScope struct {
+	Type   string `json:"type"`
+	ChatID int64  `json:"chat_id,omitempty"`
+}
+
+// SetMyCommandsPayload is the request body of the Bot API setMyCommands call.
+type SetMyCommandsPayload struct {
+	Commands []BotCommand    `json:"commands"`
+	Scope    BotCommandScope `json:"scope"`
+}
+
+// ChatConfiguredInterface is an optional extension of Interface for matchers with per-chat configs.
+// The Registry uses it to find the chats whose command lists may differ from the default one.
+// The base Matcher implements it.
+type ChatConfiguredInterface interface {
+	ConfiguredChatIDs() []int64
+}
+
+// NewSetMyCommandsPayload returns the setMyCommands payload for the given commands. Chat ID 0 selects
+// the default scope, any other chat ID a scope limited to that chat.
+func NewSetMyCommandsPayload(commands []BotCommand, chatID int64) SetMyCommandsPayload {
+	scope := BotCommandScope{Type: "default", ChatID: 0}
+	if chatID != 0 {
+		scope = BotCommandScope{Type: "chat", ChatID: chatID}
+	}
+
+	return SetMyCommandsPayload{Commands: commands, Scope: scope}
+}
+
+// FormatBotFatherCommands renders the commands in the "command - description" format BotFather
+// accepts for /setcommands, one command per line.
+func FormatBotFatherCommands(commands []BotCommand) string {
+	lines := make([]string, 0, len(commands))
+	for _, command := range commands {
+		lines = append(lines, command.Command+" - "+command.Description)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// BotCommands returns the commands of all matchers enabled in the given chat, built from their help entries
+// in priority and registration order. Chat ID 0 returns the commands enabled by the fallback configs.
+// Help entries without a command are skipped, and commands are lowercased with a leading slash removed.
+// If several entries declare the same command, the first one wins. Commands Telegram would reject are
+// returned as joined errors together with the valid commands.
+func (r *Registry) BotCommands(chatID int64) ([]BotCommand, error) {
+	commands, errs := r.botCommands(chatID)
+
+	return commands, errors.Join(errs...)
+}
+
+// botCommands builds the commands for the given chat and returns all problems found, see BotCommands.
+func (r *Registry) botCommands(chatID int64) ([]BotCommand, []error) {
+	var errs []error
+
+	commands := []BotCommand{}
+	seen := map[string]bool{}
+
+	for _, m := range r.MatchersFor(chatID) {
+		for _, help := range m.Help() {
+			name := strings.ToLower(strings.TrimPrefix(help.Command, "/"))
+			if name == "" || seen[name] {
+				continue
+			}
+
+			description := strings.TrimSpace(help.Description)
+
+			switch {
+			case !botCommandPattern.MatchString(name):
+				errs = append(errs, fmt.Errorf("%w /%s of matcher %s: use 1-32 letters, digits or underscores",
+					errInvalidBotCommand, name, m.Identifier()))
+			case description == "":
+				errs = append(errs, fmt.Errorf("%w /%s of matcher %s: missing description",
+					errInvalidBotCommand, name, m.Identifier()))
+			case utf8.RuneCountInString(description) > maxBotCommandDescription:
+				errs = append(errs, fmt.Errorf("%w /%s of matcher %s: description longer than %d characters",
+					errInvalidBotCommand, name, m.Identifier(), maxBotCommandDescription))
+			default:
+				seen[name] = true
+				commands = append(commands, BotCommand{Command: name, Description: description})
+			}
+		}
+	}
+
+	if len(commands) > maxBotCommands {
+		errs = append(errs, fmt.Errorf("%w: %d, at most %d are allowed", errTooManyBotCommands, len(commands), maxBotCommands))
+	}
+
+	return commands, errs
+}
+
+// ConfiguredChatIDs returns the sorted IDs of all chats any registered matcher has a per-chat config for.
+func (r *Registry) ConfiguredChatIDs() []int64 {
+	var chatIDs []int64
+
+	for _, reg := range r.matchers {
+		if cm, ok := as[ChatConfiguredInterface](reg.matcher); ok {
+			chatIDs = append(chatIDs, cm.ConfiguredChatIDs()...)
+		}
+	}
+
+	slices.Sort(chatIDs)
+
+	return slices.Compact(chatIDs)
+}
+
+// SetMyCommandsPayloads returns the setMyCommands payloads needed to publish the commands of all matchers:
+// one for the default scope, followed by one per configured chat whose commands differ from the default.
+// Problems are collected from all scopes and reported once each, see BotCommands.
+func (r *Registry) SetMyCommandsPayloads() ([]SetMyCommandsPayload, error) {
+	defaults, errs := r.botCommands(0)
+	payloads := []SetMyCommandsPayload{NewSetMyCommandsPayload(defaults, 0)}
+
+	reported := map[string]bool{}
+	for _, err := range errs {
+		reported[err.Error()] = true
+	}
+
+	for _, chatID := range r.ConfiguredChatIDs() {
+		commands, chatErrs := r.botCommands(chatID)
+
+		for _, err := range chatErrs {
+			if !reported[err.Error()] {
+				reported[err.Error()] = true
+				errs = append(errs, err)
+			}
+		}
+
+		if !slices.Equal(commands, defaults) {
+			payloads = append(payloads, NewSetMyCommandsPayload(commands, chatID))
+		}
+	}
+
+	return payloads, errors.Join(errs...)
+}
@@ -0,0 +1,81 @@
+package matcher_test
+
+import (
+	"regexp"
+	"testing"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeHelpMatcher returns an echoMatcher with the given identifier and help entries.
+func makeHelpMatcher(identifier string, help ...matcher.HelpStruct) echoMatcher {
+	return echoMatcher{Matcher: matcher.MakeMatcher(identifier, regexp.MustCompile(`.`), help)}
+}
+
+// TestRegistry_BotCommands verifies that commands are normalized, deduplicated and kept in priority order,
+// and that entries Telegram would reject are reported.
+func TestRegistry_BotCommands(t *testing.T) {
+	t.Parallel()
+
+	reg := matcher.NewRegistry(logger.New(), &fakeTelegramClient{})
+	reg.Register(makeHelpMatcher("ping", matcher.HelpStruct{Command: "/Ping", Description: " Replies with pong "}))
+	reg.Register(makeHelpMatcher("karma",
+		matcher.HelpStruct{Command: "karma", Description: "Shows the karma"},
+		matcher.HelpStruct{Command: "karma", Description: "Shows the karma of a user"},
+		matcher.HelpStruct{Command: "", Description: "Counts ++ and --"},
+	), matcher.WithPriority(10))
+	reg.Register(makeHelpMatcher("broken",
+		matcher.HelpStruct{Command: "bad-name", Description: "Invalid name"},
+		matcher.HelpStruct{Command: "nodesc", Description: ""},
+	))
+
+	commands, err := reg.BotCommands(0)
+	assert.Equal(t, []matcher.BotCommand{
+		{Command: "karma", Description: "Shows the karma"},
+		{Command: "ping", Description: "Replies with pong"},
+	}, commands)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "/bad-name of matcher broken")
+	assert.Contains(t, err.Error(), "/nodesc of matcher broken: missing description")
+
+	assert.Equal(t, "karma - Shows the karma\nping - Replies with pong", matcher.FormatBotFatherCommands(commands))
+}
+
+// TestRegistry_SetMyCommandsPayloads verifies that a chat-scoped payload is only added for configured
+// chats whose commands differ from the default ones.
+func TestRegistry_SetMyCommandsPayloads(t *testing.T) {
+	t.Parallel()
+
+	falseVal := false
+	disabled := &matcher.Config{}
+	setConfigEnabled(disabled, &falseVal)
+
+	ping := makeHelpMatcher("ping", matcher.HelpStruct{Command: "ping", Description: "Replies with pong"})
+	ping.Matcher = ping.WithChatConfigs(map[int64]*matcher.Config{1: disabled, 2: {}})
+
+	reg := matcher.NewRegistry(logger.New(), &fakeTelegramClient{})
+	reg.Register(ping)
+	reg.Register(makeHelpMatcher("help", matcher.HelpStruct{Command: "help", Description: "Lists all commands"}))
+
+	assert.Equal(t, []int64{1, 2}, reg.ConfiguredChatIDs())
+
+	payloads, err := reg.SetMyCommandsPayloads()
+	require.NoError(t, err)
+	assert.Equal(t, []matcher.SetMyCommandsPayload{
+		{
+			Commands: []matcher.BotCommand{
+				{Command: "ping", Description: "Replies with pong"},
+				{Command: "help", Description: "Lists all commands"},
+			},
+			Scope: matcher.BotCommandScope{Type: "default", ChatID: 0},
+		},
+		{
+			Commands: []matcher.BotCommand{{Command: "help", Description: "Lists all commands"}},
+			Scope:    matcher.BotCommandScope{Type: "chat", ChatID: 1},
+		},
+	}, payloads)
+}
@@ -0,0 +1,275 @@
+package matcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	telegramclient "github.com/br0-space/bot-telegramclient"
+)
+
+// callbackErrorTemplate is the alert shown to the user when a matcher fails to process a callback query.
+const callbackErrorTemplate = "⚠️ Error in matcher \"%s\": %s"
+
+// maxCallbackAnswerLength is the maximum length of the text of a callback query answer accepted by Telegram.
+const maxCallbackAnswerLength = 200
+
+// errNoChat is reported when messages are returned for a callback query without originating message.
+var errNoChat = errors.New("callback query has no originating message to reply to")
+
+// Create structs that mimic the callback query of an update and the body of answerCallbackQuery
+// https://core.telegram.org/bots/api#callbackquery
+// https://core.telegram.org/bots/api#answercallbackquery
+
+// CallbackQueryStruct is sent when a user presses a button of an inline keyboard.
+type CallbackQueryStruct struct {
+	ID   string                                  `json:"id"`
+	From telegramclient.WebhookMessageUserStruct `json:"from"`
+	// Message is the message with the pressed button. It is nil for messages sent via inline mode and
+	// messages older than 48 hours.
+	Message         *telegramclient.WebhookMessageStruct `json:"message"`
+	InlineMessageID string                               `json:"inline_message_id"` //nolint:tagliatelle
+	ChatInstance    string                               `json:"chat_instance"`     //nolint:tagliatelle
+	// Data is the callback data of the pressed button.
+	Data string `json:"data"`
+}
+
+// ChatID returns the chat of the originating message, or 0 if the query has none.
+func (q CallbackQueryStruct) ChatID() int64 {
+	if q.Message == nil {
+		return 0
+	}
+
+	return q.Message.Chat.ID
+}
+
+// Answer returns an answer to the query showing the given text as a notification at the top of the chat.
+// An empty text only stops the progress indicator of the button.
+func (q CallbackQueryStruct) Answer(text string) CallbackAnswerStruct {
+	return CallbackAnswerStruct{CallbackQueryID: q.ID, Text: text, ShowAlert: false, URL: "", CacheTime: 0}
+}
+
+// Alert returns an answer to the query showing the given text as an alert the user has to dismiss.
+func (q CallbackQueryStruct) Alert(text string) CallbackAnswerStruct {
+	return CallbackAnswerStruct{CallbackQueryID: q.ID, Text: text, ShowAlert: true, URL: "", CacheTime: 0}
+}
+
+// message returns the query as a message from its sender in the chat of the originating message, with the
+// callback data as text, as passed to HandleError and used to check permissions.
+func (q CallbackQueryStruct) message() telegramclient.WebhookMessageStruct {
+	messageIn := telegramclient.WebhookMessageStruct{
+		ID:      0,
+		From:    q.From,
+		Chat:    telegramclient.WebhookMessageChatStruct{ID: 0, Type: "", Username: ""},
+		Text:    q.Data,
+		Date:    0,
+		Photo:   nil,
+		Caption: "",
+	}
+
+	if q.Message != nil {
+		messageIn.ID = q.Message.ID
+		messageIn.Chat = q.Message.Chat
+		messageIn.Date = q.Message.Date
+	}
+
+	return messageIn
+}
+
+// CallbackAnswerStruct is the answer to a callback query. Telegram expects every query to be answered,
+// otherwise the button keeps showing a progress indicator.
+type CallbackAnswerStruct struct {
+	CallbackQueryID string `json:"callback_query_id"` //nolint:tagliatelle
+	Text            string `json:"text,omitempty"`
+	ShowAlert       bool   `json:"show_alert"` //nolint:tagliatelle
+	URL             string `json:"url,omitempty"`
+	CacheTime       int    `json:"cache_time"` //nolint:tagliatelle
+}
+
+// CallbackInterface is an optional extension of Interface for matchers handling inline keyboard buttons.
+// The Registry routes a callback query to the matcher declaring the longest prefix of its data, so
+// buttons of a matcher should carry data like "poll:vote:3" and the matcher declare the prefix "poll:".
+type CallbackInterface interface {
+	Interface
+	// CallbackPrefixes returns the prefixes of the callback data owned by the matcher.
+	CallbackPrefixes() []string
+	// ProcessCallback handles a callback query. The answer is sent to Telegram, an empty answer is sent if
+	// it is the zero value. The messages are sent to the chat of the originating message.
+	ProcessCallback(
+		ctx context.Context,
+		query CallbackQueryStruct,
+	) (CallbackAnswerStruct, []telegramclient.MessageStruct, error)
+}
+
+// CallbackAnswererInterface is an optional extension of telegramclient.ClientInterface for clients that can
+// answer callback queries. Without it, callback queries are processed but not answered.
+type CallbackAnswererInterface interface {
+	AnswerCallbackQuery(answer CallbackAnswerStruct) error
+}
+
+// ProcessCallbackQuery routes a callback query to the matcher owning its data.
+// It is a shortcut for ProcessCallbackQueryContext with a background context.
+func (r *Registry) ProcessCallbackQuery(query CallbackQueryStruct) {
+	r.ProcessCallbackQueryContext(context.Background(), query)
+}
+
+// ProcessCallbackQueryContext routes a callback query to the matcher implementing CallbackInterface that
+// declares the longest prefix of its data, see CallbackInterface. Matchers that are disabled in the chat of
+// the originating message or quarantined are skipped, and senders that are not permitted to use the
+// matcher get the reply configured with WithPermissionDeniedReply as alert. The matcher runs synchronously
+// with a context bounded by its timeout and is abandoned once it expires; errors are shown to the user as alert. The query is always
+// answered, even if no matcher owns it, before the returned messages are sent.
+func (r *Registry) ProcessCallbackQueryContext(ctx context.Context, query CallbackQueryStruct) {
+	r.log.Debugf("Processing callback query from %s: %s", query.From.Username, query.Data)
+
+	cm, ok := r.callbackMatcher(query)
+	if !ok {
+		r.log.Debugf("No matcher owns callback data %q", query.Data)
+		r.answerCallbackQuery(query.Answer(""))
+
+		return
+	}
+
+	answer, messagesOut := r.executeCallback(ctx, cm, query)
+
+	if answer == (CallbackAnswerStruct{}) {
+		answer = query.Answer("")
+	}
+
+	if answer.CallbackQueryID == "" {
+		answer.CallbackQueryID = query.ID
+	}
+
+	r.answerCallbackQuery(answer)
+
+	if len(messagesOut) == 0 {
+		return
+	}
+
+	if query.ChatID() == 0 {
+		r.log.Errorf("Error while sending messages of matcher %s: %s", cm.Identifier(), errNoChat)
+
+		return
+	}
+
+	r.sendMessages(ctx, cm.Identifier(), query.ChatID(), messagesOut)
+}
+
+// callbackMatcher returns the enabled, not quarantined matcher declaring the longest prefix of the query's
+// data. Of matchers declaring the same prefix, the one registered with the highest priority wins.
+func (r *Registry) callbackMatcher(query CallbackQueryStruct) (CallbackInterface, bool) {
+	var (
+		owner   CallbackInterface
+		longest = -1
+	)
+
+	for _, reg := range r.matchers {
+		cm, ok := as[CallbackInterface](reg.matcher)
+		if !ok {
+			continue
+		}
+
+		length, ok := r.callbackPrefixLength(cm, query.Data)
+		if !ok || length <= longest || !r.shouldRunMatcher(cm, query.ChatID()) {
+			continue
+		}
+
+		owner, longest = cm, length
+	}
+
+	return owner, owner != nil
+}
+
+// callbackPrefixLength returns the length of the longest prefix of data declared by the matcher and
+// whether it declares one. A panic in CallbackPrefixes is recovered and counts as no prefix.
+func (r *Registry) callbackPrefixLength(cm CallbackInterface, data string) (length int, ok bool) {
+	defer r.recoverMatcher(cm)
+
+	length = -1
+
+	for _, prefix := range cm.CallbackPrefixes() {
+		if strings.HasPrefix(data, prefix) && len(prefix) > length {
+			length = len(prefix)
+		}
+	}
+
+	return length, length >= 0
+}
+
+// executeCallback checks the permissions of the query's sender and runs ProcessCallback with a context
+// bounded by the matcher's timeout. Errors are logged, reported like errors of Process and turned into an
+// alert.
+func (r *Registry) executeCallback(
+	ctx context.Context,
+	cm CallbackInterface,
+	query CallbackQueryStruct,
+) (CallbackAnswerStruct, []telegramclient.MessageStruct) {
+	messageIn := query.message()
+
+	permitted, err := r.checkPermissions(ctx, cm, messageIn, &senderRoles{resolved: false, roles: nil, err: nil})
+	if err == nil && !permitted {
+		if r.deniedReply == "" {
+			return CallbackAnswerStruct{}, nil
+		}
+
+		return query.Alert(r.deniedReply), nil
+	}
+
+	var (
+		answer      CallbackAnswerStruct
+		messagesOut []telegramclient.MessageStruct
+	)
+
+	if err == nil {
+		answer, messagesOut, err = r.processCallback(ctx, cm, query)
+	}
+
+	if err != nil {
+		r.handleError(cm, messageIn, err)
+
+		text := fmt.Sprintf(callbackErrorTemplate, cm.Identifier(), err)
+		if runes := []rune(text); len(runes) > maxCallbackAnswerLength {
+			text = string(runes[:maxCallbackAnswerLength-1]) + "…"
+		}
+
+		return query.Alert(text), messagesOut
+	}
+
+	return answer, messagesOut
+}
+
+// callbackResult is the result of ProcessCallback.
+type callbackResult struct {
+	answer      CallbackAnswerStruct
+	messagesOut []telegramclient.MessageStruct
+}
+
+// processCallback calls ProcessCallback, see callMatcher.
+func (r *Registry) processCallback(
+	ctx context.Context,
+	cm CallbackInterface,
+	query CallbackQueryStruct,
+) (CallbackAnswerStruct, []telegramclient.MessageStruct, error) {
+	res, err := callMatcher(ctx, r, cm.Identifier(), func(ctx context.Context) (callbackResult, error) {
+		answer, messagesOut, err := cm.ProcessCallback(ctx, query)
+
+		return callbackResult{answer: answer, messagesOut: messagesOut}, err
+	})
+
+	return res.answer, res.messagesOut, err
+}
+
+// answerCallbackQuery sends the answer if the Telegram client implements CallbackAnswererInterface.
+func (r *Registry) answerCallbackQuery(answer CallbackAnswerStruct) {
+	answerer, ok := r.telegram.(CallbackAnswererInterface)
+	if !ok {
+		r.log.Debugf("Callback query %s not answered: client cannot answer callback queries", answer.CallbackQueryID)
+
+		return
+	}
+
+	if err := answerer.AnswerCallbackQuery(answer); err != nil {
+		r.log.Errorf("Error while answering callback query %s: %s", answer.CallbackQueryID, err)
+	}
+}
@@ -0,0 +1,246 @@
+package matcher_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// answeringTelegramClient is a fakeTelegramClient that also records answered callback queries.
+type answeringTelegramClient struct {
+	fakeTelegramClient
+
+	answers []matcher.CallbackAnswerStruct
+}
+
+// AnswerCallbackQuery records the answer for inspection in tests.
+func (f *answeringTelegramClient) AnswerCallbackQuery(answer matcher.CallbackAnswerStruct) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.answers = append(f.answers, answer)
+
+	return nil
+}
+
+// answeredTexts returns the texts of all recorded answers.
+func (f *answeringTelegramClient) answeredTexts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	texts := make([]string, 0, len(f.answers))
+	for _, answer := range f.answers {
+		texts = append(texts, answer.Text)
+	}
+
+	return texts
+}
+
+// menuMatcher handles the buttons with data starting with one of its prefixes.
+type menuMatcher struct {
+	echoMatcher
+
+	prefixes []string
+	mu       *sync.Mutex
+	queries  *[]matcher.CallbackQueryStruct
+}
+
+// makeMenuMatcher returns a menuMatcher with the given identifier and prefixes that matches no messages.
+func makeMenuMatcher(identifier string, prefixes ...string) menuMatcher {
+	return menuMatcher{
+		echoMatcher: echoMatcher{Matcher: matcher.MakeMatcher(identifier, regexp.MustCompile(`^$`), nil)},
+		prefixes:    prefixes,
+		mu:          &sync.Mutex{},
+		queries:     &[]matcher.CallbackQueryStruct{},
+	}
+}
+
+// CallbackPrefixes returns the prefixes of the matcher.
+func (m menuMatcher) CallbackPrefixes() []string {
+	return m.prefixes
+}
+
+// ProcessCallback records the query and answers with the matcher's identifier. The data "boom" panics,
+// "fail" fails and "reply" additionally replies to the originating message.
+func (m menuMatcher) ProcessCallback(
+	_ context.Context,
+	query matcher.CallbackQueryStruct,
+) (matcher.CallbackAnswerStruct, []telegramclient.MessageStruct, error) {
+	m.mu.Lock()
+	*m.queries = append(*m.queries, query)
+	m.mu.Unlock()
+
+	switch query.Data {
+	case "boom":
+		panic("boom")
+	case "fail":
+		return matcher.CallbackAnswerStruct{}, nil, errors.New("failed")
+	case "reply":
+		return matcher.CallbackAnswerStruct{}, []telegramclient.MessageStruct{
+			telegramclient.Reply("replied", query.Message.ID),
+		}, nil
+	}
+
+	return query.Answer(m.Identifier()), nil, nil
+}
+
+// callbackQuery returns a test callback query with the given data for a button of the test message.
+func callbackQuery(data string) matcher.CallbackQueryStruct {
+	msg := telegramclient.TestWebhookMessage("menu")
+
+	return matcher.CallbackQueryStruct{
+		ID:              "q1",
+		From:            msg.From,
+		Message:         &msg,
+		InlineMessageID: "",
+		ChatInstance:    "",
+		Data:            data,
+	}
+}
+
+// TestRegistry_ProcessCallbackQuery_Routing verifies that callback queries are routed to the matcher
+// declaring the longest prefix of their data and that every query is answered.
+func TestRegistry_ProcessCallbackQuery_Routing(t *testing.T) {
+	t.Parallel()
+
+	client := &answeringTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client)
+	reg.Register(makeEchoMatcher("echo"))
+	reg.Register(makeMenuMatcher("menu", "menu:"))
+	reg.Register(makeMenuMatcher("settings", "menu:settings:", "settings:"))
+
+	reg.ProcessCallbackQuery(callbackQuery("menu:open"))
+	reg.ProcessCallbackQuery(callbackQuery("menu:settings:lang"))
+	reg.ProcessCallbackQuery(callbackQuery("settings:lang"))
+	reg.ProcessCallbackQuery(callbackQuery("unknown"))
+
+	assert.Equal(t, []string{"menu", "settings", "settings", ""}, client.answeredTexts())
+	assert.Empty(t, client.sentTexts())
+
+	for _, answer := range client.answers {
+		assert.Equal(t, "q1", answer.CallbackQueryID)
+	}
+}
+
+// TestRegistry_ProcessCallbackQuery_Messages verifies that messages returned for a callback query are sent
+// to the chat of the originating message after the query was answered.
+func TestRegistry_ProcessCallbackQuery_Messages(t *testing.T) {
+	t.Parallel()
+
+	client := &answeringTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client)
+
+	m := makeMenuMatcher("menu", "")
+	reg.Register(m)
+
+	query := callbackQuery("reply")
+	reg.ProcessCallbackQuery(query)
+
+	assert.Equal(t, []string{""}, client.answeredTexts())
+	assert.Equal(t, []string{"replied"}, client.sentTexts())
+	assert.Equal(t, []int64{query.Message.Chat.ID}, client.sentTo)
+	require.Len(t, *m.queries, 1)
+	assert.Equal(t, query.Message, (*m.queries)[0].Message)
+
+	query.Message = nil
+	reg.ProcessCallbackQuery(query)
+	assert.Equal(t, []string{"replied"}, client.sentTexts())
+}
+
+// TestRegistry_ProcessCallbackQuery_Errors verifies that errors and panics are shown as alerts and that
+// panics count towards quarantine.
+func TestRegistry_ProcessCallbackQuery_Errors(t *testing.T) {
+	t.Parallel()
+
+	client := &answeringTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithPanicThreshold(1))
+	reg.Register(makeMenuMatcher("menu", ""))
+
+	reg.ProcessCallbackQuery(callbackQuery("fail"))
+	reg.ProcessCallbackQuery(callbackQuery("boom"))
+	reg.ProcessCallbackQuery(callbackQuery("menu:open"))
+
+	require.Len(t, client.answers, 3)
+	assert.Equal(t, `⚠️ Error in matcher "menu": failed`, client.answers[0].Text)
+	assert.True(t, client.answers[0].ShowAlert)
+	assert.Equal(t, `⚠️ Error in matcher "menu": panic: boom`, client.answers[1].Text)
+	assert.Empty(t, client.answers[2].Text)
+	assert.True(t, reg.IsQuarantined("menu"))
+}
+
+// hungMenuMatcher is a menuMatcher whose ProcessCallback ignores its context and blocks until release is closed.
+type hungMenuMatcher struct {
+	menuMatcher
+
+	release chan struct{}
+}
+
+// ProcessCallback blocks until the matcher is released.
+func (m hungMenuMatcher) ProcessCallback(
+	ctx context.Context,
+	query matcher.CallbackQueryStruct,
+) (matcher.CallbackAnswerStruct, []telegramclient.MessageStruct, error) {
+	<-m.release
+
+	return m.menuMatcher.ProcessCallback(ctx, query)
+}
+
+// TestRegistry_ProcessCallbackQuery_Deadline verifies that a matcher ignoring its deadline is abandoned and
+// the query is answered with an alert.
+func TestRegistry_ProcessCallbackQuery_Deadline(t *testing.T) {
+	t.Parallel()
+
+	client := &answeringTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithDefaultTimeout(20*time.Millisecond))
+
+	hung := hungMenuMatcher{menuMatcher: makeMenuMatcher("menu", ""), release: make(chan struct{})}
+	defer close(hung.release)
+
+	reg.Register(hung)
+
+	reg.ProcessCallbackQuery(callbackQuery("menu:open"))
+
+	require.Len(t, client.answers, 1)
+	assert.True(t, client.answers[0].ShowAlert)
+	assert.Contains(t, client.answers[0].Text, "context deadline exceeded")
+}
+
+// TestRegistry_ProcessCallbackQuery_Access verifies that disabled matchers do not receive callback queries
+// and that senders without permission get an alert.
+func TestRegistry_ProcessCallbackQuery_Access(t *testing.T) {
+	t.Parallel()
+
+	client := &answeringTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client)
+
+	falseVal := false
+	disabled := &matcher.Config{}
+	setConfigEnabled(disabled, &falseVal)
+
+	menu := makeMenuMatcher("menu", "menu:")
+	menu.Matcher = menu.WithConfig(disabled)
+	reg.Register(menu)
+
+	admin := makeMenuMatcher("admin", "admin:")
+	admin.Matcher = admin.WithPermissions(matcher.Permissions{Allow: []matcher.Role{matcher.RoleAdmin}, Deny: nil})
+	reg.Register(admin)
+
+	reg.ProcessCallbackQuery(callbackQuery("menu:open"))
+	reg.ProcessCallbackQuery(callbackQuery("admin:open"))
+
+	require.Len(t, client.answers, 2)
+	assert.Empty(t, client.answers[0].Text)
+	assert.Equal(t, "⛔ You are not allowed to use this command.", client.answers[1].Text)
+	assert.True(t, client.answers[1].ShowAlert)
+	assert.Empty(t, *menu.queries)
+	assert.Empty(t, *admin.queries)
+}
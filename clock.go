@@ -0,0 +1,32 @@
+package matcher
+
+import "time"
+
+// Clock provides the current time and timers to the Registry, so that retry delays can be tested
+// without waiting. Unless configured with WithClock, the Registry uses the system clock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel that receives the current time once the duration has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the Clock backed by the time package.
+type systemClock struct{}
+
+// Now returns time.Now.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// After returns time.After.
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// WithClock replaces the system clock used by the Registry, e.g. with a fake clock in tests.
+func WithClock(clock Clock) RegistryOption {
+	return func(r *Registry) {
+		r.clock = clock
+	}
+}
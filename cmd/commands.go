@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	matcher "github.com/br0-space/bot-matcher"
+)
+
+// errUnknownFormat is returned by printCommands for an unsupported output format.
+var errUnknownFormat = errors.New("unknown format")
+
+// printCommands writes the commands of all registered matchers to w, either as the "command - description"
+// list BotFather accepts (format "botfather") or as setMyCommands payloads (format "json").
+// With chat ID 0, the JSON output contains the default payload followed by one payload per configured chat
+// whose commands differ, and the BotFather output lists the default commands. Any other chat ID limits the
+// output to that chat. Invalid commands are skipped in the output and returned as error.
+func printCommands(w io.Writer, r *matcher.Registry, format string, chatID int64) error {
+	var (
+		output []byte
+		err    error
+	)
+
+	switch format {
+	case "botfather":
+		var commands []matcher.BotCommand
+		commands, err = r.BotCommands(chatID)
+		output = []byte(matcher.FormatBotFatherCommands(commands) + "\n")
+	case "json":
+		var payloads []matcher.SetMyCommandsPayload
+		if chatID == 0 {
+			payloads, err = r.SetMyCommandsPayloads()
+		} else {
+			var commands []matcher.BotCommand
+			commands, err = r.BotCommands(chatID)
+			payloads = []matcher.SetMyCommandsPayload{matcher.NewSetMyCommandsPayload(commands, chatID)}
+		}
+
+		output, _ = json.MarshalIndent(payloads, "", "  ")
+		output = append(output, '\n')
+	default:
+		return fmt.Errorf("%w %q, use botfather or json", errUnknownFormat, format)
+	}
+
+	if _, writeErr := w.Write(output); writeErr != nil {
+		return errors.Join(err, writeErr)
+	}
+
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	"github.com/br0-space/bot-matcher/examples/ping"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCommandsRegistry returns a registry with the ping matcher registered.
+func newCommandsRegistry() *matcher.Registry {
+	r := matcher.NewRegistry(logger.New(), telegramclient.NewMockClient())
+	r.Register(ping.MakeMatcher())
+
+	return r
+}
+
+// TestPrintCommands verifies the BotFather and JSON output formats of the commands subcommand.
+func TestPrintCommands(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+
+	require.NoError(t, printCommands(&out, newCommandsRegistry(), "botfather", 0))
+	assert.Equal(t, "ping - Responds with \"pong\"\n", out.String())
+
+	out.Reset()
+	require.NoError(t, printCommands(&out, newCommandsRegistry(), "json", 42))
+
+	var payloads []matcher.SetMyCommandsPayload
+	require.NoError(t, json.Unmarshal(out.Bytes(), &payloads))
+	assert.Equal(t, []matcher.SetMyCommandsPayload{{
+		Commands: []matcher.BotCommand{{Command: "ping", Description: `Responds with "pong"`}},
+		Scope:    matcher.BotCommandScope{Type: "chat", ChatID: 42},
+	}}, payloads)
+
+	require.ErrorIs(t, printCommands(&out, newCommandsRegistry(), "yaml", 0), errUnknownFormat)
+}
@@ -1,19 +1,26 @@
 package main
 
 import (
+	"os"
+
 	logger "github.com/br0-space/bot-logger"
 	matcher "github.com/br0-space/bot-matcher"
 	"github.com/br0-space/bot-matcher/examples/configurable"
 	"github.com/br0-space/bot-matcher/examples/null"
 	"github.com/br0-space/bot-matcher/examples/ping"
+	"github.com/br0-space/bot-matcher/matchers/admin"
+	"github.com/br0-space/bot-matcher/matchers/help"
 	telegramclient "github.com/br0-space/bot-telegramclient"
 	"github.com/spf13/pflag"
 )
 
 // main initializes a matcher registry and registers each example matcher.
+// Run with the "commands" argument to print the registered commands for BotFather or setMyCommands.
 func main() {
 	pflag.Bool("verbose", false, "enable verbose (debug) logging")
 	pflag.Bool("quiet", false, "only log errors")
+	format := pflag.String("format", "botfather", "output format of the commands subcommand: botfather or json")
+	chatID := pflag.Int64("chat", 0, "limit the commands subcommand to the given chat ID")
 	pflag.Parse()
 
 	log := logger.New()
@@ -22,10 +29,28 @@ func main() {
 	log.Info("Starting matcher registry example...")
 	log.Debug("Creating matcher registry...")
 
-	r := matcher.NewRegistry(log, telegram)
+	store := matcher.NewConfigStore()
+	r := matcher.NewRegistry(log, telegram, matcher.WithConfigStore(store))
+
+	configurableMatcher, err := configurable.MakeMatcher()
+	if err != nil {
+		log.Error("Error while loading the config of the configurable matcher:", err)
+		os.Exit(1)
+	}
 
 	// Register example matchers.
-	r.Register(configurable.MakeMatcher())
+	r.Register(configurableMatcher)
 	r.Register(ping.MakeMatcher())
 	r.Register(null.MakeMatcher())
+
+	// Register built-in matchers.
+	r.Register(help.MakeMatcher(r))
+	r.Register(admin.MakeMatcher(r, store))
+
+	if pflag.Arg(0) == "commands" {
+		if err := printCommands(os.Stdout, r, *format, *chatID); err != nil {
+			log.Error("Error while exporting commands:", err)
+			os.Exit(1)
+		}
+	}
 }
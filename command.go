@@ -0,0 +1,253 @@
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	telegramclient "github.com/br0-space/bot-telegramclient"
+)
+
+const usageTemplate = "⚠️ *Invalid arguments for \"%s\"*\n\n%s"
+
+var (
+	// errNotACommand is returned when parsing a text that does not start with a bot command.
+	errNotACommand = errors.New("not a bot command")
+	// errUnterminatedQuote is returned when a quoted argument is not closed.
+	errUnterminatedQuote = errors.New("unterminated quote")
+)
+
+// commandPattern matches a Telegram bot command with an optional bot username suffix at the start of a text.
+var commandPattern = regexp.MustCompile(`^/([A-Za-z0-9_]{1,32})(?:@([A-Za-z0-9_]+))?(?:\s|$)`)
+
+// quotePairs maps opening quote characters to the closing quote they expect. Typographic quotes are
+// included because mobile keyboards often replace straight quotes automatically.
+var quotePairs = map[rune]rune{
+	'"':  '"',
+	'\'': '\'',
+	'“':  '”',
+	'„':  '“',
+	'‘':  '’',
+}
+
+// Command is a parsed Telegram bot command like `/cmd@botname arg1 "quoted arg" --flag=value`.
+type Command struct {
+	// Name is the command without the leading slash and bot username suffix.
+	Name string
+	// BotUsername is the bot username the command was addressed to with /cmd@botname, or empty.
+	BotUsername string
+	// Args are the positional arguments in order.
+	Args []string
+	// Flags are the named flags given as --name=value or --name. Bare flags have the value "true".
+	// Flag names are lowercased.
+	Flags map[string]string
+	// Rest is the raw text following the command, with surrounding whitespace removed.
+	Rest string
+}
+
+// ParseCommand parses a text starting with a Telegram bot command.
+//
+// Arguments are separated by whitespace. An argument starting with a quote (", ', “, „ or ‘) extends to
+// the matching closing quote, and backslash escapes are supported within double quotes. Quotes inside an
+// argument (like in "don't") are kept as-is. Arguments starting with "--" are flags, either --name=value
+// (the value may be quoted) or --name. A bare "--" ends flag parsing: all following arguments are positional.
+func ParseCommand(text string) (Command, error) {
+	match := commandPattern.FindStringSubmatchIndex(text)
+	if match == nil {
+		return Command{}, errNotACommand
+	}
+
+	cmd := Command{
+		Name:        text[match[2]:match[3]],
+		BotUsername: "",
+		Args:        []string{},
+		Flags:       map[string]string{},
+		Rest:        strings.TrimSpace(text[match[1]:]),
+	}
+
+	if match[4] >= 0 {
+		cmd.BotUsername = text[match[4]:match[5]]
+	}
+
+	tokens, err := tokenize(cmd.Rest)
+	if err != nil {
+		return Command{}, err
+	}
+
+	flagsEnded := false
+
+	for _, tok := range tokens {
+		switch {
+		case flagsEnded || tok.quoted || !strings.HasPrefix(tok.text, "--"):
+			cmd.Args = append(cmd.Args, tok.text)
+		case tok.text == "--":
+			flagsEnded = true
+		default:
+			name, value, found := strings.Cut(tok.text[2:], "=")
+			if !found {
+				value = "true"
+			}
+
+			cmd.Flags[strings.ToLower(name)] = value
+		}
+	}
+
+	return cmd, nil
+}
+
+// IsAddressedTo reports whether the command is meant for the bot with the given username,
+// i.e. it has no bot username suffix or the suffix matches (case-insensitive).
+func (c Command) IsAddressedTo(botUsername string) bool {
+	return c.BotUsername == "" || strings.EqualFold(c.BotUsername, strings.TrimPrefix(botUsername, "@"))
+}
+
+// token is a single argument of a command.
+type token struct {
+	text   string
+	quoted bool
+}
+
+// tokenize splits the arguments of a command into tokens, see ParseCommand for the grammar.
+func tokenize(text string) ([]token, error) {
+	runes := []rune(text)
+	tokens := []token{}
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+
+			continue
+		}
+
+		var (
+			sb     strings.Builder
+			quoted bool
+		)
+
+		for i < len(runes) && !unicode.IsSpace(runes[i]) {
+			_, isQuote := quotePairs[runes[i]]
+
+			// quotes are only special at the start of an argument or a flag value
+			startsValue := sb.Len() == 0 || strings.HasPrefix(sb.String(), "--") && strings.HasSuffix(sb.String(), "=")
+			if !isQuote || !startsValue {
+				sb.WriteRune(runes[i])
+				i++
+
+				continue
+			}
+
+			value, next, err := readQuoted(runes, i)
+			if err != nil {
+				return nil, err
+			}
+
+			quoted = quoted || sb.Len() == 0
+			sb.WriteString(value)
+			i = next
+		}
+
+		tokens = append(tokens, token{text: sb.String(), quoted: quoted})
+	}
+
+	return tokens, nil
+}
+
+// readQuoted reads the quoted string starting with the opening quote at runes[start].
+// It returns the unquoted value and the index following the closing quote.
+func readQuoted(runes []rune, start int) (string, int, error) {
+	opening := runes[start]
+	closing := quotePairs[opening]
+	escapes := opening != '\'' && opening != '‘'
+
+	var sb strings.Builder
+
+	for i := start + 1; i < len(runes); i++ {
+		switch {
+		case escapes && runes[i] == '\\' && i+1 < len(runes):
+			i++
+			sb.WriteRune(runes[i])
+		case runes[i] == closing || opening == '“' && runes[i] == '"':
+			return sb.String(), i + 1, nil
+		default:
+			sb.WriteRune(runes[i])
+		}
+	}
+
+	return "", 0, fmt.Errorf("%w starting at %q", errUnterminatedQuote, string(runes[start:]))
+}
+
+// UsageError is returned by Matcher.ParseCommand if a command could not be parsed or its arguments could
+// not be bound. It carries the matcher's help entries for the command to render a usage reply.
+type UsageError struct {
+	Command string
+	Help    []HelpStruct
+	Err     error
+}
+
+// Error describes why the arguments are invalid.
+func (e *UsageError) Error() string {
+	return fmt.Sprintf("invalid arguments for /%s: %s", e.Command, e.Err)
+}
+
+// Unwrap returns the underlying parse or bind error.
+func (e *UsageError) Unwrap() error {
+	return e.Err
+}
+
+// Reply returns a Markdown reply to the given message explaining the error together with the usage and
+// example from the matcher's help entries.
+func (e *UsageError) Reply(messageID int64) telegramclient.MessageStruct {
+	lines := []string{telegramclient.EscapeMarkdown(e.Err.Error())}
+
+	for _, help := range e.Help {
+		if help.Usage != "" {
+			lines = append(lines, "*Usage:* "+telegramclient.EscapeMarkdown(help.Usage))
+		}
+
+		if help.Example != "" {
+			lines = append(lines, "*Example:* "+telegramclient.EscapeMarkdown(help.Example))
+		}
+	}
+
+	return telegramclient.MarkdownReply(
+		fmt.Sprintf(usageTemplate, telegramclient.EscapeMarkdown("/"+e.Command), strings.Join(lines, "\n")),
+		messageID,
+	)
+}
+
+// ParseCommand parses the command in the message's text or caption and binds its arguments to target,
+// see Command.Bind. If target is nil, the command is only parsed.
+// On failure, it returns a *UsageError carrying the matcher's help entries for the command, whose Reply
+// can be returned to the user.
+func (m Matcher) ParseCommand(messageIn telegramclient.WebhookMessageStruct, target any) (Command, error) {
+	text := messageIn.TextOrCaption()
+
+	cmd, err := ParseCommand(text)
+	if err == nil && target != nil {
+		err = cmd.Bind(target)
+	}
+
+	if err != nil {
+		name := cmd.Name
+		if fields := strings.Fields(text); name == "" && len(fields) > 0 {
+			name = strings.TrimPrefix(fields[0], "/")
+		}
+
+		return cmd, &UsageError{Command: name, Help: m.helpFor(name), Err: err}
+	}
+
+	return cmd, nil
+}
+
+// helpFor returns the help entries for the given command. If no entry matches, all entries are returned.
+func (m Matcher) helpFor(command string) []HelpStruct {
+	for _, help := range m.help {
+		if strings.EqualFold(strings.TrimPrefix(help.Command, "/"), command) {
+			return []HelpStruct{help}
+		}
+	}
+
+	return m.help
+}
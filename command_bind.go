@@ -0,0 +1,202 @@
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// commandTag is the struct tag used by Command.Bind.
+const commandTag = "command"
+
+var (
+	// errInvalidBindTarget is returned when Command.Bind is called with something else than a pointer to a struct.
+	errInvalidBindTarget = errors.New("bind target must be a non-nil pointer to a struct")
+	// errMissingArgument is returned when a required argument, flag or text is missing.
+	errMissingArgument = errors.New("missing")
+	// errUnknownFlag is returned for flags that are not bound to any field.
+	errUnknownFlag = errors.New("unknown flag")
+	// errTooManyArguments is returned for positional arguments that are not bound to any field.
+	errTooManyArguments = errors.New("too many arguments")
+	// errUnsupportedField is returned for tagged fields of a type Bind cannot set.
+	errUnsupportedField = errors.New("unsupported field type")
+)
+
+// durationType is the reflect.Type of time.Duration, which is parsed with time.ParseDuration.
+var durationType = reflect.TypeFor[time.Duration]()
+
+// Bind sets the fields of the struct target points to from the command's arguments, according to their
+// `command` struct tags:
+//
+//   - `command:"arg"` binds the next positional argument, in field order
+//   - `command:"args"` binds all remaining positional arguments to a []string
+//   - `command:"--name"` binds the flag --name
+//   - `command:"rest"` binds the raw text following the command
+//
+// Append ",required" to a tag to make the value mandatory, e.g. `command:"arg,required"`.
+// Supported field types are string, bool, signed and unsigned integers, floats and time.Duration.
+// Flags and positional arguments not bound to any field are errors. All problems are returned joined.
+func (c Command) Bind(target any) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errInvalidBindTarget
+	}
+
+	v = v.Elem()
+
+	var errs []error
+
+	argIndex := 0
+	boundFlags := map[string]bool{}
+	restArgs := false
+
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+
+		tag, ok := field.Tag.Lookup(commandTag)
+		if !ok || !field.IsExported() {
+			continue
+		}
+
+		kind, options, _ := strings.Cut(tag, ",")
+		required := options == "required"
+
+		var (
+			name  string
+			value string
+			isSet bool
+		)
+
+		switch {
+		case kind == "arg":
+			name = "argument <" + strings.ToLower(field.Name) + ">"
+			isSet = argIndex < len(c.Args)
+
+			if isSet {
+				value = c.Args[argIndex]
+			}
+
+			argIndex++
+		case kind == "args":
+			restArgs = true
+
+			args := []string{}
+			if argIndex < len(c.Args) {
+				args = append(args, c.Args[argIndex:]...)
+			}
+
+			if required && len(args) == 0 {
+				errs = append(errs, fmt.Errorf("%w arguments", errMissingArgument))
+			}
+
+			if field.Type != reflect.TypeFor[[]string]() {
+				errs = append(errs, fmt.Errorf("%w %s for %s", errUnsupportedField, field.Type, field.Name))
+
+				continue
+			}
+
+			v.Field(i).Set(reflect.ValueOf(args))
+
+			continue
+		case kind == "rest":
+			name = "text"
+			value = c.Rest
+			isSet = c.Rest != ""
+		case strings.HasPrefix(kind, "--"):
+			flag := strings.ToLower(kind[2:])
+			name = "flag --" + flag
+			value, isSet = c.Flags[flag]
+			boundFlags[flag] = true
+		default:
+			errs = append(errs, fmt.Errorf("%w: invalid tag %q on %s", errUnsupportedField, tag, field.Name))
+
+			continue
+		}
+
+		if !isSet {
+			if required {
+				errs = append(errs, fmt.Errorf("%w %s", errMissingArgument, name))
+			}
+
+			continue
+		}
+
+		if err := setField(v.Field(i), value); err != nil {
+			// strconv errors repeat the function name and value, only keep the reason
+			var numErr *strconv.NumError
+			if errors.As(err, &numErr) {
+				err = numErr.Err
+			}
+
+			errs = append(errs, fmt.Errorf("invalid value %q for %s: %w", value, name, err))
+		}
+	}
+
+	for _, flag := range slices.Sorted(maps.Keys(c.Flags)) {
+		if !boundFlags[flag] {
+			errs = append(errs, fmt.Errorf("%w --%s", errUnknownFlag, flag))
+		}
+	}
+
+	if !restArgs && argIndex < len(c.Args) {
+		errs = append(errs, fmt.Errorf("%w: %s", errTooManyArguments, strings.Join(c.Args[argIndex:], " ")))
+	}
+
+	return errors.Join(errs...)
+}
+
+// setField parses value according to the field's type and assigns it.
+func setField(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(int64(d))
+
+		return nil
+	}
+
+	switch field.Kind() { //nolint:exhaustive
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("%w %s", errUnsupportedField, field.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package matcher_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseCommand covers the command grammar: bot username, quoting, flags and remaining text.
+func TestParseCommand(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in       string
+		expected matcher.Command
+	}{
+		{"/ping", matcher.Command{Name: "ping", Args: []string{}, Flags: map[string]string{}}},
+		{"/ping@MyBot", matcher.Command{Name: "ping", BotUsername: "MyBot", Args: []string{}, Flags: map[string]string{}}},
+		{
+			`/cmd@bot arg1 "quoted arg" --flag=value`,
+			matcher.Command{
+				Name:        "cmd",
+				BotUsername: "bot",
+				Args:        []string{"arg1", "quoted arg"},
+				Flags:       map[string]string{"flag": "value"},
+				Rest:        `arg1 "quoted arg" --flag=value`,
+			},
+		},
+		{
+			`/say don't "say \"hi\"" 'single \ quote' “smart quotes” --Name="a b" --verbose`,
+			matcher.Command{
+				Name:  "say",
+				Args:  []string{"don't", `say "hi"`, `single \ quote`, "smart quotes"},
+				Flags: map[string]string{"name": "a b", "verbose": "true"},
+				Rest:  `don't "say \"hi\"" 'single \ quote' “smart quotes” --Name="a b" --verbose`,
+			},
+		},
+		{
+			`/calc -- --5 "--x"`,
+			matcher.Command{Name: "calc", Args: []string{"--5", "--x"}, Flags: map[string]string{}, Rest: `-- --5 "--x"`},
+		},
+		{
+			"/note   multi\nline  ",
+			matcher.Command{Name: "note", Args: []string{"multi", "line"}, Flags: map[string]string{}, Rest: "multi\nline"},
+		},
+	}
+
+	for _, tt := range tests {
+		cmd, err := matcher.ParseCommand(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.expected, cmd, tt.in)
+	}
+}
+
+// TestParseCommand_Errors verifies that non-commands and unterminated quotes are rejected.
+func TestParseCommand_Errors(t *testing.T) {
+	t.Parallel()
+
+	for _, in := range []string{"", "ping", " /ping", "/ping/x", `/say "unterminated`, "/say --x='open"} {
+		_, err := matcher.ParseCommand(in)
+		require.Error(t, err, in)
+	}
+}
+
+// TestCommand_IsAddressedTo verifies the bot username check.
+func TestCommand_IsAddressedTo(t *testing.T) {
+	t.Parallel()
+
+	cmd, err := matcher.ParseCommand("/ping")
+	require.NoError(t, err)
+	assert.True(t, cmd.IsAddressedTo("mybot"))
+
+	cmd, err = matcher.ParseCommand("/ping@MyBot")
+	require.NoError(t, err)
+	assert.True(t, cmd.IsAddressedTo("@mybot"))
+	assert.False(t, cmd.IsAddressedTo("otherbot"))
+}
+
+// weatherArgs is a sample bind target.
+type weatherArgs struct {
+	City    string        `command:"arg,required"`
+	Days    int           `command:"--days"`
+	Verbose bool          `command:"--verbose"`
+	Every   time.Duration `command:"--every"`
+	Extra   []string      `command:"args"`
+	Text    string        `command:"rest"`
+	Ignored string
+}
+
+// TestCommand_Bind verifies binding of arguments, flags and remaining text into a struct.
+func TestCommand_Bind(t *testing.T) {
+	t.Parallel()
+
+	cmd, err := matcher.ParseCommand(`/weather "New York" tomorrow --days=3 --verbose --every=1h`)
+	require.NoError(t, err)
+
+	var args weatherArgs
+	require.NoError(t, cmd.Bind(&args))
+	assert.Equal(t, weatherArgs{
+		City:    "New York",
+		Days:    3,
+		Verbose: true,
+		Every:   time.Hour,
+		Extra:   []string{"tomorrow"},
+		Text:    `"New York" tomorrow --days=3 --verbose --every=1h`,
+	}, args)
+}
+
+// TestCommand_Bind_Errors verifies that all binding problems are reported together.
+func TestCommand_Bind_Errors(t *testing.T) {
+	t.Parallel()
+
+	cmd, err := matcher.ParseCommand(`/weather --days=many --unknown`)
+	require.NoError(t, err)
+
+	var args weatherArgs
+
+	err = cmd.Bind(&args)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing argument <city>")
+	assert.Contains(t, err.Error(), `invalid value "many" for flag --days: invalid syntax`)
+	assert.Contains(t, err.Error(), "unknown flag --unknown")
+
+	cmd, err = matcher.ParseCommand(`/weather Berlin --zulu --alpha --mike`)
+	require.NoError(t, err)
+	require.EqualError(t, cmd.Bind(&args), "unknown flag --alpha\nunknown flag --mike\nunknown flag --zulu")
+
+	type single struct {
+		Value string `command:"arg"`
+	}
+
+	cmd, err = matcher.ParseCommand(`/single a b`)
+	require.NoError(t, err)
+	require.ErrorContains(t, cmd.Bind(&single{}), "too many arguments: b")
+
+	require.Error(t, cmd.Bind(single{}))
+}
+
+// TestMatcher_ParseCommand_UsageReply verifies that bind errors are returned as *UsageError rendering
+// the matcher's usage and example.
+func TestMatcher_ParseCommand_UsageReply(t *testing.T) {
+	t.Parallel()
+
+	m := matcher.MakeMatcher("weather", regexp.MustCompile(`^/weather`), []matcher.HelpStruct{{
+		Command:     "weather",
+		Description: "Shows the weather",
+		Usage:       "/weather <city> [--days=N]",
+		Example:     "/weather Berlin --days=3",
+	}})
+
+	var args weatherArgs
+
+	cmd, err := m.ParseCommand(telegramclient.TestWebhookMessage("/weather Berlin --days=2"), &args)
+	require.NoError(t, err)
+	assert.Equal(t, "weather", cmd.Name)
+	assert.Equal(t, "Berlin", args.City)
+
+	_, err = m.ParseCommand(telegramclient.TestWebhookMessage("/weather@bot"), &args)
+
+	var usageErr *matcher.UsageError
+	require.ErrorAs(t, err, &usageErr)
+	assert.Equal(t, "weather", usageErr.Command)
+
+	reply := usageErr.Reply(123)
+	assert.Equal(t, int64(123), reply.ReplyToMessageID)
+	assert.Equal(t, "MarkdownV2", reply.ParseMode)
+	assert.Contains(t, reply.Text, "missing argument <city\\>")
+	assert.Contains(t, reply.Text, "*Usage:* /weather <city\\> \\[\\-\\-days\\=N\\]")
+	assert.Contains(t, reply.Text, "*Example:* /weather Berlin \\-\\-days\\=3")
+}
@@ -1,80 +1,413 @@
 package matcher
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"path/filepath"
-	"strconv"
+	"io/fs"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
 
 	logger "github.com/br0-space/bot-logger"
 	"github.com/spf13/viper"
 )
 
+const (
+	// defaultConfigRoot is the directory containing the matcher configs unless configured otherwise.
+	defaultConfigRoot = "config"
+	// configKeyEnabled is the config key controlling whether a matcher is enabled.
+	configKeyEnabled = "enabled"
+)
+
+// loadOptions holds the settings of LoadMatcherConfig.
+type loadOptions struct {
+	fsys        fs.FS
+	dir         string
+	root        string
+	envPrefix   string
+	strict      bool
+	identifiers []string
+}
+
+// LoadOption configures optional behavior of LoadMatcherConfig.
+type LoadOption func(o *loadOptions)
+
+// newLoadOptions returns the default settings of LoadMatcherConfig with the given options applied.
+func newLoadOptions(opts ...LoadOption) loadOptions {
+	o := loadOptions{
+		fsys:        os.DirFS("."),
+		dir:         ".",
+		root:        defaultConfigRoot,
+		envPrefix:   defaultEnvPrefix,
+		strict:      false,
+		identifiers: nil,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// WithFS reads the configs from the given file system, e.g. an embed.FS or a fstest.MapFS in tests,
+// instead of the working directory. Configs read from an arbitrary fs.FS cannot be watched for changes,
+// see WithDir.
+func WithFS(fsys fs.FS) LoadOption {
+	return func(o *loadOptions) {
+		o.fsys = fsys
+		o.dir = ""
+	}
+}
+
+// WithDir reads the configs relative to the given directory instead of the working directory.
+// Unlike WithFS, configs read from a directory can be watched by ReloadableConfig.
+func WithDir(dir string) LoadOption {
+	return func(o *loadOptions) {
+		o.fsys = os.DirFS(dir)
+		o.dir = dir
+	}
+}
+
+// WithRoot sets the directory within the file system containing the matcher configs. It defaults to "config".
+// The path must be slash-separated and unrooted, as required by fs.FS.
+func WithRoot(root string) LoadOption {
+	return func(o *loadOptions) {
+		o.root = root
+	}
+}
+
 // LoadMatcherConfig loads configurations for a matcher per chat.
 // It returns a map keyed by chatID (int64) to a value of type T, or an error if loading fails.
+// Configs are read from the working directory unless another source is given with WithFS or WithDir,
+// and from the config/ directory within it unless another one is given with WithRoot.
 // The fallback config is read from config/{identifier}.yml and stored under key 0.
-// Additionally, all files matching config/{chatID}/{identifier}.yml are read and stored under their chatID key.
-// Returns an error if reading or unmarshalling any relevant file fails.
-func LoadMatcherConfig[T any](identifier string) (map[int64]T, error) {
+// Additionally, all files matching config/{chatID}/{identifier}.yml are layered on top of the fallback
+// and stored under their chatID key, so a per-chat file only needs to contain the keys it overrides:
+//   - maps are merged recursively, key by key
+//   - lists and scalar values replace the fallback value as a whole
+//   - an explicit null (e.g. "reply: ~") removes the fallback value, resetting the key to its zero value
+//
+// Besides .yml, config files may use the extensions .yaml, .json and .toml. If several files exist for
+// the same chat, the first one in this order is read.
+//
+// Environment variables override single values: BOT_{IDENTIFIER}_{KEY} for all chats and
+// BOT_{CHATID}_{IDENTIFIER}_{KEY} for a single chat, with the identifier and key uppercased, characters
+// other than letters and digits replaced by underscores (so chat ID -100123 becomes _100123) and nested
+// keys separated by double underscores, e.g. BOT_WEATHER_LIMITS__USER=5. The prefix can be changed with
+// WithEnvPrefix. Values are applied in this order, later ones taking precedence, so environment variables
+// always override file values:
+//  1. the fallback file
+//  2. the per-chat file
+//  3. environment variables for all chats
+//  4. environment variables for the chat
+//
+// If a variable name also matches a longer identifier, e.g. BOT_KARMA_TOP_LIMIT for the matchers "karma" and
+// "karma_top", it belongs to the longest one. Identifiers are known from the config files in the config
+// directory and from WithKnownIdentifiers.
+//
+// A per-chat environment variable also creates a config for its chat if there is no per-chat file.
+//
+// If T embeds matcher.Config, the "enabled", "cooldowns" and "permissions" keys are applied to it as well. If T implements
+// ValidatorInterface, every decoded config is validated. With WithStrict, unknown keys are errors too.
+// Loading does not stop at the first problem: all files are checked and every problem is returned as
+// *ConfigError, joined into a single error, in which case no configs are returned.
+func LoadMatcherConfig[T any](identifier string, opts ...LoadOption) (map[int64]T, error) {
+	options := newLoadOptions(opts...)
 	log := logger.New()
 	out := make(map[int64]T)
 
+	var errs []error
+
 	log.Debugf("%s: requested to load matcher config", identifier)
 
-	// Per chat configs in config/{chatID}/{identifier}.yml
-	pattern := fmt.Sprintf("config/*/%s.yml", identifier)
+	globalEnv, chatEnv := envLayers(options.envPrefix, identifier, options.knownIdentifiers())
+
+	// Fallback config at key 0
+	fallbackPath, _ := findConfigFile(options.fsys, options.root, identifier)
+	log.Debugf("%s: reading fallback config: %s", identifier, fallbackPath)
+
+	fallbackFile, err := readConfigLayer(options.fsys, fallbackPath)
+	if err != nil {
+		log.Debugf("%s: failed to read fallback config %s: %v", identifier, fallbackPath, err)
+		errs = append(errs, &ConfigError{Path: fallbackPath, Key: "", Err: fmt.Errorf("failed to read fallback config: %w", err)})
+	}
+
+	layers := append([]configLayer{fallbackFile}, globalEnv...)
+
+	_, base, fallbackErrs, fallbackInvalid := decodeConfigLayers[T](fallbackPath, "fallback", nil, layers, options)
+	errs = append(errs, fallbackErrs...)
+	errs = append(errs, fallbackInvalid...)
+	out[0] = base
+
+	// per-chat configs inherit the values of the fallback, so its validation problems are only reported once
+	reported := make(map[string]bool, len(fallbackInvalid))
+	for _, err := range fallbackInvalid {
+		reported[configErrorKey(err)] = true
+	}
+
+	// per-chat configs are layered on the fallback file; global environment variables are applied on top of
+	// every file, and their problems were already reported for the fallback
+	fallback := mergeConfigMaps(nil, fallbackFile.settings)
 
-	matches, _ := filepath.Glob(pattern)
-	for _, p := range matches {
-		// extract chatID from the parent directory name
-		dir := filepath.Base(filepath.Dir(p))
+	reportedEnv := make([]configLayer, 0, len(globalEnv))
+	for _, layer := range globalEnv {
+		layer.reported = true
+		reportedEnv = append(reportedEnv, layer)
+	}
+
+	// Per chat configs in config/{chatID}/{identifier}.yml and per-chat environment variables
+	chatFiles := chatConfigFiles(options.fsys, options.root, identifier)
 
-		chatID, err := strconv.ParseInt(dir, 10, 64)
-		if err != nil {
-			continue // skip non-numeric directories
+	chatIDs := slices.Collect(maps.Keys(chatFiles))
+	for chatID := range chatEnv {
+		if _, ok := chatFiles[chatID]; !ok {
+			chatIDs = append(chatIDs, chatID)
 		}
+	}
+
+	slices.Sort(chatIDs)
 
-		log.Debugf("%s: reading per-chat config for chatID=%d from %s", identifier, chatID, p)
+	for _, chatID := range chatIDs {
+		var layers []configLayer
 
-		v2 := viper.New()
-		v2.SetConfigFile(p)
+		source := ""
 
-		if err := v2.ReadInConfig(); err != nil {
-			log.Debugf("%s: failed to read per-chat config %s: %v", identifier, p, err)
+		if file, ok := chatFiles[chatID]; ok {
+			log.Debugf("%s: reading per-chat config for chatID=%d from %s", identifier, chatID, file)
 
-			return nil, fmt.Errorf("failed to read per-chat config %s: %w", p, err)
+			chatFile, err := readConfigLayer(options.fsys, file)
+			if err != nil {
+				log.Debugf("%s: failed to read per-chat config %s: %v", identifier, file, err)
+				errs = append(errs, &ConfigError{Path: file, Key: "", Err: fmt.Errorf("failed to read per-chat config: %w", err)})
+
+				continue
+			}
+
+			source = file
+			layers = append(layers, chatFile)
 		}
 
-		var cfg T
-		if err := v2.Unmarshal(&cfg); err != nil {
-			log.Debugf("%s: failed to unmarshal per-chat config %s: %v", identifier, p, err)
+		layers = append(layers, reportedEnv...)
+		layers = append(layers, chatEnv[chatID]...)
 
-			return nil, fmt.Errorf("failed to unmarshal per-chat config %s: %w", p, err)
+		if source == "" {
+			source = chatEnv[chatID][0].source
+		}
+
+		_, cfg, chatErrs, chatInvalid := decodeConfigLayers[T](source, "per-chat", fallback, layers, options)
+		errs = append(errs, chatErrs...)
+
+		for _, err := range chatInvalid {
+			if !reported[configErrorKey(err)] {
+				errs = append(errs, err)
+			}
 		}
 
 		out[chatID] = cfg
 	}
 
-	// Fallback config at key 0
-	fallbackPath := fmt.Sprintf("config/%s.yml", identifier)
-	log.Debugf("%s: reading fallback config: %s", identifier, fallbackPath)
+	if len(errs) > 0 {
+		err := errors.Join(errs...)
+		log.Debugf("%s: failed to load matcher config: %v", identifier, err)
+
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// decodeConfigLayers layers the given layers on top of base in order and decodes the result into T.
+// It returns the merged settings, the decoded config, the problems found in the layers themselves and
+// the problems reported by validating the decoded config, all as *ConfigError. Problems of the decoded
+// config are reported for the given source. The kind ("fallback" or "per-chat") is used in error messages.
+func decodeConfigLayers[T any](
+	source string,
+	kind string,
+	base map[string]any,
+	layers []configLayer,
+	options loadOptions,
+) (map[string]any, T, []error, []error) {
+	var errs []error
+
+	merged := base
+
+	for _, layer := range layers {
+		if options.strict && !layer.reported {
+			errs = append(errs, unknownKeys(layer.source, layer.settings, reflect.TypeFor[T]())...)
+		}
+
+		merged = mergeConfigMaps(merged, layer.settings)
+	}
+
+	cfg, err := decodeConfig[T](merged)
+	if err != nil {
+		errs = append(errs, &ConfigError{Path: source, Key: "", Err: fmt.Errorf("failed to unmarshal %s config: %w", kind, err)})
+
+		return merged, cfg, errs, nil
+	}
+
+	return merged, cfg, errs, validateConfig(source, cfg)
+}
+
+// configErrorKey identifies a validation problem independent of the file it was found in.
+func configErrorKey(err error) string {
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		return configErr.Key + ": " + configErr.Err.Error()
+	}
+
+	return err.Error()
+}
+
+// readConfigLayer reads the given config file in fsys into a layer with nested settings and lowercased keys.
+// The file format is derived from its extension. Unlike viper.AllSettings, keys explicitly set to null are
+// kept with a nil value so that mergeConfigMaps can tell them apart from keys that are not set at all.
+func readConfigLayer(fsys fs.FS, file string) (configLayer, error) {
+	layer := configLayer{source: file, settings: nil, reported: false}
+
+	content, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return layer, err
+	}
 
 	v := viper.New()
-	v.SetConfigFile(fallbackPath)
+	v.SetConfigType(configType(file))
 
-	if err := v.ReadInConfig(); err != nil {
-		log.Debugf("%s: failed to read fallback config %s: %v", identifier, fallbackPath, err)
+	if err := v.ReadConfig(bytes.NewReader(content)); err != nil {
+		return layer, err
+	}
+
+	settings := make(map[string]any)
 
-		return nil, fmt.Errorf("failed to read fallback config %s: %w", fallbackPath, err)
+	for _, key := range v.AllKeys() {
+		keys := strings.Split(key, ".")
+		parent := settings
+
+		for _, k := range keys[:len(keys)-1] {
+			child, ok := parent[k].(map[string]any)
+			if !ok {
+				child = make(map[string]any)
+				parent[k] = child
+			}
+
+			parent = child
+		}
+
+		parent[keys[len(keys)-1]] = v.Get(key)
 	}
 
-	var base T
-	if err := v.Unmarshal(&base); err != nil {
-		log.Debugf("%s: failed to unmarshal fallback config %s: %v", identifier, fallbackPath, err)
+	layer.settings = settings
+
+	return layer, nil
+}
 
-		return nil, fmt.Errorf("failed to unmarshal fallback config %s: %w", fallbackPath, err)
+// mergeConfigMaps returns a new map containing base with overrides layered on top.
+// Nested maps are merged recursively, nil values remove the key and any other value
+// (including lists) replaces the value in base. Neither argument is modified.
+func mergeConfigMaps(base, overrides map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(overrides))
+	for k, v := range base {
+		merged[k] = v
 	}
 
-	out[0] = base
+	for k, v := range overrides {
+		switch override := v.(type) {
+		case nil:
+			delete(merged, k)
+		case map[string]any:
+			if baseMap, ok := merged[k].(map[string]any); ok {
+				merged[k] = mergeConfigMaps(baseMap, override)
+			} else {
+				merged[k] = mergeConfigMaps(nil, override)
+			}
+		default:
+			merged[k] = v
+		}
+	}
 
-	return out, nil
+	return merged
+}
+
+// decodeConfig unmarshals the given settings into a new value of type T.
+func decodeConfig[T any](settings map[string]any) (T, error) {
+	var cfg T
+
+	v := viper.New()
+	if err := v.MergeConfigMap(settings); err != nil {
+		return cfg, err
+	}
+
+	if err := v.Unmarshal(&cfg); err != nil {
+		return cfg, err
+	}
+
+	if err := decodeEmbeddedConfig(v, &cfg); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// decodeEmbeddedConfig populates the matcher.Config embedded in the struct target points to from
+// the values read by v. Viper cannot set the unexported fields of Config, so this is done here.
+func decodeEmbeddedConfig(v *viper.Viper, target any) error {
+	cfg := embeddedConfig(target)
+	if cfg == nil {
+		return nil
+	}
+
+	if v.IsSet(configKeyEnabled) {
+		enabled := v.GetBool(configKeyEnabled)
+		cfg.enabled = &enabled
+	}
+
+	if v.IsSet(configKeyCooldowns) {
+		cooldowns := &cooldownsConfig{PerUser: nil, PerChat: nil, Reply: nil}
+		if err := v.UnmarshalKey(configKeyCooldowns, cooldowns); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", configKeyCooldowns, err)
+		}
+
+		cfg.cooldowns = cooldowns
+	}
+
+	if v.IsSet(configKeyPermissions) {
+		permissions := &permissionsConfig{Allow: nil, Deny: nil}
+		if err := v.UnmarshalKey(configKeyPermissions, permissions); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", configKeyPermissions, err)
+		}
+
+		cfg.permissions = permissions
+	}
+
+	return nil
+}
+
+// embeddedConfig returns a pointer to the matcher.Config embedded in the struct target points to.
+// If target is a *Config itself, it is returned as-is. Otherwise, nil is returned.
+func embeddedConfig(target any) *Config {
+	if cfg, ok := target.(*Config); ok {
+		return cfg
+	}
+
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+
+	v = v.Elem()
+
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		if field.Anonymous && field.Type == reflect.TypeFor[Config]() {
+			cfg, _ := v.Field(i).Addr().Interface().(*Config)
+
+			return cfg
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,212 @@
+package matcher
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultEnvPrefix is the prefix of environment variables overriding config values unless configured otherwise.
+const defaultEnvPrefix = "BOT"
+
+// configExtensions are the supported config file extensions in order of precedence: if several files exist
+// for the same matcher and chat, the first one is read and the others are ignored.
+var configExtensions = []string{"yml", "yaml", "json", "toml"}
+
+var (
+	// envNameInvalidChars matches the characters replaced by underscores in environment variable names.
+	envNameInvalidChars = regexp.MustCompile(`[^A-Za-z0-9]`)
+	// envChatPattern matches the chat ID at the start of a per-chat environment variable name, without prefix.
+	envChatPattern = regexp.MustCompile(`^(_?[0-9]+)_(.+)$`)
+)
+
+// WithEnvPrefix sets the prefix of the environment variables overriding config values, see LoadMatcherConfig.
+// It defaults to "BOT". An empty prefix disables environment overrides.
+func WithEnvPrefix(prefix string) LoadOption {
+	return func(o *loadOptions) {
+		o.envPrefix = prefix
+	}
+}
+
+// configLayer is a set of settings read from a single source, a config file or an environment variable.
+type configLayer struct {
+	source   string
+	settings map[string]any
+	// reported marks layers whose problems have already been reported, e.g. global environment variables
+	// layered into every per-chat config after being checked for the fallback config.
+	reported bool
+}
+
+// WithKnownIdentifiers declares the identifiers of other matchers whose environment variables could be
+// mistaken for those of the loaded matcher, e.g. "karma_top" when loading "karma", see LoadMatcherConfig.
+// Matchers with a config file in the config directory are known without it.
+func WithKnownIdentifiers(identifiers ...string) LoadOption {
+	return func(o *loadOptions) {
+		o.identifiers = append(o.identifiers, identifiers...)
+	}
+}
+
+// knownIdentifiers returns the identifiers competing for environment variables: those of all config files
+// and those declared with WithKnownIdentifiers.
+func (o loadOptions) knownIdentifiers() []string {
+	return append(fileIdentifiers(o.fsys, o.root), o.identifiers...)
+}
+
+// fileIdentifiers returns the identifiers of all fallback and per-chat config files in root.
+func fileIdentifiers(fsys fs.FS, root string) []string {
+	var identifiers []string
+
+	for _, pattern := range []string{path.Join(root, "*"), path.Join(root, "*", "*")} {
+		files, _ := fs.Glob(fsys, pattern)
+		for _, file := range files {
+			ext := path.Ext(file)
+			if slices.Contains(configExtensions, strings.TrimPrefix(ext, ".")) {
+				identifiers = append(identifiers, strings.TrimSuffix(path.Base(file), ext))
+			}
+		}
+	}
+
+	return identifiers
+}
+
+// longerEnvNames returns the environment variable forms of the given identifiers that start with the form
+// of identifier followed by an underscore, i.e. whose variables would also match identifier.
+func longerEnvNames(identifier string, identifiers []string) []string {
+	matcherPrefix := envName(identifier) + "_"
+
+	var longer []string
+
+	for _, other := range identifiers {
+		if name := envName(other); strings.HasPrefix(name, matcherPrefix) && !slices.Contains(longer, name) {
+			longer = append(longer, name)
+		}
+	}
+
+	return longer
+}
+
+// findConfigFile returns the config file of the matcher with the given identifier in dir, choosing the
+// first existing extension in order of precedence. If none exists, the path with the first extension is
+// returned, so that reading it reports the missing file.
+func findConfigFile(fsys fs.FS, dir string, identifier string) (string, bool) {
+	for _, ext := range configExtensions {
+		file := path.Join(dir, identifier+"."+ext)
+		if info, err := fs.Stat(fsys, file); err == nil && !info.IsDir() {
+			return file, true
+		}
+	}
+
+	return path.Join(dir, identifier+"."+configExtensions[0]), false
+}
+
+// chatConfigFiles returns the per-chat config files of the matcher with the given identifier in root,
+// keyed by chat ID. Directories whose name is not a chat ID are skipped.
+func chatConfigFiles(fsys fs.FS, root string, identifier string) map[int64]string {
+	files := map[int64]string{}
+
+	dirs, _ := fs.Glob(fsys, path.Join(root, "*"))
+	for _, dir := range dirs {
+		chatID, err := strconv.ParseInt(path.Base(dir), 10, 64)
+		if err != nil {
+			continue // skip non-numeric directories
+		}
+
+		if file, ok := findConfigFile(fsys, dir, identifier); ok {
+			files[chatID] = file
+		}
+	}
+
+	return files
+}
+
+// envName converts an identifier or chat ID into its form in environment variable names: uppercased, with
+// all characters other than letters and digits replaced by underscores.
+func envName(s string) string {
+	return strings.ToUpper(envNameInvalidChars.ReplaceAllString(s, "_"))
+}
+
+// envLayers returns the environment variables overriding config values of the matcher with the given
+// identifier, one layer per variable sorted by name: those applying to all chats and those applying to a
+// single chat, keyed by chat ID. See LoadMatcherConfig for the naming scheme. Variables whose name also
+// matches a longer one of the given identifiers belong to that matcher and are skipped.
+func envLayers(prefix string, identifier string, identifiers []string) ([]configLayer, map[int64][]configLayer) {
+	var global []configLayer
+
+	chats := map[int64][]configLayer{}
+
+	if prefix == "" {
+		return global, chats
+	}
+
+	prefix = envName(prefix) + "_"
+	matcherPrefix := envName(identifier) + "_"
+	longer := longerEnvNames(identifier, identifiers)
+
+	belongsToOther := func(rest string) bool {
+		return slices.ContainsFunc(longer, func(name string) bool { return strings.HasPrefix(rest, name+"_") })
+	}
+
+	environ := os.Environ()
+	slices.Sort(environ)
+
+	for _, env := range environ {
+		name, value, _ := strings.Cut(env, "=")
+
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+
+		if key, ok := strings.CutPrefix(rest, matcherPrefix); ok && key != "" && !belongsToOther(rest) {
+			global = append(global, envLayer(name, key, value))
+
+			continue
+		}
+
+		match := envChatPattern.FindStringSubmatch(rest)
+		if match == nil {
+			continue
+		}
+
+		key, ok := strings.CutPrefix(match[2], matcherPrefix)
+		if !ok || key == "" || belongsToOther(match[2]) {
+			continue
+		}
+
+		chatID, err := strconv.ParseInt(strings.Replace(match[1], "_", "-", 1), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		chats[chatID] = append(chats[chatID], envLayer(name, key, value))
+	}
+
+	return global, chats
+}
+
+// envLayer returns the layer of a single environment variable setting the given key. The key is
+// lowercased and double underscores separate nested keys.
+func envLayer(name string, key string, value string) configLayer {
+	keys := strings.Split(strings.ToLower(key), "__")
+	settings := map[string]any{keys[len(keys)-1]: value}
+
+	for i := len(keys) - 2; i >= 0; i-- {
+		settings = map[string]any{keys[i]: settings}
+	}
+
+	return configLayer{source: "$" + name, settings: settings, reported: false}
+}
+
+// configType returns the viper config type of the given file based on its extension.
+func configType(file string) string {
+	ext := strings.TrimPrefix(path.Ext(file), ".")
+	if ext == "yml" {
+		return "yaml"
+	}
+
+	return ext
+}
@@ -0,0 +1,379 @@
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	logger "github.com/br0-space/bot-logger"
+	"github.com/fsnotify/fsnotify"
+	"go.yaml.in/yaml/v3"
+)
+
+var (
+	// errStoreReadOnly is returned when changing configs of a ConfigStore reading from an fs.FS.
+	errStoreReadOnly = errors.New("configs read with WithFS cannot be changed, use WithDir")
+	// errUnsupportedFormat is returned when changing a per-chat config file that is not YAML.
+	errUnsupportedFormat = errors.New("only YAML configs can be changed")
+	// ErrInvalidConfigKey is returned for config keys that cannot be set, see ConfigKeyPattern.
+	ErrInvalidConfigKey = errors.New("invalid config key")
+)
+
+// ConfigKeyPattern matches the dotted, lowercase config keys that can be set through a ConfigStore.
+var ConfigKeyPattern = regexp.MustCompile(`^[a-z0-9_]+(\.[a-z0-9_]+)*$`)
+
+// storeKey identifies the per-chat config of a matcher.
+type storeKey struct {
+	identifier string
+	chatID     int64
+}
+
+// ConfigStore reads and changes the per-chat config files config/{chatID}/{identifier}.yml at runtime,
+// e.g. to let chat admins enable or disable matchers. Changes are written to disk, so they survive a restart.
+//
+// Register it with WithConfigStore to have the Registry honor the "enabled" key of the per-chat files for
+// every matcher, including matchers that do not load a config themselves. Other keys only take effect for
+// matchers that reload their configs, see ReloadableConfig and OnChange.
+type ConfigStore struct {
+	options loadOptions
+	log     logger.Interface
+
+	mu       sync.RWMutex
+	enabled  map[storeKey]*bool
+	onChange []func(identifier string, chatID int64)
+	watcher  *fsnotify.Watcher
+}
+
+// NewConfigStore returns a ConfigStore for the per-chat configs in the working directory. The options are
+// interpreted as by LoadMatcherConfig, see WithDir and WithRoot. Configs read with WithFS cannot be changed.
+func NewConfigStore(opts ...LoadOption) *ConfigStore {
+	return &ConfigStore{
+		options:  newLoadOptions(opts...),
+		log:      logger.New(),
+		mu:       sync.RWMutex{},
+		enabled:  map[storeKey]*bool{},
+		onChange: nil,
+		watcher:  nil,
+	}
+}
+
+// WithConfigStore makes the Registry resolve the enabled state of matchers per chat from the given store
+// first, falling back to the matcher's own config if the chat's file does not set the "enabled" key.
+func WithConfigStore(store *ConfigStore) RegistryOption {
+	return func(r *Registry) {
+		r.configStore = store
+	}
+}
+
+// OnChange registers a handler called after a per-chat config has been changed through the store.
+func (s *ConfigStore) OnChange(handler func(identifier string, chatID int64)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onChange = append(s.onChange, handler)
+}
+
+// EnabledFor returns the "enabled" key of the matcher's config for the given chat, taking the environment
+// variables overriding it into account as LoadMatcherConfig does. If neither the chat's file nor an
+// environment variable sets the key, ok is false. Values are cached until they are changed through the
+// store or, once Watch has been called, until a config file is changed by hand.
+func (s *ConfigStore) EnabledFor(identifier string, chatID int64) (enabled bool, ok bool) {
+	key := storeKey{identifier: identifier, chatID: chatID}
+
+	s.mu.RLock()
+	value, cached := s.enabled[key]
+	s.mu.RUnlock()
+
+	if !cached {
+		s.mu.Lock()
+
+		value, cached = s.enabled[key]
+		if !cached {
+			value = s.readEnabled(identifier, chatID)
+			s.enabled[key] = value
+		}
+
+		s.mu.Unlock()
+	}
+
+	if value == nil {
+		return false, false
+	}
+
+	return *value, true
+}
+
+// SetEnabled enables or disables the matcher in the given chat and persists the change.
+func (s *ConfigStore) SetEnabled(identifier string, chatID int64, enabled bool) error {
+	return s.Set(identifier, chatID, configKeyEnabled, enabled)
+}
+
+// Set sets the dotted, lowercase key in the matcher's config file for the given chat to value and writes the
+// file, creating it if necessary. A nil value removes the key, so the fallback value applies again.
+// Other keys and explicit nulls in the file are kept, but comments are lost.
+func (s *ConfigStore) Set(identifier string, chatID int64, key string, value any) error {
+	if !ConfigKeyPattern.MatchString(key) {
+		return fmt.Errorf("%w %q", ErrInvalidConfigKey, key)
+	}
+
+	s.mu.Lock()
+
+	err := s.write(identifier, chatID, key, value)
+	if err == nil {
+		delete(s.enabled, storeKey{identifier: identifier, chatID: chatID})
+	}
+
+	handlers := append([]func(string, int64){}, s.onChange...)
+
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	for _, handler := range handlers {
+		handler(identifier, chatID)
+	}
+
+	return nil
+}
+
+// readEnabled reads the "enabled" key of the matcher's config for the given chat: from the environment
+// variables for the chat or for all chats, or otherwise from the chat's file.
+func (s *ConfigStore) readEnabled(identifier string, chatID int64) *bool {
+	globalEnv, chatEnv := envLayers(s.options.envPrefix, identifier, s.options.knownIdentifiers())
+	for _, layers := range [][]configLayer{chatEnv[chatID], globalEnv} {
+		for _, layer := range slices.Backward(layers) {
+			if value := parseEnabled(layer.settings); value != nil {
+				return value
+			}
+		}
+	}
+
+	file, exists := s.chatConfigFile(identifier, chatID)
+	if !exists {
+		return nil
+	}
+
+	layer, err := readConfigLayer(s.options.fsys, file)
+	if err != nil {
+		return nil
+	}
+
+	return parseEnabled(layer.settings)
+}
+
+// Watch starts watching config/ and all config/{chatID}/ directories, including ones created later, and
+// drops the cached enabled states whenever a file in them changes, so that changes made by hand take
+// effect. Configs read from an fs.FS given with WithFS cannot be watched. Call Close to stop watching.
+func (s *ConfigStore) Watch() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.watcher != nil {
+		return errAlreadyWatching
+	}
+
+	watcher, err := watchConfigDirs(s.options)
+	if err != nil {
+		return err
+	}
+
+	s.watcher = watcher
+
+	go s.watch(watcher)
+
+	return nil
+}
+
+// Close stops watching the config files.
+func (s *ConfigStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.watcher == nil {
+		return nil
+	}
+
+	err := s.watcher.Close()
+	s.watcher = nil
+
+	return err
+}
+
+// watch drops the cached enabled states on every event of the given watcher until it is closed.
+func (s *ConfigStore) watch(watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			if _, err := watchCreatedDir(watcher, event); err != nil {
+				s.log.Error("Error while watching per-chat configs:", err)
+			}
+
+			s.mu.Lock()
+			clear(s.enabled)
+			s.mu.Unlock()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			s.log.Error("Error while watching per-chat configs:", err)
+		}
+	}
+}
+
+// parseEnabled returns the "enabled" key of the given settings, or nil if it is not set or invalid.
+func parseEnabled(settings map[string]any) *bool {
+	value, ok := settings[configKeyEnabled]
+	if !ok || value == nil {
+		return nil
+	}
+
+	enabled, err := strconv.ParseBool(fmt.Sprint(value))
+	if err != nil {
+		return nil
+	}
+
+	return &enabled
+}
+
+// write sets key to value in the matcher's config file for the given chat.
+func (s *ConfigStore) write(identifier string, chatID int64, key string, value any) error {
+	if s.options.dir == "" {
+		return errStoreReadOnly
+	}
+
+	file, exists := s.chatConfigFile(identifier, chatID)
+
+	settings := map[string]any{}
+
+	if exists {
+		if ext := path.Ext(file); ext != ".yml" && ext != ".yaml" {
+			return fmt.Errorf("%w: %s", errUnsupportedFormat, file)
+		}
+
+		layer, err := readConfigLayer(s.options.fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to read per-chat config %s: %w", file, err)
+		}
+
+		settings = layer.settings
+	}
+
+	setConfigKey(settings, strings.Split(key, "."), value)
+
+	content, err := yaml.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to encode per-chat config %s: %w", file, err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(s.options.dir, filepath.FromSlash(file)), content); err != nil {
+		return fmt.Errorf("failed to write per-chat config %s: %w", file, err)
+	}
+
+	return nil
+}
+
+// chatDir returns the directory of the per-chat config files of the given chat.
+func (s *ConfigStore) chatDir(chatID int64) string {
+	return path.Join(s.options.root, strconv.FormatInt(chatID, 10))
+}
+
+// chatConfigFile returns the matcher's config file for the given chat and whether it exists.
+func (s *ConfigStore) chatConfigFile(identifier string, chatID int64) (string, bool) {
+	return findConfigFile(s.options.fsys, s.chatDir(chatID), identifier)
+}
+
+// setConfigKey sets the nested key in settings to value, creating intermediate maps as needed.
+// A nil value removes the key.
+func setConfigKey(settings map[string]any, keys []string, value any) {
+	for _, k := range keys[:len(keys)-1] {
+		child, ok := settings[k].(map[string]any)
+		if !ok {
+			child = map[string]any{}
+			settings[k] = child
+		}
+
+		settings = child
+	}
+
+	if value == nil {
+		delete(settings, keys[len(keys)-1])
+
+		return
+	}
+
+	settings[keys[len(keys)-1]] = value
+}
+
+// writeFileAtomic writes content to a temporary file next to name and renames it to name, so that readers
+// never see a partially written file and a crash leaves either the old or the new content, creating the
+// directory if necessary.
+func writeFileAtomic(name string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(name))
+}
+
+// syncDir flushes the directory to disk, so that a rename or removal in it survives a crash. Windows
+// cannot sync directories, so it is a no-op there.
+func syncDir(name string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	dir, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	if err := dir.Sync(); err != nil {
+		_ = dir.Close()
+
+		return err
+	}
+
+	return dir.Close()
+}
@@ -0,0 +1,171 @@
+package matcher_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	"github.com/br0-space/bot-matcher/examples/ping"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConfigStore_Set verifies that Set keeps the other keys and explicit nulls of a per-chat file, that
+// the result is picked up by LoadMatcherConfig and that OnChange handlers are notified.
+func TestConfigStore_Set(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "config", "42"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config", "store.yml"), []byte("reply: fallback\ndescription: Says hi\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config", "42", "store.yml"), []byte("Enabled: true\ndescription: ~\n"), 0o600))
+
+	store := matcher.NewConfigStore(matcher.WithDir(dir))
+
+	var changes []int64
+
+	store.OnChange(func(identifier string, chatID int64) {
+		assert.Equal(t, "store", identifier)
+
+		changes = append(changes, chatID)
+	})
+
+	enabled, ok := store.EnabledFor("store", 42)
+	assert.True(t, ok)
+	assert.True(t, enabled)
+
+	require.NoError(t, store.Set("store", 42, "reply", "chat"))
+	require.NoError(t, store.Set("store", 42, "limits.user", 5))
+	require.NoError(t, store.SetEnabled("store", 42, false))
+	require.NoError(t, store.SetEnabled("store", 43, false))
+	require.ErrorContains(t, store.Set("store", 42, "Bad Key", "x"), "invalid config key")
+	assert.Equal(t, []int64{42, 42, 42, 43}, changes)
+
+	enabled, ok = store.EnabledFor("store", 42)
+	assert.True(t, ok)
+	assert.False(t, enabled)
+
+	_, ok = store.EnabledFor("store", 44)
+	assert.False(t, ok)
+
+	type target struct {
+		matcher.Config
+
+		Reply       string         `mapstructure:"reply"`
+		Description string         `mapstructure:"description"`
+		Limits      map[string]int `mapstructure:"limits"`
+	}
+
+	out, err := matcher.LoadMatcherConfig[target]("store", matcher.WithDir(dir), matcher.WithStrict())
+	require.NoError(t, err)
+	assert.Equal(t, "chat", out[42].Reply)
+	assert.Empty(t, out[42].Description) // the explicit null is kept
+	assert.Equal(t, map[string]int{"user": 5}, out[42].Limits)
+	assert.Equal(t, "Says hi", out[43].Description)
+}
+
+// TestConfigStore_ReadOnly verifies that per-chat files can only be changed on disk and in YAML.
+func TestConfigStore_ReadOnly(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{"config/1/store.yml": &fstest.MapFile{Data: []byte("enabled: false\n")}}
+
+	store := matcher.NewConfigStore(matcher.WithFS(fsys))
+	enabled, ok := store.EnabledFor("store", 1)
+	assert.True(t, ok)
+	assert.False(t, enabled)
+	require.Error(t, store.SetEnabled("store", 1, true))
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "config", "1"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config", "1", "store.json"), []byte(`{"enabled": true}`), 0o600))
+
+	require.ErrorContains(t, matcher.NewConfigStore(matcher.WithDir(dir)).SetEnabled("store", 1, false), "only YAML")
+}
+
+// TestRegistry_Process_HonorsConfigStore verifies that a matcher without config of its own is disabled
+// per chat through the ConfigStore.
+func TestRegistry_Process_HonorsConfigStore(t *testing.T) {
+	t.Parallel()
+
+	store := matcher.NewConfigStore(matcher.WithDir(t.TempDir()))
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithConfigStore(store))
+	reg.Register(ping.MakeMatcher())
+
+	msg := telegramclient.TestWebhookMessage("/ping")
+
+	require.NoError(t, store.SetEnabled("ping", msg.Chat.ID, false))
+	reg.Process(msg)
+	assert.Empty(t, client.sentTexts())
+	assert.Empty(t, reg.MatchersFor(msg.Chat.ID))
+	assert.Len(t, reg.Matchers(), 1)
+
+	require.NoError(t, store.SetEnabled("ping", msg.Chat.ID, true))
+	reg.Process(msg)
+	assert.Equal(t, []string{"pong"}, client.sentTexts())
+}
+
+// TestConfigStore_EnabledFor_PicksUpHandEdits verifies that files changed or created outside the store
+// replace cached values.
+func TestConfigStore_EnabledFor_PicksUpHandEdits(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "config"), 0o755))
+
+	store := matcher.NewConfigStore(matcher.WithDir(dir))
+	require.NoError(t, store.Watch())
+	require.ErrorContains(t, store.Watch(), "already watched")
+
+	t.Cleanup(func() { require.NoError(t, store.Close()) })
+
+	_, ok := store.EnabledFor("edited", 42)
+	assert.False(t, ok)
+
+	chatDir := filepath.Join(dir, "config", "42")
+	require.NoError(t, os.MkdirAll(chatDir, 0o755))
+
+	file := filepath.Join(chatDir, "edited.yml")
+	require.NoError(t, os.WriteFile(file, []byte("enabled: false\n"), 0o600))
+
+	assert.Eventually(t, func() bool {
+		enabled, ok := store.EnabledFor("edited", 42)
+
+		return ok && !enabled
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(file, []byte("enabled: true\n"), 0o600))
+
+	assert.Eventually(t, func() bool {
+		enabled, ok := store.EnabledFor("edited", 42)
+
+		return ok && enabled
+	}, time.Second, 10*time.Millisecond)
+}
+
+// TestConfigStore_EnabledFor_EnvOverrides verifies that environment variables take precedence over the
+// chat's file, as in LoadMatcherConfig.
+func TestConfigStore_EnabledFor_EnvOverrides(t *testing.T) { //nolint:paralleltest
+	fsys := fstest.MapFS{
+		"config/1/store-env.yml": &fstest.MapFile{Data: []byte("enabled: false\n")},
+		"config/2/store-env.yml": &fstest.MapFile{Data: []byte("enabled: false\n")},
+	}
+
+	t.Setenv("STOREBOT_STORE_ENV_ENABLED", "true")
+	t.Setenv("STOREBOT_2_STORE_ENV_ENABLED", "false")
+	t.Setenv("STOREBOT_3_STORE_ENV_ENABLED", "false")
+
+	store := matcher.NewConfigStore(matcher.WithFS(fsys), matcher.WithEnvPrefix("STOREBOT"))
+
+	for chatID, want := range map[int64]bool{1: true, 2: false, 3: false, 4: true} {
+		enabled, ok := store.EnabledFor("store-env", chatID)
+		assert.True(t, ok)
+		assert.Equal(t, want, enabled, "chat %d", chatID)
+	}
+}
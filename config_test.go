@@ -1,9 +1,11 @@
 package matcher_test
 
 import (
+	"io/fs"
 	"os"
 	"path/filepath"
 	"testing"
+	"testing/fstest"
 
 	matcher "github.com/br0-space/bot-matcher"
 	"github.com/stretchr/testify/assert"
@@ -134,3 +136,277 @@ func TestLoadMatcherConfig_WithPerChatConfigs(t *testing.T) { //nolint:parallelt
 	assert.Equal(t, target{Name: "Chat222", Age: 222}, out[222])
 	assert.Equal(t, target{Name: "Chat333", Age: 333}, out[333])
 }
+
+// TestLoadMatcherConfig_EmbeddedMatcherConfig verifies that the "enabled" key is applied to an
+// embedded matcher.Config for both the fallback and per-chat configs.
+func TestLoadMatcherConfig_EmbeddedMatcherConfig(t *testing.T) { //nolint:paralleltest
+	dir := t.TempDir()
+	cfgDir := filepath.Join(dir, "config")
+	chatDir := filepath.Join(cfgDir, "123456")
+	require.NoError(t, os.MkdirAll(chatDir, 0o755))
+
+	require.NoError(t, os.WriteFile(filepath.Join(cfgDir, "embedded.yml"), []byte("Enabled: true\nname: Default\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(chatDir, "embedded.yml"), []byte("Enabled: false\nname: Chat\n"), 0o600))
+
+	t.Chdir(dir)
+
+	type target struct {
+		matcher.Config
+
+		Name string `mapstructure:"name"`
+	}
+
+	out, err := matcher.LoadMatcherConfig[target]("embedded")
+	require.NoError(t, err)
+
+	fallback, chat := out[0], out[123456]
+
+	m := matcher.MakeMatcher("embedded", nil, nil).WithChatConfigs(map[int64]*matcher.Config{
+		0:      &fallback.Config,
+		123456: &chat.Config,
+	})
+
+	assert.True(t, m.IsEnabledFor(0))
+	assert.False(t, m.IsEnabledFor(123456))
+	assert.Equal(t, "Chat", chat.Name)
+}
+
+// TestLoadMatcherConfig_PerChatConfigsAreLayered verifies that per-chat configs only override the keys
+// they set: maps are merged, lists are replaced and explicit nulls reset the fallback value.
+func TestLoadMatcherConfig_PerChatConfigsAreLayered(t *testing.T) { //nolint:paralleltest
+	dir := t.TempDir()
+	cfgDir := filepath.Join(dir, "config")
+	chatDir := filepath.Join(cfgDir, "123")
+	require.NoError(t, os.MkdirAll(chatDir, 0o755))
+
+	fallback := []byte(`Enabled: false
+command: hello
+reply: world
+description: Says world
+tags: [a, b]
+limits:
+  user: 1
+  chat: 5
+`)
+	require.NoError(t, os.WriteFile(filepath.Join(cfgDir, "layered.yml"), fallback, 0o600))
+
+	chat := []byte(`enabled: true
+reply: chat reply
+description: ~
+tags: [c]
+limits:
+  chat: 10
+`)
+	require.NoError(t, os.WriteFile(filepath.Join(chatDir, "layered.yml"), chat, 0o600))
+
+	t.Chdir(dir)
+
+	type target struct {
+		matcher.Config
+
+		Command     string           `mapstructure:"command"`
+		Reply       string           `mapstructure:"reply"`
+		Description string           `mapstructure:"description"`
+		Tags        []string         `mapstructure:"tags"`
+		Limits      map[string]int64 `mapstructure:"limits"`
+	}
+
+	out, err := matcher.LoadMatcherConfig[target]("layered")
+	require.NoError(t, err)
+
+	base := out[0]
+	assert.Equal(t, "hello", base.Command)
+	assert.Equal(t, "world", base.Reply)
+	assert.Equal(t, "Says world", base.Description)
+	assert.Equal(t, []string{"a", "b"}, base.Tags)
+	assert.Equal(t, map[string]int64{"user": 1, "chat": 5}, base.Limits)
+
+	layered := out[123]
+	assert.Equal(t, "hello", layered.Command)                                // inherited
+	assert.Equal(t, "chat reply", layered.Reply)                             // overridden
+	assert.Empty(t, layered.Description)                                     // explicit null resets
+	assert.Equal(t, []string{"c"}, layered.Tags)                             // lists are replaced
+	assert.Equal(t, map[string]int64{"user": 1, "chat": 10}, layered.Limits) // maps are merged
+
+	m := matcher.MakeMatcher("layered", nil, nil).WithChatConfigs(map[int64]*matcher.Config{
+		0:   &base.Config,
+		123: &layered.Config,
+	})
+	assert.False(t, m.IsEnabledFor(0))
+	assert.True(t, m.IsEnabledFor(123))
+}
+
+// TestLoadMatcherConfig_WithFSAndRoot verifies that configs are read from the given file system and root,
+// without depending on the working directory.
+func TestLoadMatcherConfig_WithFSAndRoot(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"bot/settings/fs.yml":     &fstest.MapFile{Data: []byte("name: Default\nage: 1\n")},
+		"bot/settings/42/fs.yml":  &fstest.MapFile{Data: []byte("name: Chat\n")},
+		"bot/settings/abc/fs.yml": &fstest.MapFile{Data: []byte("name: Ignored\n")},
+		"config/fs.yml":           &fstest.MapFile{Data: []byte("name: Wrong root\n")},
+	}
+
+	type target struct {
+		Name string `mapstructure:"name"`
+		Age  int    `mapstructure:"age"`
+	}
+
+	out, err := matcher.LoadMatcherConfig[target]("fs", matcher.WithFS(fsys), matcher.WithRoot("bot/settings"))
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]target{
+		0:  {Name: "Default", Age: 1},
+		42: {Name: "Chat", Age: 1},
+	}, out)
+
+	out, err = matcher.LoadMatcherConfig[target]("fs", matcher.WithFS(fsys))
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]target{0: {Name: "Wrong root", Age: 0}}, out)
+
+	_, err = matcher.LoadMatcherConfig[target]("missing", matcher.WithFS(fsys))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+// TestLoadMatcherConfig_WithDir verifies that configs are read relative to the given directory.
+func TestLoadMatcherConfig_WithDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "config"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config", "dir.yml"), []byte("name: Dir\n"), 0o600))
+
+	type target struct {
+		Name string `mapstructure:"name"`
+	}
+
+	out, err := matcher.LoadMatcherConfig[target]("dir", matcher.WithDir(dir))
+	require.NoError(t, err)
+	assert.Equal(t, target{Name: "Dir"}, out[0])
+}
+
+// TestLoadMatcherConfig_Extensions verifies that JSON, TOML and YAML files are discovered and that .yml
+// takes precedence over .yaml, .json and .toml.
+func TestLoadMatcherConfig_Extensions(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"config/ext.json":    &fstest.MapFile{Data: []byte(`{"name": "JSON", "age": 1}`)},
+		"config/ext.toml":    &fstest.MapFile{Data: []byte("name = \"TOML\"\n")},
+		"config/1/ext.toml":  &fstest.MapFile{Data: []byte("name = \"Chat TOML\"\n")},
+		"config/2/ext.yaml":  &fstest.MapFile{Data: []byte("name: Chat YAML\n")},
+		"config/2/ext.json":  &fstest.MapFile{Data: []byte(`{"name": "Chat JSON"}`)},
+		"config/3/ext.yml":   &fstest.MapFile{Data: []byte("name: Chat YML\n")},
+		"config/3/ext.yaml":  &fstest.MapFile{Data: []byte("name: Chat YAML\n")},
+		"config/4/other.yml": &fstest.MapFile{Data: []byte("name: Other\n")},
+	}
+
+	type target struct {
+		Name string `mapstructure:"name"`
+		Age  int    `mapstructure:"age"`
+	}
+
+	out, err := matcher.LoadMatcherConfig[target]("ext", matcher.WithFS(fsys))
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]target{
+		0: {Name: "JSON", Age: 1},
+		1: {Name: "Chat TOML", Age: 1},
+		2: {Name: "Chat YAML", Age: 1},
+		3: {Name: "Chat YML", Age: 1},
+	}, out)
+}
+
+// TestLoadMatcherConfig_EnvOverrides verifies that environment variables override file values for all
+// chats and for single chats, in the documented order of precedence.
+func TestLoadMatcherConfig_EnvOverrides(t *testing.T) { //nolint:paralleltest
+	fsys := fstest.MapFS{
+		"config/env-test.yml":       &fstest.MapFile{Data: []byte("reply: file\ntoken: file\nlimits:\n  user: 1\n  chat: 2\n")},
+		"config/1/env-test.yml":     &fstest.MapFile{Data: []byte("reply: chat file\ntoken: chat file\n")},
+		"config/2/env-test.yml":     &fstest.MapFile{Data: []byte("reply: chat file\n")},
+		"config/other/env-test.yml": &fstest.MapFile{Data: []byte("reply: ignored\n")},
+	}
+
+	t.Setenv("TESTBOT_ENV_TEST_TOKEN", "secret")
+	t.Setenv("TESTBOT_ENV_TEST_LIMITS__USER", "10")
+	t.Setenv("TESTBOT_2_ENV_TEST_REPLY", "chat env")
+	t.Setenv("TESTBOT__100123_ENV_TEST_ENABLED", "false")
+	t.Setenv("TESTBOT_OTHER_REPLY", "ignored")
+
+	type target struct {
+		matcher.Config
+
+		Reply  string           `mapstructure:"reply"`
+		Token  string           `mapstructure:"token"`
+		Limits map[string]int64 `mapstructure:"limits"`
+	}
+
+	out, err := matcher.LoadMatcherConfig[target]("env-test", matcher.WithFS(fsys), matcher.WithEnvPrefix("TESTBOT"))
+	require.NoError(t, err)
+	require.Len(t, out, 4)
+
+	assert.Equal(t, "file", out[0].Reply)
+	assert.Equal(t, "secret", out[0].Token)
+	assert.Equal(t, map[string]int64{"user": 10, "chat": 2}, out[0].Limits)
+
+	assert.Equal(t, "chat file", out[1].Reply)
+	assert.Equal(t, "secret", out[1].Token) // global env variables override the per-chat file
+
+	assert.Equal(t, "chat env", out[2].Reply)
+	assert.Equal(t, "secret", out[2].Token)
+
+	group := out[-100123] // created by the environment variable alone
+	assert.Equal(t, "file", group.Reply)
+	assert.False(t, matcher.MakeMatcher("env-test", nil, nil).
+		WithChatConfigs(map[int64]*matcher.Config{-100123: &group.Config}).IsEnabledFor(-100123))
+
+	out, err = matcher.LoadMatcherConfig[target]("env-test", matcher.WithFS(fsys), matcher.WithEnvPrefix(""))
+	require.NoError(t, err)
+	assert.Equal(t, "file", out[0].Token)
+
+	t.Setenv("TESTBOT_ENV_TEST_TOKNE", "typo")
+
+	_, err = matcher.LoadMatcherConfig[target]("env-test", matcher.WithFS(fsys), matcher.WithEnvPrefix("TESTBOT"), matcher.WithStrict())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "$TESTBOT_ENV_TEST_TOKNE: key tokne: unknown key")
+}
+
+// TestLoadMatcherConfig_EnvLongestIdentifier verifies that environment variables matching several
+// identifiers only apply to the longest one.
+func TestLoadMatcherConfig_EnvLongestIdentifier(t *testing.T) { //nolint:paralleltest
+	fsys := fstest.MapFS{
+		"config/env-karma.yml":     &fstest.MapFile{Data: []byte("limit: 1\n")},
+		"config/env-karma-top.yml": &fstest.MapFile{Data: []byte("x: 1\n")},
+	}
+
+	t.Setenv("TESTBOT_ENV_KARMA_TOP_X", "2")
+	t.Setenv("TESTBOT_1_ENV_KARMA_TOP_X", "3")
+	t.Setenv("TESTBOT_ENV_KARMA_LIMIT", "4")
+
+	type karma struct {
+		Limit int `mapstructure:"limit"`
+	}
+
+	type top struct {
+		X int `mapstructure:"x"`
+	}
+
+	opts := []matcher.LoadOption{matcher.WithFS(fsys), matcher.WithEnvPrefix("TESTBOT"), matcher.WithStrict()}
+
+	karmaCfgs, err := matcher.LoadMatcherConfig[karma]("env-karma", opts...)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]karma{0: {Limit: 4}}, karmaCfgs)
+
+	topCfgs, err := matcher.LoadMatcherConfig[top]("env-karma-top", opts...)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]top{0: {X: 2}, 1: {X: 3}}, topCfgs)
+
+	// without a config file, the longer identifier has to be declared
+	t.Setenv("TESTBOT_ENV_KARMA_BOTTOM_X", "5")
+
+	_, err = matcher.LoadMatcherConfig[karma]("env-karma", opts...)
+	require.ErrorContains(t, err, "bottom_x")
+
+	karmaCfgs, err = matcher.LoadMatcherConfig[karma]("env-karma", append(opts, matcher.WithKnownIdentifiers("env-karma-bottom"))...)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]karma{0: {Limit: 4}}, karmaCfgs)
+}
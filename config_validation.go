@@ -0,0 +1,174 @@
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// errUnknownKey is wrapped by the ConfigError reported for keys not defined by the config type in strict mode.
+var errUnknownKey = errors.New("unknown key")
+
+// ConfigError is a problem found while loading a config file. LoadMatcherConfig returns all problems
+// across the fallback and per-chat files joined, see errors.Join.
+type ConfigError struct {
+	// Path is the config file the problem was found in.
+	Path string
+	// Key is the dotted, lowercased config key the problem relates to, or empty if it relates to the file.
+	Key string
+	// Err describes the problem.
+	Err error
+}
+
+// Error returns the problem prefixed with the file path and key.
+func (e *ConfigError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("%s: %s", e.Path, e.Err)
+	}
+
+	return fmt.Sprintf("%s: key %s: %s", e.Path, e.Key, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ValidatorInterface is an optional interface for config types. If T implements it, LoadMatcherConfig
+// calls Validate on the fallback config and every per-chat config after decoding them.
+// Validate may return a *ConfigError with an empty Path, or several joined, to name the offending keys;
+// the path of the validated file is filled in by the loader.
+type ValidatorInterface interface {
+	Validate() error
+}
+
+// WithStrict reports keys in config files that do not correspond to a field of the config type, like typos
+// such as "replly", as errors. Keys are matched case-insensitively against the mapstructure tags or field
+// names. Maps and fields of type any accept arbitrary keys.
+func WithStrict() LoadOption {
+	return func(o *loadOptions) {
+		o.strict = true
+	}
+}
+
+// validateConfig calls Validate if cfg implements ValidatorInterface and returns its problems as
+// ConfigErrors for the file at path.
+func validateConfig(path string, cfg any) []error {
+	validator, ok := cfg.(ValidatorInterface)
+	if !ok {
+		return nil
+	}
+
+	err := validator.Validate()
+	if err == nil {
+		return nil
+	}
+
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok { //nolint:errorlint
+		errs = joined.Unwrap()
+	}
+
+	configErrs := make([]error, 0, len(errs))
+
+	for _, err := range errs {
+		var configErr *ConfigError
+		if errors.As(err, &configErr) {
+			configErrs = append(configErrs, &ConfigError{Path: path, Key: configErr.Key, Err: configErr.Err})
+		} else {
+			configErrs = append(configErrs, &ConfigError{Path: path, Key: "", Err: err})
+		}
+	}
+
+	return configErrs
+}
+
+// unknownKeys returns a ConfigError for every key in settings that does not correspond to a field of t.
+func unknownKeys(path string, settings map[string]any, t reflect.Type) []error {
+	var errs []error
+
+	for _, key := range collectUnknownKeys(settings, t, "") {
+		errs = append(errs, &ConfigError{Path: path, Key: key, Err: errUnknownKey})
+	}
+
+	return errs
+}
+
+// collectUnknownKeys returns the sorted, dotted keys in settings that do not correspond to a field of t.
+func collectUnknownKeys(settings map[string]any, t reflect.Type, prefix string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		// maps, interfaces and other types accept arbitrary keys
+		return nil
+	}
+
+	fields := configFields(t)
+
+	var unknown []string
+
+	for key, value := range settings {
+		fieldType, ok := fields[key]
+		if !ok {
+			unknown = append(unknown, prefix+key)
+
+			continue
+		}
+
+		if nested, ok := value.(map[string]any); ok {
+			unknown = append(unknown, collectUnknownKeys(nested, fieldType, prefix+key+".")...)
+		}
+	}
+
+	slices.Sort(unknown)
+
+	return unknown
+}
+
+// configFields returns the lowercased config keys of the struct type t and their field types, following
+// the naming rules of mapstructure. Squashed structs contribute their fields, and an embedded matcher.Config
+// contributes the "enabled", "cooldowns" and "permissions" keys.
+func configFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+
+		if field.Anonymous && field.Type == reflect.TypeFor[Config]() {
+			fields[configKeyEnabled] = reflect.TypeFor[bool]()
+			fields[configKeyCooldowns] = reflect.TypeFor[cooldownsConfig]()
+			fields[configKeyPermissions] = reflect.TypeFor[permissionsConfig]()
+
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if strings.Contains(options, "squash") && field.Type.Kind() == reflect.Struct {
+			for key, fieldType := range configFields(field.Type) {
+				fields[key] = fieldType
+			}
+
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		fields[strings.ToLower(name)] = field.Type
+	}
+
+	return fields
+}
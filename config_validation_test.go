@@ -0,0 +1,128 @@
+package matcher_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	matcher "github.com/br0-space/bot-matcher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validatedCfg is a config type implementing matcher.ValidatorInterface.
+type validatedCfg struct {
+	matcher.Config
+
+	Reply  string `mapstructure:"reply"`
+	Limits struct {
+		User int `mapstructure:"user"`
+	} `mapstructure:"limits"`
+	Labels map[string]string `mapstructure:"labels"`
+}
+
+// Validate requires a reply and a non-negative user limit.
+func (c validatedCfg) Validate() error {
+	var errs []error
+
+	if c.Reply == "" {
+		errs = append(errs, &matcher.ConfigError{Path: "", Key: "reply", Err: errors.New("must not be empty")})
+	}
+
+	if c.Limits.User < 0 {
+		errs = append(errs, fmt.Errorf("negative user limit %d", c.Limits.User))
+	}
+
+	return errors.Join(errs...)
+}
+
+// configFS returns an in-memory file system containing the given files within its config/ directory.
+func configFS(files map[string]string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for name, content := range files {
+		fsys["config/"+name] = &fstest.MapFile{Data: []byte(content)}
+	}
+
+	return fsys
+}
+
+// configErrors returns the ConfigErrors joined in err as "path: key" strings.
+func configErrors(t *testing.T, err error) []string {
+	t.Helper()
+
+	joined, ok := err.(interface{ Unwrap() []error }) //nolint:errorlint
+	require.True(t, ok, "expected joined errors, got %v", err)
+
+	var out []string
+
+	for _, err := range joined.Unwrap() {
+		var configErr *matcher.ConfigError
+		require.ErrorAs(t, err, &configErr)
+
+		out = append(out, configErr.Path+": "+configErr.Key)
+	}
+
+	return out
+}
+
+// TestLoadMatcherConfig_StrictReportsUnknownKeys verifies that unknown keys in all files are reported with
+// their file path and dotted key, while maps accept arbitrary keys.
+func TestLoadMatcherConfig_StrictReportsUnknownKeys(t *testing.T) {
+	t.Parallel()
+
+	fsys := configFS(map[string]string{
+		"strict.yml":     "Enabled: true\nreplly: typo\nreply: ok\nlabels:\n  anything: goes\n",
+		"42/strict.yml":  "limits:\n  user: 1\n  chat: 2\n",
+		"43/strict.yml":  "reply: fine\n",
+		"abc/strict.yml": "ignored: true\n",
+	})
+
+	_, err := matcher.LoadMatcherConfig[validatedCfg]("strict", matcher.WithFS(fsys))
+	require.NoError(t, err, "unknown keys are ignored unless strict")
+
+	_, err = matcher.LoadMatcherConfig[validatedCfg]("strict", matcher.WithFS(fsys), matcher.WithStrict())
+	require.Error(t, err)
+	assert.Equal(t, []string{
+		"config/strict.yml" + ": replly",
+		"config/42/strict.yml" + ": limits.chat",
+	}, configErrors(t, err))
+	assert.Contains(t, err.Error(), "config/strict.yml: key replly: unknown key")
+}
+
+// TestLoadMatcherConfig_ValidationErrorsAreAggregated verifies that validation problems of all files are
+// collected, and that problems inherited from the fallback are reported only once.
+func TestLoadMatcherConfig_ValidationErrorsAreAggregated(t *testing.T) {
+	t.Parallel()
+
+	fsys := configFS(map[string]string{
+		"validated.yml":    "reply: ok\nlimits:\n  user: -1\n",
+		"1/validated.yml":  "reply: ~\n",
+		"2/validated.yml":  "reply: chat\n",
+		"3/validated.yml":  "reply: [unclosed\n",
+		"4/validated.yml":  "limits:\n  user: 5\n",
+		"5/validated.yml":  "limits:\n  user: not a number\n",
+		"6/validated.yml":  "reply: \"\"\n",
+		"7/validated.yml":  "limits:\n  user: -2\n",
+		"8/validated.yml":  "reply: fine\n",
+		"9/validated.yml":  "reply: fine\n",
+		"10/validated.yml": "reply: fine\n",
+	})
+
+	out, err := matcher.LoadMatcherConfig[validatedCfg]("validated", matcher.WithFS(fsys))
+	require.Error(t, err)
+	assert.Nil(t, out)
+
+	assert.ElementsMatch(t, []string{
+		"config/validated.yml" + ": ", // negative user limit, not repeated for chats 1, 2, 6, 8-10
+		"config/1/validated.yml" + ": reply",
+		"config/3/validated.yml" + ": ",
+		"config/5/validated.yml" + ": ",
+		"config/6/validated.yml" + ": reply",
+		"config/7/validated.yml" + ": ",
+	}, configErrors(t, err))
+	assert.Contains(t, err.Error(), "negative user limit -1")
+	assert.Contains(t, err.Error(), "negative user limit -2")
+	assert.Contains(t, err.Error(), "failed to read per-chat config")
+	assert.Contains(t, err.Error(), "failed to unmarshal per-chat config")
+}
@@ -0,0 +1,138 @@
+package matcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	telegramclient "github.com/br0-space/bot-telegramclient"
+)
+
+// contextAdapter implements ContextInterface for matchers that only implement Process.
+type contextAdapter struct {
+	Interface
+}
+
+// AdaptContext returns m as a ContextInterface. If m implements ProcessContext itself, it is returned as-is.
+// Otherwise, the returned matcher runs Process in a separate goroutine and returns ctx.Err() as soon as ctx
+// is done, without waiting for Process to finish. The result of such an abandoned Process call is discarded.
+// A panic in Process is returned as *PanicError, as it could not be recovered by the caller's goroutine.
+// On the worker pool, abandoned calls keep occupying their worker until they return, see WithWorkerPool.
+func AdaptContext(m Interface) ContextInterface {
+	if cm, ok := m.(ContextInterface); ok {
+		return cm
+	}
+
+	return contextAdapter{Interface: m}
+}
+
+// ProcessContext runs Process and waits for it to return or for ctx to be done, whichever happens first.
+func (a contextAdapter) ProcessContext(
+	ctx context.Context,
+	messageIn telegramclient.WebhookMessageStruct,
+) ([]telegramclient.MessageStruct, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return awaitCall(ctx, func() ([]telegramclient.MessageStruct, error) {
+		return a.Process(messageIn)
+	})
+}
+
+// awaitCall runs fn in a separate goroutine and waits for it to return or for ctx to be done, whichever
+// happens first, in which case it returns ctx.Err() and discards the result of fn. A panic in fn is returned
+// as *PanicError. Calls are tracked by the *sync.WaitGroup stored under pendingCallsKey, if any, until fn
+// returns, see Registry.dispatch.
+func awaitCall[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+
+	done := make(chan result, 1)
+
+	calls, _ := ctx.Value(pendingCallsKey{}).(*sync.WaitGroup)
+	if calls != nil {
+		calls.Add(1)
+	}
+
+	go func() {
+		var res result
+
+		if calls != nil {
+			defer calls.Done()
+		}
+
+		defer func() { done <- res }()
+		defer recoverPanic(&res.err)
+
+		res.value, res.err = fn()
+	}()
+
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-ctx.Done():
+		var zero T
+
+		return zero, ctx.Err()
+	}
+}
+
+// callMatcher calls fn with a context bounded by the timeout of the matcher with the given identifier, see
+// awaitCall. It is shared by everything the Registry calls on behalf of a matcher: Process, dialog steps,
+// callback and inline queries. A call that does not return before the context is done is abandoned and
+// reported with an error wrapping errDeadline, as is an error returned because the context was done.
+func callMatcher[T any](
+	ctx context.Context,
+	r *Registry,
+	identifier string,
+	fn func(ctx context.Context) (T, error),
+) (T, error) {
+	ctx, cancel := r.matcherContext(ctx, identifier)
+	defer cancel()
+
+	value, err := awaitCall(ctx, func() (T, error) { return fn(ctx) })
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return value, fmt.Errorf("%w: %w", errDeadline, err)
+	}
+
+	return value, err
+}
+
+// WithDefaultTimeout sets the deadline applied to every matcher's Process call.
+// A timeout of zero (the default) means matchers can run indefinitely.
+func WithDefaultTimeout(timeout time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.defaultTimeout = timeout
+	}
+}
+
+// WithMatcherTimeout sets the deadline for the matcher with the given identifier,
+// overriding the default timeout. A timeout of zero disables the deadline for this matcher.
+func WithMatcherTimeout(identifier string, timeout time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.timeouts[identifier] = timeout
+	}
+}
+
+// timeoutFor returns the deadline configured for the matcher with the given identifier.
+func (r *Registry) timeoutFor(identifier string) time.Duration {
+	if timeout, ok := r.timeouts[identifier]; ok {
+		return timeout
+	}
+
+	return r.defaultTimeout
+}
+
+// matcherContext derives the context passed to a matcher from ctx, applying its configured timeout.
+func (r *Registry) matcherContext(ctx context.Context, identifier string) (context.Context, context.CancelFunc) {
+	if timeout := r.timeoutFor(identifier); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+
+	return context.WithCancel(ctx)
+}
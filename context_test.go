@@ -0,0 +1,169 @@
+package matcher_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingMatcher is a test matcher whose Process blocks until release is closed.
+// It records all errors passed to HandleError.
+type blockingMatcher struct {
+	matcher.Matcher
+	*errorRecorder
+
+	release chan struct{}
+}
+
+// makeBlockingMatcher returns a blockingMatcher matching every message. Process is released on test cleanup.
+func makeBlockingMatcher(t *testing.T, identifier string) blockingMatcher {
+	t.Helper()
+
+	m := blockingMatcher{
+		Matcher:       matcher.MakeMatcher(identifier, regexp.MustCompile(`.`), nil),
+		errorRecorder: &errorRecorder{},
+		release:       make(chan struct{}),
+	}
+	t.Cleanup(func() { close(m.release) })
+
+	return m
+}
+
+// Process blocks until the matcher is released.
+func (m blockingMatcher) Process(messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+	<-m.release
+
+	return []telegramclient.MessageStruct{telegramclient.Reply("too late", messageIn.ID)}, nil
+}
+
+// HandleError records the error.
+func (m blockingMatcher) HandleError(messageIn telegramclient.WebhookMessageStruct, identifier string, err error) {
+	m.errorRecorder.HandleError(messageIn, identifier, err)
+}
+
+// contextMatcher is a test matcher implementing ProcessContext that waits for its context to be done.
+type contextMatcher struct {
+	matcher.Matcher
+
+	ctxErr chan error
+}
+
+// Process is never called by the Registry because ProcessContext is implemented.
+func (m contextMatcher) Process(_ telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+	panic("Process must not be called")
+}
+
+// ProcessContext waits for ctx to be done and reports its error.
+func (m contextMatcher) ProcessContext(ctx context.Context, _ telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+	<-ctx.Done()
+	m.ctxErr <- ctx.Err()
+
+	return nil, ctx.Err()
+}
+
+// TestAdaptContext_ReturnsProcessResult verifies that adapted matchers return the result of Process.
+func TestAdaptContext_ReturnsProcessResult(t *testing.T) {
+	t.Parallel()
+
+	msg := telegramclient.TestWebhookMessage("hello")
+
+	out, err := matcher.AdaptContext(makeEchoMatcher("echo")).ProcessContext(context.Background(), msg)
+	require.NoError(t, err)
+	require.Len(t, out, 1)
+	assert.Equal(t, "hello", out[0].Text)
+}
+
+// TestAdaptContext_ReturnsOnCancellation verifies that adapted matchers return as soon as the context is done.
+func TestAdaptContext_ReturnsOnCancellation(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	out, err := matcher.AdaptContext(makeBlockingMatcher(t, "slow")).ProcessContext(ctx, telegramclient.TestWebhookMessage("x"))
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, out)
+}
+
+// TestAdaptContext_KeepsContextMatchers verifies that matchers implementing ProcessContext are not wrapped.
+func TestAdaptContext_KeepsContextMatchers(t *testing.T) {
+	t.Parallel()
+
+	m := contextMatcher{Matcher: matcher.MakeMatcher("ctx", regexp.MustCompile(`.`), nil), ctxErr: make(chan error, 1)}
+
+	assert.Equal(t, m, matcher.AdaptContext(m))
+}
+
+// TestRegistry_Process_DefaultTimeout verifies that a slow matcher does not stall the registry, is reported
+// through HandleError and results in an error reply, while other matchers still reply.
+func TestRegistry_Process_DefaultTimeout(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithDefaultTimeout(20*time.Millisecond))
+
+	slow := makeBlockingMatcher(t, "slow")
+	reg.Register(slow)
+	reg.Register(makeEchoMatcher("echo"))
+
+	start := time.Now()
+
+	reg.Process(telegramclient.TestWebhookMessage("hello"))
+
+	assert.Less(t, time.Since(start), time.Second)
+
+	errs := slow.handledErrors()
+	require.Len(t, errs, 1)
+	require.ErrorIs(t, errs[0], context.DeadlineExceeded)
+
+	texts := client.sentTexts()
+	assert.Len(t, texts, 2)
+	assert.Contains(t, texts, "hello")
+}
+
+// TestRegistry_Process_MatcherTimeoutOverridesDefault verifies per-matcher timeouts and that the
+// deadline is propagated into context-aware matchers.
+func TestRegistry_Process_MatcherTimeoutOverridesDefault(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(
+		logger.New(),
+		client,
+		matcher.WithDefaultTimeout(time.Hour),
+		matcher.WithMatcherTimeout("ctx", 10*time.Millisecond),
+	)
+
+	m := contextMatcher{Matcher: matcher.MakeMatcher("ctx", regexp.MustCompile(`.`), nil), ctxErr: make(chan error, 1)}
+	reg.Register(m)
+
+	reg.Process(telegramclient.TestWebhookMessage("hello"))
+
+	require.ErrorIs(t, <-m.ctxErr, context.DeadlineExceeded)
+	assert.Len(t, client.sentTexts(), 1) // error reply
+}
+
+// TestRegistry_ProcessContext_PropagatesCancellation verifies that cancelling the caller's context
+// cancels the contexts passed to matchers.
+func TestRegistry_ProcessContext_PropagatesCancellation(t *testing.T) {
+	t.Parallel()
+
+	reg := matcher.NewRegistry(logger.New(), &fakeTelegramClient{})
+
+	m := contextMatcher{Matcher: matcher.MakeMatcher("ctx", regexp.MustCompile(`.`), nil), ctxErr: make(chan error, 1)}
+	reg.Register(m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	reg.ProcessContext(ctx, telegramclient.TestWebhookMessage("hello"))
+
+	require.ErrorIs(t, <-m.ctxErr, context.Canceled)
+}
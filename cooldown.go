@@ -0,0 +1,238 @@
+package matcher
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	telegramclient "github.com/br0-space/bot-telegramclient"
+)
+
+// configKeyCooldowns is the config key overriding the cooldowns of a matcher.
+const configKeyCooldowns = "cooldowns"
+
+// cooldownSweepInterval is how often the windows of all cooldowns are checked for expiry, see
+// cooldownTracker.sweep.
+const cooldownSweepInterval = time.Minute
+
+// Cooldown allows up to Limit executions of a matcher per Interval. The zero value means no cooldown.
+type Cooldown struct {
+	// Limit is the number of executions allowed per Interval.
+	Limit int `mapstructure:"limit"`
+	// Interval is the sliding window the Limit applies to.
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// disabled reports whether the cooldown is not in effect.
+func (c Cooldown) disabled() bool {
+	return c.Limit <= 0 || c.Interval <= 0
+}
+
+// Cooldowns throttle how often a matcher is executed, e.g. to keep spammy users from flooding a group.
+// The Registry enforces them before calling Process. Once a cooldown is exceeded, the matcher is skipped
+// until the window frees up, replying with Reply once per window or silently if Reply is empty.
+type Cooldowns struct {
+	// PerUser limits the executions triggered by a single user in a chat.
+	PerUser Cooldown
+	// PerChat limits the executions in a chat, regardless of the user.
+	PerChat Cooldown
+	// Reply is the plain text reply sent when a message is throttled. If empty, it is dropped silently.
+	Reply string
+}
+
+// cooldownsConfig is the "cooldowns" key of a matcher config. Keys that are not set keep the cooldowns
+// the matcher was made with, see Matcher.WithCooldowns.
+type cooldownsConfig struct {
+	PerUser *Cooldown `mapstructure:"per_user"`
+	PerChat *Cooldown `mapstructure:"per_chat"`
+	Reply   *string   `mapstructure:"reply"`
+}
+
+// apply returns the cooldowns with the configured values applied.
+func (c *cooldownsConfig) apply(cooldowns Cooldowns) Cooldowns {
+	if c == nil {
+		return cooldowns
+	}
+
+	if c.PerUser != nil {
+		cooldowns.PerUser = *c.PerUser
+	}
+
+	if c.PerChat != nil {
+		cooldowns.PerChat = *c.PerChat
+	}
+
+	if c.Reply != nil {
+		cooldowns.Reply = *c.Reply
+	}
+
+	return cooldowns
+}
+
+// CooldownInterface is an optional extension of Interface for matchers with cooldowns. The Registry
+// enforces the cooldowns returned for the chat of every message before executing the matcher.
+// The base Matcher implements it, see Matcher.WithCooldowns.
+type CooldownInterface interface {
+	CooldownsFor(chatID int64) Cooldowns
+}
+
+// WithCooldowns returns a copy of the Matcher with the given cooldowns, e.g. once per 30s per user and
+// 5 times per minute per chat:
+//
+//	m.WithCooldowns(matcher.Cooldowns{
+//		PerUser: matcher.Cooldown{Limit: 1, Interval: 30 * time.Second},
+//		PerChat: matcher.Cooldown{Limit: 5, Interval: time.Minute},
+//		Reply:   "Slow down, please.",
+//	})
+//
+// The "cooldowns" key of the matcher's config overrides them, see CooldownsFor.
+func (m Matcher) WithCooldowns(cooldowns Cooldowns) Matcher {
+	m.cooldowns = cooldowns
+
+	return m
+}
+
+// CooldownsFor returns the cooldowns in the given chat: the cooldowns the matcher was made with, overridden
+// by the "per_user", "per_chat" and "reply" keys below "cooldowns" in the chat's config, if set.
+func (m Matcher) CooldownsFor(chatID int64) Cooldowns {
+	return m.ConfigFor(chatID).cooldowns.apply(m.cooldowns)
+}
+
+// cooldownKey identifies the executions of a matcher counted against a cooldown. The user ID is zero for
+// per-chat cooldowns.
+type cooldownKey struct {
+	identifier string
+	chatID     int64
+	userID     int64
+}
+
+// cooldownWindow holds the recent executions counted against a cooldown, when the last of them drops out
+// of the window and whether the user has been told about the cooldown since it was exceeded.
+type cooldownWindow struct {
+	hits     []time.Time
+	expires  time.Time
+	notified bool
+}
+
+// cooldownTracker enforces the cooldowns of all matchers of a Registry.
+type cooldownTracker struct {
+	mu        sync.Mutex
+	windows   map[cooldownKey]*cooldownWindow
+	nextSweep time.Time
+}
+
+// newCooldownTracker returns an empty cooldownTracker.
+func newCooldownTracker() *cooldownTracker {
+	return &cooldownTracker{mu: sync.Mutex{}, windows: map[cooldownKey]*cooldownWindow{}, nextSweep: time.Time{}}
+}
+
+// check reports whether the matcher may be executed for the message at the given time and counts the
+// execution if so. If it may not, notify reports whether the cooldown reply is due, i.e. whether this is
+// the first throttled message since the cooldown was exceeded.
+func (t *cooldownTracker) check(
+	m Interface,
+	messageIn telegramclient.WebhookMessageStruct,
+	now time.Time,
+) (allowed bool, notify bool) {
+	cm, ok := as[CooldownInterface](m)
+	if !ok {
+		return true, false
+	}
+
+	cooldowns := cm.CooldownsFor(messageIn.Chat.ID)
+
+	type limited struct {
+		window   *cooldownWindow
+		cooldown Cooldown
+	}
+
+	var checks []limited
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep(now)
+
+	if !cooldowns.PerUser.disabled() {
+		key := cooldownKey{identifier: m.Identifier(), chatID: messageIn.Chat.ID, userID: messageIn.From.ID}
+		checks = append(checks, limited{window: t.window(key), cooldown: cooldowns.PerUser})
+	}
+
+	if !cooldowns.PerChat.disabled() {
+		key := cooldownKey{identifier: m.Identifier(), chatID: messageIn.Chat.ID, userID: 0}
+		checks = append(checks, limited{window: t.window(key), cooldown: cooldowns.PerChat})
+	}
+
+	allowed = true
+
+	for _, c := range checks {
+		c.window.hits = slices.DeleteFunc(c.window.hits, func(hit time.Time) bool {
+			return !hit.After(now.Add(-c.cooldown.Interval))
+		})
+
+		if len(c.window.hits) >= c.cooldown.Limit {
+			allowed = false
+		}
+	}
+
+	if allowed {
+		for _, c := range checks {
+			c.window.hits = append(c.window.hits, now)
+			c.window.expires = now.Add(c.cooldown.Interval)
+			c.window.notified = false
+		}
+
+		return true, false
+	}
+
+	notify = cooldowns.Reply != ""
+
+	for _, c := range checks {
+		if len(c.window.hits) >= c.cooldown.Limit {
+			notify = notify && !c.window.notified
+			c.window.notified = true
+		}
+	}
+
+	return false, notify
+}
+
+// window returns the window of the given key, creating an empty one if necessary.
+func (t *cooldownTracker) window(key cooldownKey) *cooldownWindow {
+	w, ok := t.windows[key]
+	if !ok {
+		w = &cooldownWindow{hits: nil, expires: time.Time{}, notified: false}
+		t.windows[key] = w
+	}
+
+	return w
+}
+
+// sweep removes the windows whose executions have all dropped out, at most once per
+// cooldownSweepInterval. A removed window is recreated empty on the next message, so sweeping does not
+// change which executions are allowed. It must be called with t.mu held.
+func (t *cooldownTracker) sweep(now time.Time) {
+	if now.Before(t.nextSweep) {
+		return
+	}
+
+	t.nextSweep = now.Add(cooldownSweepInterval)
+
+	for key, w := range t.windows {
+		if !now.Before(w.expires) {
+			delete(t.windows, key)
+		}
+	}
+}
+
+// cooldownReply returns the cooldown reply of the matcher for the message.
+func cooldownReply(m Interface, messageIn telegramclient.WebhookMessageStruct) []telegramclient.MessageStruct {
+	cm, ok := as[CooldownInterface](m)
+	if !ok {
+		return nil
+	}
+
+	return []telegramclient.MessageStruct{
+		telegramclient.Reply(cm.CooldownsFor(messageIn.Chat.ID).Reply, messageIn.ID),
+	}
+}
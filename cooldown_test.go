@@ -0,0 +1,170 @@
+package matcher_test
+
+import (
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// messageFrom returns a test message sent by the given user to the given chat.
+func messageFrom(chatID int64, userID int64) telegramclient.WebhookMessageStruct {
+	msg := messageTo(chatID)
+	msg.From.ID = userID
+
+	return msg
+}
+
+// newCooldownRegistry returns a registry with a fake clock and an echo matcher with the given cooldowns.
+func newCooldownRegistry(cooldowns matcher.Cooldowns, opts ...matcher.RegisterOption) (*matcher.Registry, *fakeTelegramClient, *fakeClock) {
+	client := &fakeTelegramClient{}
+	clock := &fakeClock{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithClock(clock))
+
+	m := makeEchoMatcher("echo")
+	m.Matcher = m.WithCooldowns(cooldowns)
+	reg.Register(m, opts...)
+
+	return reg, client, clock
+}
+
+// TestRegistry_Process_PerUserCooldown verifies that a user exceeding the cooldown is told once and then
+// ignored until the window frees up, without affecting other users.
+func TestRegistry_Process_PerUserCooldown(t *testing.T) {
+	t.Parallel()
+
+	reg, client, clock := newCooldownRegistry(matcher.Cooldowns{
+		PerUser: matcher.Cooldown{Limit: 1, Interval: 30 * time.Second},
+		PerChat: matcher.Cooldown{},
+		Reply:   "Slow down",
+	})
+
+	reg.Process(messageFrom(1, 10))
+	reg.Process(messageFrom(1, 10))
+	reg.Process(messageFrom(1, 10))
+	reg.Process(messageFrom(1, 11))
+	reg.Process(messageFrom(2, 10))
+	assert.Equal(t, []string{"hello", "Slow down", "hello", "hello"}, client.sentTexts())
+
+	clock.After(30 * time.Second)
+
+	reg.Process(messageFrom(1, 10))
+	reg.Process(messageFrom(1, 10))
+	assert.Equal(t, []string{"hello", "Slow down", "hello", "hello", "hello", "Slow down"}, client.sentTexts())
+}
+
+// TestRegistry_Process_PerChatCooldown verifies that a chat cooldown applies across users and drops
+// throttled messages silently without a reply.
+func TestRegistry_Process_PerChatCooldown(t *testing.T) {
+	t.Parallel()
+
+	reg, client, clock := newCooldownRegistry(matcher.Cooldowns{
+		PerUser: matcher.Cooldown{},
+		PerChat: matcher.Cooldown{Limit: 2, Interval: time.Minute},
+		Reply:   "",
+	})
+
+	for userID := range int64(4) {
+		reg.Process(messageFrom(1, userID))
+	}
+
+	assert.Len(t, client.sentTexts(), 2)
+
+	clock.After(59 * time.Second)
+	reg.Process(messageFrom(1, 5))
+	assert.Len(t, client.sentTexts(), 2)
+
+	clock.After(time.Second)
+	reg.Process(messageFrom(1, 5))
+	assert.Len(t, client.sentTexts(), 3)
+}
+
+// TestRegistry_Process_CooldownKeepsClaim verifies that a throttled exclusive matcher still claims the message.
+func TestRegistry_Process_CooldownKeepsClaim(t *testing.T) {
+	t.Parallel()
+
+	reg, client, _ := newCooldownRegistry(
+		matcher.Cooldowns{PerUser: matcher.Cooldown{Limit: 1, Interval: time.Minute}, PerChat: matcher.Cooldown{}, Reply: ""},
+		matcher.WithPriority(10),
+		matcher.WithExclusive(),
+	)
+	reg.Register(makeIdentifierMatcher("low", `.`))
+
+	reg.Process(messageTo(1))
+	reg.Process(messageTo(1))
+
+	assert.Equal(t, []string{"hello"}, client.sentTexts())
+}
+
+// TestRegistry_Process_CooldownSweep verifies that removing expired windows keeps the windows that are
+// still in effect.
+func TestRegistry_Process_CooldownSweep(t *testing.T) {
+	t.Parallel()
+
+	reg, client, clock := newCooldownRegistry(matcher.Cooldowns{
+		PerUser: matcher.Cooldown{Limit: 1, Interval: time.Hour},
+		PerChat: matcher.Cooldown{},
+		Reply:   "",
+	})
+
+	reg.Process(messageFrom(1, 10))
+	reg.Process(messageFrom(1, 10))
+
+	clock.After(2 * time.Minute)
+
+	reg.Process(messageFrom(1, 11))
+	reg.Process(messageFrom(1, 10))
+	assert.Equal(t, []string{"hello", "hello"}, client.sentTexts())
+
+	clock.After(time.Hour)
+
+	reg.Process(messageFrom(1, 10))
+	assert.Equal(t, []string{"hello", "hello", "hello"}, client.sentTexts())
+}
+
+// TestMatcher_CooldownsFor verifies that the "cooldowns" key of the config overrides the cooldowns the
+// matcher was made with, key by key and per chat.
+func TestMatcher_CooldownsFor(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"config/cool.yml": &fstest.MapFile{Data: []byte("cooldowns:\n  reply: Wait a bit\n")},
+		"config/1/cool.yml": &fstest.MapFile{Data: []byte(
+			"cooldowns:\n  per_user:\n    limit: 2\n    interval: 1m\n  per_chat:\n    limit: 0\n",
+		)},
+	}
+
+	cfgs, err := matcher.LoadMatcherConfig[reloadCfg]("cool", matcher.WithFS(fsys), matcher.WithStrict())
+	require.NoError(t, err)
+
+	defaults := matcher.Cooldowns{
+		PerUser: matcher.Cooldown{Limit: 1, Interval: 30 * time.Second},
+		PerChat: matcher.Cooldown{Limit: 5, Interval: time.Minute},
+		Reply:   "",
+	}
+
+	m := matcher.MakeMatcherWithCustomConfigType("cool", regexp.MustCompile(`.`), nil, reloadCfg{}).WithTypedConfigs(cfgs)
+	m.Matcher = m.WithCooldowns(defaults)
+
+	assert.Equal(t, matcher.Cooldowns{
+		PerUser: defaults.PerUser,
+		PerChat: defaults.PerChat,
+		Reply:   "Wait a bit",
+	}, m.CooldownsFor(2))
+	assert.Equal(t, matcher.Cooldowns{
+		PerUser: matcher.Cooldown{Limit: 2, Interval: time.Minute},
+		PerChat: matcher.Cooldown{Limit: 0, Interval: 0},
+		Reply:   "Wait a bit",
+	}, m.CooldownsFor(1))
+
+	fsys["config/2/cool.yml"] = &fstest.MapFile{Data: []byte("cooldowns:\n  per_usr:\n    limit: 2\n")}
+
+	_, err = matcher.LoadMatcherConfig[reloadCfg]("cool", matcher.WithFS(fsys), matcher.WithStrict())
+	require.ErrorContains(t, err, "config/2/cool.yml: key cooldowns.per_usr: unknown key")
+}
@@ -0,0 +1,255 @@
+package matcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+
+	telegramclient "github.com/br0-space/bot-telegramclient"
+)
+
+var (
+	// statusCodePattern matches the HTTP or Bot API error code in errors returned by telegramclient.Client.
+	statusCodePattern = regexp.MustCompile(`failed with (\d{3})\b`)
+	// retryAfterPattern matches the retry-after hint in the description of Bot API errors with code 429.
+	retryAfterPattern = regexp.MustCompile(`(?i)retry after (\d+)`)
+)
+
+// RetryPolicy configures how often and how long the Registry retries sending a message that failed
+// with a transient error: a rate limit (429), a server error (5xx) or a network timeout. Other errors, like
+// 400 Bad Request or other network errors, after which the message may have been sent, are not retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts per message, including the first one.
+	// Values below 1 are treated as 1, i.e. no retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts. Zero means no cap.
+	// It does not apply to retry-after hints sent by Telegram.
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay grows by after every retry. Values below 1 are treated as 1.
+	Multiplier float64
+}
+
+// DefaultRetryPolicy returns a RetryPolicy with up to 5 attempts and an exponential backoff starting at
+// 500ms, doubling after every retry and capped at 30s.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+	}
+}
+
+// backoff returns the delay before the given retry, starting at 1.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := float64(p.InitialBackoff)
+	for range retry - 1 {
+		delay *= max(p.Multiplier, 1)
+	}
+
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+
+	return time.Duration(delay)
+}
+
+// RetryAfterInterface is an optional interface for errors returned by the Telegram client. If an error
+// implements it and RetryAfter returns a positive duration, the next attempt waits that long instead of
+// the backoff of the RetryPolicy. Errors of telegramclient.Client carry the hint in their message, which
+// is parsed as well.
+type RetryAfterInterface interface {
+	RetryAfter() time.Duration
+}
+
+// DeadLetter is a message that could not be delivered.
+type DeadLetter struct {
+	// ChatID is the chat the message was sent to.
+	ChatID int64
+	// Identifier is the identifier of the matcher that returned the message.
+	Identifier string
+	// Message is the undeliverable message.
+	Message telegramclient.MessageStruct
+	// Attempts is the number of attempts made.
+	Attempts int
+	// Err is the error of the last attempt.
+	Err error
+}
+
+// DeadLetterSinkInterface receives messages that could not be delivered, see WithDeadLetterSink.
+type DeadLetterSinkInterface interface {
+	HandleDeadLetter(letter DeadLetter)
+}
+
+// DeadLetterSinkFunc is a function implementing DeadLetterSinkInterface.
+type DeadLetterSinkFunc func(letter DeadLetter)
+
+// HandleDeadLetter calls f.
+func (f DeadLetterSinkFunc) HandleDeadLetter(letter DeadLetter) {
+	f(letter)
+}
+
+// WithRetryPolicy makes the Registry retry sending messages that failed with a transient error according
+// to the given policy, see RetryPolicy and DefaultRetryPolicy. Without it, messages are sent once.
+// Retries of a message delay the following messages of the same matcher, which keeps their order, and are
+// abandoned once the context passed to ProcessContext is done.
+func WithRetryPolicy(policy RetryPolicy) RegistryOption {
+	return func(r *Registry) {
+		r.retryPolicy = policy
+	}
+}
+
+// WithDeadLetterSink passes messages that could not be delivered, after all attempts allowed by the
+// RetryPolicy, to the given sink, e.g. to store them for a later retry or to alert an operator.
+// Undeliverable messages are logged either way.
+func WithDeadLetterSink(sink DeadLetterSinkInterface) RegistryOption {
+	return func(r *Registry) {
+		r.deadLetters = sink
+	}
+}
+
+// sendMessages delivers all messages returned by the matcher with the given identifier to the given chat
+// ID, retrying each according to the RetryPolicy. Undeliverable messages are logged and passed to the
+// dead-letter sink individually.
+func (r *Registry) sendMessages(
+	ctx context.Context,
+	identifier string,
+	chatID int64,
+	messagesOut []telegramclient.MessageStruct,
+) {
+	for _, messageOut := range messagesOut {
+		r.deliver(ctx, identifier, chatID, messageOut, func() error {
+			return r.telegram.SendMessage(chatID, messageOut)
+		})
+	}
+}
+
+// deliver delivers a single message of the matcher with the given identifier to the given chat ID by calling
+// attempt, retrying according to the RetryPolicy. It reports whether the message was delivered; otherwise,
+// it is logged and passed to the dead-letter sink.
+func (r *Registry) deliver(
+	ctx context.Context,
+	identifier string,
+	chatID int64,
+	messageOut telegramclient.MessageStruct,
+	attempt func() error,
+) bool {
+	attempts, err := r.send(ctx, chatID, attempt)
+	if err == nil {
+		return true
+	}
+
+	r.log.Errorf("Error while sending message of matcher %s to chat %d after %d attempt(s): %s",
+		identifier, chatID, attempts, err)
+
+	if r.deadLetters != nil {
+		r.deadLetters.HandleDeadLetter(DeadLetter{
+			ChatID:     chatID,
+			Identifier: identifier,
+			Message:    messageOut,
+			Attempts:   attempts,
+			Err:        err,
+		})
+	}
+
+	return false
+}
+
+// send sends a single message by calling attempt, waiting for the rate limits configured with WithRateLimits
+// before every attempt and retrying transient errors according to the RetryPolicy. It returns the number of
+// attempts made and the error of the last attempt, or nil if the message was delivered.
+func (r *Registry) send(ctx context.Context, chatID int64, attempt func() error) (int, error) {
+	maxAttempts := max(r.retryPolicy.MaxAttempts, 1)
+
+	var lastErr error
+
+	for attempts := 1; ; attempts++ {
+		if err := r.waitForRateLimit(ctx, chatID); err != nil {
+			if lastErr != nil {
+				return attempts - 1, fmt.Errorf("%w (retry abandoned: %w)", lastErr, err)
+			}
+
+			return 0, fmt.Errorf("message not sent: %w", err)
+		}
+
+		lastErr = attempt()
+		if lastErr == nil {
+			return attempts, nil
+		}
+
+		if attempts >= maxAttempts || !isRetryable(lastErr) {
+			return attempts, lastErr
+		}
+
+		delay := r.retryPolicy.backoff(attempts)
+		if hint, ok := retryAfter(lastErr); ok {
+			delay = hint
+		}
+
+		r.log.Debugf("Retrying to send message to chat %d in %s: %s", chatID, delay, lastErr)
+
+		select {
+		case <-r.clock.After(delay):
+		case <-ctx.Done():
+			return attempts, fmt.Errorf("%w (retry abandoned: %w)", lastErr, ctx.Err())
+		}
+	}
+}
+
+// waitForRateLimit waits until the rate limits configured with WithRateLimits allow sending a message to the
+// given chat, or returns an error once ctx is done.
+func (r *Registry) waitForRateLimit(ctx context.Context, chatID int64) error {
+	if r.limiter == nil {
+		return nil
+	}
+
+	if err := r.limiter.wait(ctx, r.clock, chatID); err != nil {
+		return fmt.Errorf("rate limit wait abandoned: %w", err)
+	}
+
+	return nil
+}
+
+// isRetryable reports whether a send error is transient: a rate limit, a server error or a net.Error
+// reporting a timeout. Errors implementing RetryAfterInterface are always retryable.
+func isRetryable(err error) bool {
+	if _, ok := retryAfter(err); ok {
+		return true
+	}
+
+	if match := statusCodePattern.FindStringSubmatch(err.Error()); match != nil {
+		code, _ := strconv.Atoi(match[1])
+
+		return code == 429 || code >= 500
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retryAfter returns the retry-after hint carried by a send error, see RetryAfterInterface.
+func retryAfter(err error) (time.Duration, bool) {
+	var hinted RetryAfterInterface
+	if errors.As(err, &hinted) && hinted.RetryAfter() > 0 {
+		return hinted.RetryAfter(), true
+	}
+
+	match := retryAfterPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0, false
+	}
+
+	seconds, err := strconv.Atoi(match[1])
+	if err != nil || seconds <= 0 {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
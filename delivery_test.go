@@ -0,0 +1,268 @@
+package matcher_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a Clock whose timers fire immediately. It records the requested delays and advances its
+// current time by them.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	delays []time.Duration
+}
+
+// Now returns the current fake time.
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// After records the delay, advances the fake time and returns a channel that has already fired.
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.delays = append(c.delays, d)
+	c.now = c.now.Add(d)
+
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+
+	return ch
+}
+
+// recordedDelays returns the delays requested so far.
+func (c *fakeClock) recordedDelays() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return slices.Clone(c.delays)
+}
+
+// flakyTelegramClient fails the first sends with the queued errors and records the delivered messages.
+type flakyTelegramClient struct {
+	fakeTelegramClient
+
+	errsMu   sync.Mutex
+	errs     []error
+	attempts int
+}
+
+// SendMessage returns the next queued error, or records the message once all errors are used up.
+func (f *flakyTelegramClient) SendMessage(chatID int64, msg telegramclient.MessageStruct) error {
+	f.errsMu.Lock()
+	f.attempts++
+
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		f.errsMu.Unlock()
+
+		return err
+	}
+
+	f.errsMu.Unlock()
+
+	return f.fakeTelegramClient.SendMessage(chatID, msg)
+}
+
+// retryAfterError is a client error carrying a retry-after hint.
+type retryAfterError struct {
+	after time.Duration
+}
+
+func (e retryAfterError) Error() string { return "rate limited" }
+
+func (e retryAfterError) RetryAfter() time.Duration { return e.after }
+
+// timeoutError is a net.Error reporting a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "i/o timeout" }
+
+func (timeoutError) Timeout() bool { return true }
+
+func (timeoutError) Temporary() bool { return true }
+
+// deadLetterRecorder records all dead letters.
+type deadLetterRecorder struct {
+	mu      sync.Mutex
+	letters []matcher.DeadLetter
+}
+
+// HandleDeadLetter records the letter.
+func (d *deadLetterRecorder) HandleDeadLetter(letter matcher.DeadLetter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.letters = append(d.letters, letter)
+}
+
+// TestRegistry_Process_Retries verifies which send errors are retried and how long the Registry waits
+// before each retry.
+func TestRegistry_Process_Retries(t *testing.T) {
+	t.Parallel()
+
+	policy := matcher.RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     300 * time.Millisecond,
+		Multiplier:     2,
+	}
+
+	tests := []struct {
+		name       string
+		errs       []error
+		wantSent   bool
+		wantDelays []time.Duration
+	}{
+		{
+			name:       "success",
+			errs:       nil,
+			wantSent:   true,
+			wantDelays: nil,
+		},
+		{
+			name: "server errors with capped exponential backoff",
+			errs: []error{
+				errors.New("SendMessage failed with 502: Bad Gateway"),
+				errors.New("SendMessage failed with 500 Internal Server Error: unable to decode response body"),
+				timeoutError{},
+			},
+			wantSent:   true,
+			wantDelays: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond},
+		},
+		{
+			name:       "retry after from the error message",
+			errs:       []error{errors.New("SendMessage failed with 429: Too Many Requests: retry after 7")},
+			wantSent:   true,
+			wantDelays: []time.Duration{7 * time.Second},
+		},
+		{
+			name:       "retry after from RetryAfterInterface",
+			errs:       []error{retryAfterError{after: 42 * time.Millisecond}},
+			wantSent:   true,
+			wantDelays: []time.Duration{42 * time.Millisecond},
+		},
+		{
+			name:       "client errors are not retried",
+			errs:       []error{errors.New("SendMessage failed with 400: Bad Request: chat not found")},
+			wantSent:   false,
+			wantDelays: nil,
+		},
+		{
+			name:       "errors without status code are not retried",
+			errs:       []error{errors.New("connection reset by peer")},
+			wantSent:   false,
+			wantDelays: nil,
+		},
+		{
+			name: "attempts exhausted",
+			errs: []error{
+				errors.New("SendMessage failed with 503: Service Unavailable"),
+				errors.New("SendMessage failed with 503: Service Unavailable"),
+				errors.New("SendMessage failed with 503: Service Unavailable"),
+				errors.New("SendMessage failed with 503: Service Unavailable"),
+			},
+			wantSent:   false,
+			wantDelays: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &flakyTelegramClient{errs: tt.errs}
+			clock := &fakeClock{}
+			sink := &deadLetterRecorder{}
+			reg := matcher.NewRegistry(
+				logger.New(),
+				client,
+				matcher.WithRetryPolicy(policy),
+				matcher.WithDeadLetterSink(sink),
+				matcher.WithClock(clock),
+			)
+			reg.Register(makeEchoMatcher("echo"))
+
+			reg.Process(telegramclient.TestWebhookMessage("hello"))
+
+			assert.Equal(t, tt.wantDelays, clock.recordedDelays())
+
+			if tt.wantSent {
+				assert.Equal(t, []string{"hello"}, client.sentTexts())
+				assert.Empty(t, sink.letters)
+
+				return
+			}
+
+			assert.Empty(t, client.sentTexts())
+			require.Len(t, sink.letters, 1)
+
+			letter := sink.letters[0]
+			assert.Equal(t, int64(789), letter.ChatID)
+			assert.Equal(t, "echo", letter.Identifier)
+			assert.Equal(t, "hello", letter.Message.Text)
+			assert.Equal(t, client.attempts, letter.Attempts)
+			assert.Equal(t, tt.errs[len(tt.errs)-1], letter.Err)
+		})
+	}
+}
+
+// TestRegistry_Process_NoRetriesByDefault verifies that messages are sent once without a RetryPolicy.
+func TestRegistry_Process_NoRetriesByDefault(t *testing.T) {
+	t.Parallel()
+
+	client := &flakyTelegramClient{errs: []error{errors.New("SendMessage failed with 502: Bad Gateway")}}
+	sink := &deadLetterRecorder{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithDeadLetterSink(sink))
+	reg.Register(makeEchoMatcher("echo"))
+
+	reg.Process(telegramclient.TestWebhookMessage("hello"))
+
+	assert.Equal(t, 1, client.attempts)
+	require.Len(t, sink.letters, 1)
+	assert.Equal(t, 1, sink.letters[0].Attempts)
+}
+
+// TestRegistry_Process_RetryAbandoned verifies that retries stop once the context is done.
+func TestRegistry_Process_RetryAbandoned(t *testing.T) {
+	t.Parallel()
+
+	client := &flakyTelegramClient{errs: []error{errors.New("SendMessage failed with 502: Bad Gateway")}}
+
+	var letters []matcher.DeadLetter
+
+	reg := matcher.NewRegistry(
+		logger.New(),
+		client,
+		matcher.WithRetryPolicy(matcher.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: 0, Multiplier: 1}),
+		matcher.WithDeadLetterSink(matcher.DeadLetterSinkFunc(func(letter matcher.DeadLetter) {
+			letters = append(letters, letter)
+		})),
+	)
+	reg.Register(makeEchoMatcher("echo"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	reg.ProcessContext(ctx, telegramclient.TestWebhookMessage("hello"))
+
+	require.Len(t, letters, 1)
+	require.ErrorIs(t, letters[0].Err, context.DeadlineExceeded)
+	assert.ErrorContains(t, letters[0].Err, "Bad Gateway")
+}
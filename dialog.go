@@ -0,0 +1,364 @@
+package matcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	telegramclient "github.com/br0-space/bot-telegramclient"
+)
+
+// dialogSweepInterval is how often timed out dialogs of users that did not write again are removed, see
+// Dialogs.sweep.
+const dialogSweepInterval = time.Minute
+
+// DialogHandler processes a message answering the current step of a dialog. It can store values in the
+// dialog and continue it with Dialog.Next. If it does not, the dialog ends once the handler returns.
+type DialogHandler func(
+	ctx context.Context,
+	dialog *Dialog,
+	messageIn telegramclient.WebhookMessageStruct,
+) ([]telegramclient.MessageStruct, error)
+
+// DialogStep is the next message a dialog expects from its user.
+type DialogStep struct {
+	// Match reports whether a message answers the step. If nil, every message of the user answers it.
+	// Messages that do not answer the step are matched as usual and the dialog stays active.
+	Match func(messageIn telegramclient.WebhookMessageStruct) bool
+	// Handle processes the answer.
+	Handle DialogHandler
+}
+
+// matches reports whether the message answers the step.
+func (s DialogStep) matches(messageIn telegramclient.WebhookMessageStruct) bool {
+	return s.Match == nil || s.Match(messageIn)
+}
+
+// dialogKey identifies the dialog of a user in a chat.
+type dialogKey struct {
+	chatID int64
+	userID int64
+}
+
+// Dialog is a multi-step conversation between a matcher and a user in a chat, e.g. a matcher asking
+// "which city?" and interpreting the user's next message as the answer. Start one with Dialogs.Start.
+// A Dialog is safe for concurrent use.
+type Dialog struct {
+	key        dialogKey
+	identifier string
+	dialogs    *Dialogs
+
+	mu      sync.Mutex
+	values  map[string]any
+	step    *DialogStep
+	expires time.Time
+}
+
+// Identifier returns the identifier of the matcher that started the dialog.
+func (d *Dialog) Identifier() string {
+	return d.identifier
+}
+
+// ChatID returns the chat the dialog takes place in.
+func (d *Dialog) ChatID() int64 {
+	return d.key.chatID
+}
+
+// UserID returns the user the dialog is held with.
+func (d *Dialog) UserID() int64 {
+	return d.key.userID
+}
+
+// Set stores a value in the dialog, e.g. the answer to a previous step.
+func (d *Dialog) Set(key string, value any) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.values[key] = value
+}
+
+// Get returns a value stored in the dialog.
+func (d *Dialog) Get(key string) (any, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	value, ok := d.values[key]
+
+	return value, ok
+}
+
+// Values returns a copy of all values stored in the dialog.
+func (d *Dialog) Values() map[string]any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return maps.Clone(d.values)
+}
+
+// Next sets the step the dialog expects next and restarts its timeout.
+func (d *Dialog) Next(step DialogStep) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.step = &step
+	d.expires = d.dialogs.clock.Now().Add(d.dialogs.timeout)
+}
+
+// End ends the dialog, so that the user's next message is matched as usual.
+func (d *Dialog) End() {
+	d.mu.Lock()
+	d.step = nil
+	d.mu.Unlock()
+
+	d.dialogs.remove(d)
+}
+
+// take returns the current step if the message answers it and the dialog has not expired, and clears it,
+// so that concurrent messages cannot answer the same step twice.
+func (d *Dialog) take(messageIn telegramclient.WebhookMessageStruct, now time.Time) (DialogStep, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.step == nil || !now.Before(d.expires) || !d.step.matches(messageIn) {
+		return DialogStep{Match: nil, Handle: nil}, false
+	}
+
+	step := *d.step
+	d.step = nil
+
+	return step, true
+}
+
+// finish ends the dialog unless the handler of the step just taken continued it.
+func (d *Dialog) finish() {
+	d.mu.Lock()
+	ended := d.step == nil
+	d.mu.Unlock()
+
+	if ended {
+		d.dialogs.remove(d)
+	}
+}
+
+// expired reports whether the dialog has timed out.
+func (d *Dialog) expired(now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return !now.Before(d.expires)
+}
+
+// Dialogs holds the active dialogs, at most one per user and chat. Matchers start dialogs, and the
+// Registry routes follow-up messages to them before matching them as usual, see WithDialogs.
+type Dialogs struct {
+	timeout time.Duration
+	clock   Clock
+
+	mu        sync.Mutex
+	active    map[dialogKey]*Dialog
+	nextSweep time.Time
+}
+
+// NewDialogs returns an empty set of dialogs that time out if the user does not answer within timeout.
+// A nil clock uses the system clock.
+func NewDialogs(timeout time.Duration, clock Clock) *Dialogs {
+	if clock == nil {
+		clock = systemClock{}
+	}
+
+	return &Dialogs{
+		timeout:   timeout,
+		clock:     clock,
+		mu:        sync.Mutex{},
+		active:    map[dialogKey]*Dialog{},
+		nextSweep: time.Time{},
+	}
+}
+
+// WithDialogs makes the Registry route messages answering an active dialog to the dialog's current step
+// instead of the matchers. The step is executed with the timeout of the matcher that started the dialog,
+// but without middlewares, permission checks or cooldowns. Errors are reported like matcher errors.
+func WithDialogs(dialogs *Dialogs) RegistryOption {
+	return func(r *Registry) {
+		r.dialogs = dialogs
+	}
+}
+
+// Start starts a dialog of the matcher with the given identifier with the sender of the message in its
+// chat, expecting the given step next. It replaces an active dialog of the same user in the same chat.
+func (d *Dialogs) Start(
+	messageIn telegramclient.WebhookMessageStruct,
+	identifier string,
+	step DialogStep,
+) *Dialog {
+	dialog := &Dialog{
+		key:        dialogKey{chatID: messageIn.Chat.ID, userID: messageIn.From.ID},
+		identifier: identifier,
+		dialogs:    d,
+		mu:         sync.Mutex{},
+		values:     map[string]any{},
+		step:       nil,
+		expires:    time.Time{},
+	}
+	dialog.Next(step)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.active[dialog.key] = dialog
+	d.sweep(d.clock.Now())
+
+	return dialog
+}
+
+// Active returns the active dialog of the user in the chat, if there is one that has not timed out.
+func (d *Dialogs) Active(chatID int64, userID int64) (*Dialog, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock.Now()
+	d.sweep(now)
+
+	key := dialogKey{chatID: chatID, userID: userID}
+
+	dialog, ok := d.active[key]
+	if ok && dialog.expired(now) {
+		delete(d.active, key)
+
+		return nil, false
+	}
+
+	return dialog, ok
+}
+
+// sweep removes the dialogs that have timed out without their users writing again, at most once per
+// dialogSweepInterval. Timed out dialogs are never answered, so sweeping does not change which messages
+// are routed to dialogs. It must be called with d.mu held.
+func (d *Dialogs) sweep(now time.Time) {
+	if now.Before(d.nextSweep) {
+		return
+	}
+
+	d.nextSweep = now.Add(dialogSweepInterval)
+
+	for key, dialog := range d.active {
+		if dialog.expired(now) {
+			delete(d.active, key)
+		}
+	}
+}
+
+// remove removes the dialog unless it has been replaced by a new one in the meantime.
+func (d *Dialogs) remove(dialog *Dialog) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.active[dialog.key] == dialog {
+		delete(d.active, dialog.key)
+	}
+}
+
+// continueDialog routes the message to the current step of the sender's active dialog, if it answers it,
+// sends the replies and reports whether the message was handled.
+func (r *Registry) continueDialog(ctx context.Context, messageIn telegramclient.WebhookMessageStruct) bool {
+	if r.dialogs == nil {
+		return false
+	}
+
+	dialog, ok := r.dialogs.Active(messageIn.Chat.ID, messageIn.From.ID)
+	if !ok || !r.shouldContinueDialog(dialog) {
+		return false
+	}
+
+	step, ok := r.takeDialogStep(dialog, messageIn)
+	if !ok {
+		return false
+	}
+
+	r.log.Debugf("Continuing dialog of matcher %s with user %d in chat %d",
+		dialog.Identifier(), messageIn.From.ID, messageIn.Chat.ID)
+
+	messagesOut, err := r.runDialogStep(ctx, dialog, step, messageIn)
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) && !errors.Is(err, errDeadline) {
+		r.recordSuccess(dialog.Identifier())
+	}
+
+	if err != nil {
+		r.handleDialogError(dialog, messageIn, err)
+
+		messagesOut = append(messagesOut, telegramclient.MarkdownReply(
+			fmt.Sprintf(errorTemplate, dialog.Identifier(), telegramclient.EscapeMarkdown(err.Error())),
+			messageIn.ID,
+		))
+	}
+
+	r.sendMessages(ctx, dialog.Identifier(), messageIn.Chat.ID, messagesOut)
+
+	return true
+}
+
+// shouldContinueDialog reports whether the dialog's matcher may still handle messages in the dialog's chat:
+// it must not be quarantined, and it must still be enabled in the chat if it is registered.
+func (r *Registry) shouldContinueDialog(dialog *Dialog) bool {
+	if reg, ok := r.registrationOf(dialog.Identifier()); ok {
+		return r.shouldRunMatcher(reg.matcher, dialog.ChatID())
+	}
+
+	return !r.IsQuarantined(dialog.Identifier())
+}
+
+// takeDialogStep takes the step of the dialog the message answers, see Dialog.take. A panic in the step's
+// Match is recovered and counts towards the quarantine of the dialog's matcher, like a panic in DoesMatch.
+func (r *Registry) takeDialogStep(
+	dialog *Dialog,
+	messageIn telegramclient.WebhookMessageStruct,
+) (step DialogStep, ok bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			r.log.Errorf("Recovered from panic in dialog of matcher %s: %v\n%s", dialog.Identifier(), v, debug.Stack())
+			r.recordPanic(dialog.Identifier())
+		}
+	}()
+
+	return dialog.take(messageIn, r.dialogs.clock.Now())
+}
+
+// handleDialogError reports an error of a dialog step through handleError of the matcher that started the
+// dialog. If that matcher is not registered, the error is only logged, and panics still count towards its
+// quarantine.
+func (r *Registry) handleDialogError(dialog *Dialog, messageIn telegramclient.WebhookMessageStruct, err error) {
+	if reg, ok := r.registrationOf(dialog.Identifier()); ok {
+		r.handleError(reg.matcher, messageIn, err)
+
+		return
+	}
+
+	r.log.Errorf("Error in dialog of matcher %s: %s", dialog.Identifier(), err)
+
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		r.log.Errorf("Stack trace of matcher %s:\n%s", dialog.Identifier(), panicErr.Stack)
+		r.recordPanic(dialog.Identifier())
+	}
+}
+
+// runDialogStep calls the handler of the step on behalf of the dialog's matcher, see callMatcher, and ends
+// the dialog unless the handler continued it.
+func (r *Registry) runDialogStep(
+	ctx context.Context,
+	dialog *Dialog,
+	step DialogStep,
+	messageIn telegramclient.WebhookMessageStruct,
+) ([]telegramclient.MessageStruct, error) {
+	defer dialog.finish()
+
+	return callMatcher(ctx, r, dialog.Identifier(), func(ctx context.Context) ([]telegramclient.MessageStruct, error) {
+		return step.Handle(ctx, dialog, messageIn)
+	})
+}
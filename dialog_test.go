@@ -0,0 +1,265 @@
+package matcher_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// weatherMatcher is a test matcher asking for a city and a number of days in a dialog.
+// It records all errors passed to HandleError.
+type weatherMatcher struct {
+	matcher.Matcher
+	*errorRecorder
+
+	dialogs *matcher.Dialogs
+}
+
+// HandleError records the error.
+func (m weatherMatcher) HandleError(messageIn telegramclient.WebhookMessageStruct, identifier string, err error) {
+	m.errorRecorder.HandleError(messageIn, identifier, err)
+}
+
+// Process starts the dialog.
+func (m weatherMatcher) Process(messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+	m.dialogs.Start(messageIn, m.Identifier(), matcher.DialogStep{Match: nil, Handle: m.city})
+
+	return []telegramclient.MessageStruct{telegramclient.Reply("Which city?", messageIn.ID)}, nil
+}
+
+// city stores the city and asks for the number of days, which must be a number.
+func (m weatherMatcher) city(
+	_ context.Context,
+	dialog *matcher.Dialog,
+	messageIn telegramclient.WebhookMessageStruct,
+) ([]telegramclient.MessageStruct, error) {
+	switch messageIn.Text {
+	case "fail":
+		return nil, errors.New("unknown city")
+	case "panic":
+		panic("boom")
+	}
+
+	dialog.Set("city", messageIn.Text)
+	dialog.Next(matcher.DialogStep{
+		Match: func(messageIn telegramclient.WebhookMessageStruct) bool {
+			return regexp.MustCompile(`^\d+$`).MatchString(messageIn.Text)
+		},
+		Handle: m.days,
+	})
+
+	return []telegramclient.MessageStruct{telegramclient.Reply("How many days?", messageIn.ID)}, nil
+}
+
+// days replies with the collected answers and ends the dialog.
+func (m weatherMatcher) days(
+	_ context.Context,
+	dialog *matcher.Dialog,
+	messageIn telegramclient.WebhookMessageStruct,
+) ([]telegramclient.MessageStruct, error) {
+	city, _ := dialog.Get("city")
+
+	return []telegramclient.MessageStruct{
+		telegramclient.Reply("Weather in "+city.(string)+" for "+messageIn.Text+" days", messageIn.ID),
+	}, nil
+}
+
+// newDialogRegistry returns a registry with dialogs timing out after a minute, the weather matcher and
+// an echo matcher, whose replies are sent in registration order, and the weather matcher's error recorder.
+func newDialogRegistry(
+	opts ...matcher.RegistryOption,
+) (*matcher.Registry, *fakeTelegramClient, *matcher.Dialogs, *fakeClock, *errorRecorder) {
+	clock := &fakeClock{}
+	dialogs := matcher.NewDialogs(time.Minute, clock)
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, append(opts, matcher.WithDialogs(dialogs), matcher.WithReplyOrder(matcher.ReplyOrderRegistration))...)
+
+	recorder := &errorRecorder{}
+	reg.Register(weatherMatcher{
+		Matcher:       matcher.MakeMatcher("weather", regexp.MustCompile(`^/weather`), nil),
+		errorRecorder: recorder,
+		dialogs:       dialogs,
+	})
+	reg.Register(makeIdentifierMatcher("echo", `.`))
+
+	return reg, client, dialogs, clock, recorder
+}
+
+// sendFrom processes a message with the given text from the given user in chat 1.
+func sendFrom(reg *matcher.Registry, userID int64, text string) {
+	msg := messageFrom(1, userID)
+	msg.Text = text
+
+	reg.Process(msg)
+}
+
+// TestRegistry_Process_Dialog verifies that follow-up messages of the user are routed to the dialog
+// before normal matching, across several steps, and that other users are not affected.
+func TestRegistry_Process_Dialog(t *testing.T) {
+	t.Parallel()
+
+	reg, client, dialogs, _, _ := newDialogRegistry()
+
+	sendFrom(reg, 10, "/weather")
+	sendFrom(reg, 11, "Hamburg")
+	sendFrom(reg, 10, "Berlin")
+	sendFrom(reg, 10, "soon")
+	sendFrom(reg, 10, "3")
+	sendFrom(reg, 10, "4")
+
+	assert.Equal(t, []string{
+		"Which city?", "echo",
+		"echo",
+		"How many days?",
+		"echo",
+		"Weather in Berlin for 3 days",
+		"echo",
+	}, client.sentTexts())
+
+	_, ok := dialogs.Active(1, 10)
+	assert.False(t, ok)
+}
+
+// TestRegistry_Process_DialogTimeout verifies that abandoned dialogs time out.
+func TestRegistry_Process_DialogTimeout(t *testing.T) {
+	t.Parallel()
+
+	reg, client, dialogs, clock, _ := newDialogRegistry()
+
+	sendFrom(reg, 10, "/weather")
+
+	dialog, ok := dialogs.Active(1, 10)
+	require.True(t, ok)
+	assert.Equal(t, "weather", dialog.Identifier())
+	assert.Equal(t, int64(1), dialog.ChatID())
+	assert.Equal(t, int64(10), dialog.UserID())
+
+	clock.After(time.Minute)
+
+	sendFrom(reg, 10, "Berlin")
+	assert.Equal(t, []string{"Which city?", "echo", "echo"}, client.sentTexts())
+
+	_, ok = dialogs.Active(1, 10)
+	assert.False(t, ok)
+}
+
+// TestRegistry_Process_DialogErrors verifies that errors and panics in dialogs are reported like matcher
+// errors and end the dialog.
+func TestRegistry_Process_DialogErrors(t *testing.T) {
+	t.Parallel()
+
+	reg, client, dialogs, _, recorder := newDialogRegistry(matcher.WithPanicThreshold(1))
+
+	sendFrom(reg, 10, "/weather")
+	sendFrom(reg, 10, "fail")
+	assert.Equal(t, "⚠️ *Error in matcher \"weather\"*\n\nunknown city", client.sentTexts()[2])
+
+	_, ok := dialogs.Active(1, 10)
+	assert.False(t, ok)
+
+	sendFrom(reg, 10, "/weather")
+	sendFrom(reg, 10, "panic")
+	assert.True(t, strings.HasPrefix(client.sentTexts()[5], "⚠️ *Error in matcher \"weather\"*"))
+	assert.True(t, reg.IsQuarantined("weather"))
+
+	handled := recorder.handledErrors()
+	require.Len(t, handled, 1)
+
+	var panicErr *matcher.PanicError
+	require.ErrorAs(t, handled[0], &panicErr)
+}
+
+// TestRegistry_Process_DialogMatchPanic verifies that a panic in a step's Match is recovered, counts towards
+// the quarantine of the dialog's matcher and leaves the message to normal matching.
+func TestRegistry_Process_DialogMatchPanic(t *testing.T) {
+	t.Parallel()
+
+	reg, client, dialogs, _, _ := newDialogRegistry(matcher.WithPanicThreshold(1))
+
+	dialogs.Start(messageFrom(1, 10), "weather", matcher.DialogStep{
+		Match: func(telegramclient.WebhookMessageStruct) bool {
+			panic("boom")
+		},
+		Handle: nil,
+	})
+
+	sendFrom(reg, 10, "Berlin")
+	assert.Equal(t, []string{"echo"}, client.sentTexts())
+	assert.True(t, reg.IsQuarantined("weather"))
+}
+
+// TestRegistry_Process_DialogDisabled verifies that a dialog is not continued once its matcher is disabled
+// in the chat, and continues once it is enabled again.
+func TestRegistry_Process_DialogDisabled(t *testing.T) {
+	t.Parallel()
+
+	store := matcher.NewConfigStore(matcher.WithDir(t.TempDir()))
+	reg, client, _, _, _ := newDialogRegistry(matcher.WithConfigStore(store))
+
+	sendFrom(reg, 10, "/weather")
+	require.NoError(t, store.SetEnabled("weather", 1, false))
+
+	sendFrom(reg, 10, "Berlin")
+	require.NoError(t, store.SetEnabled("weather", 1, true))
+
+	sendFrom(reg, 10, "Hamburg")
+	assert.Equal(t, []string{"Which city?", "echo", "echo", "How many days?"}, client.sentTexts())
+}
+
+// TestRegistry_Process_DialogSweep verifies that removing timed out dialogs keeps the dialogs that are still
+// active.
+func TestRegistry_Process_DialogSweep(t *testing.T) {
+	t.Parallel()
+
+	reg, client, dialogs, clock, _ := newDialogRegistry()
+
+	sendFrom(reg, 20, "/weather")
+	clock.After(2 * time.Minute)
+
+	sendFrom(reg, 10, "/weather")
+	clock.After(30 * time.Second)
+
+	sendFrom(reg, 11, "hello")
+	sendFrom(reg, 10, "Berlin")
+
+	_, ok := dialogs.Active(1, 20)
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"Which city?", "echo", "Which city?", "echo", "echo", "How many days?"}, client.sentTexts())
+}
+
+// TestDialog_End verifies that an ended dialog no longer receives messages and that starting a new dialog
+// replaces the active one.
+func TestDialog_End(t *testing.T) {
+	t.Parallel()
+
+	dialogs := matcher.NewDialogs(time.Minute, nil)
+	msg := messageFrom(1, 10)
+	step := matcher.DialogStep{Match: nil, Handle: nil}
+
+	first := dialogs.Start(msg, "first", step)
+	first.Set("a", 1)
+	assert.Equal(t, map[string]any{"a": 1}, first.Values())
+
+	second := dialogs.Start(msg, "second", step)
+	first.End()
+
+	active, ok := dialogs.Active(1, 10)
+	require.True(t, ok)
+	assert.Same(t, second, active)
+	assert.Empty(t, active.Values())
+
+	second.End()
+
+	_, ok = dialogs.Active(1, 10)
+	assert.False(t, ok)
+}
@@ -0,0 +1,147 @@
+package matcher
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"sync"
+
+	telegramclient "github.com/br0-space/bot-telegramclient"
+)
+
+// maxTrackedReplies is the number of messages whose replies are remembered for editing, see WithReplyEditing.
+const maxTrackedReplies = 1024
+
+// notModifiedPattern matches the Bot API error returned when an edited message would not change.
+var notModifiedPattern = regexp.MustCompile(`(?i)message is not modified`)
+
+// MessageEditorInterface is an optional extension of telegramclient.ClientInterface for clients that can
+// edit sent messages, as required by WithReplyEditing.
+type MessageEditorInterface interface {
+	// SendMessageWithID sends a message like SendMessage and returns the ID of the sent message.
+	SendMessageWithID(chatID int64, messageOut telegramclient.MessageStruct) (int64, error)
+	// EditMessageText replaces the text of the sent message with the given ID by the text of messageOut.
+	EditMessageText(chatID int64, messageID int64, messageOut telegramclient.MessageStruct) error
+}
+
+// WithReplyEditing makes the Registry edit the replies a matcher sent to a message when the message is edited,
+// instead of sending new replies. It remembers the replies to the last 1024 messages; replies to older
+// messages are sent as new messages. Additional replies are sent as new messages, surplus previous replies
+// are kept. Only matchers handling UpdateEditedMessage or UpdateEditedChannelPost are executed for edited
+// messages, see Matcher.WithUpdateKinds. The Telegram client must implement MessageEditorInterface,
+// otherwise replies are always sent as new messages.
+func WithReplyEditing() RegistryOption {
+	return func(r *Registry) {
+		r.replies = newReplyTracker(maxTrackedReplies)
+	}
+}
+
+// replyKey identifies the replies of a matcher to a message.
+type replyKey struct {
+	chatID     int64
+	messageID  int64
+	identifier string
+}
+
+// replyTracker remembers the IDs of the replies sent by matchers to the most recent messages.
+type replyTracker struct {
+	mu       sync.Mutex
+	capacity int
+	replies  map[replyKey][]int64
+	order    []replyKey
+}
+
+// newReplyTracker returns a replyTracker remembering the replies to at most capacity messages.
+func newReplyTracker(capacity int) *replyTracker {
+	return &replyTracker{
+		mu:       sync.Mutex{},
+		capacity: capacity,
+		replies:  map[replyKey][]int64{},
+		order:    nil,
+	}
+}
+
+// get returns the IDs of the replies remembered for the key.
+func (t *replyTracker) get(key replyKey) []int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return slices.Clone(t.replies[key])
+}
+
+// put remembers the IDs of the replies for the key, forgetting the oldest keys beyond the capacity.
+func (t *replyTracker) put(key replyKey, messageIDs []int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.replies[key]; !ok {
+		t.order = append(t.order, key)
+	}
+
+	t.replies[key] = messageIDs
+
+	for len(t.order) > t.capacity {
+		delete(t.replies, t.order[0])
+		t.order = t.order[1:]
+	}
+}
+
+// sendReplies sends the replies of the matcher with the given identifier to a message received with the
+// given kind of update. With WithReplyEditing, the IDs of sent replies are remembered, and the replies to
+// an edited message replace the matcher's previous replies to it one by one.
+func (r *Registry) sendReplies(
+	ctx context.Context,
+	kind UpdateKind,
+	messageIn telegramclient.WebhookMessageStruct,
+	identifier string,
+	messagesOut []telegramclient.MessageStruct,
+) {
+	chatID := messageIn.Chat.ID
+
+	editor, ok := r.telegram.(MessageEditorInterface)
+	if r.replies == nil || !ok || len(messagesOut) == 0 {
+		r.sendMessages(ctx, identifier, chatID, messagesOut)
+
+		return
+	}
+
+	key := replyKey{chatID: chatID, messageID: messageIn.ID, identifier: identifier}
+
+	var messageIDs []int64
+	if kind.IsEdit() {
+		messageIDs = r.replies.get(key)
+	}
+
+	for i, messageOut := range messagesOut {
+		if i < len(messageIDs) {
+			messageID := messageIDs[i]
+			r.deliver(ctx, identifier, chatID, messageOut, func() error {
+				return ignoreNotModified(editor.EditMessageText(chatID, messageID, messageOut))
+			})
+
+			continue
+		}
+
+		var messageID int64
+
+		if r.deliver(ctx, identifier, chatID, messageOut, func() error {
+			var err error
+			messageID, err = editor.SendMessageWithID(chatID, messageOut)
+
+			return err
+		}) {
+			messageIDs = append(messageIDs, messageID)
+		}
+	}
+
+	r.replies.put(key, messageIDs)
+}
+
+// ignoreNotModified returns nil for the error Telegram returns when an edit would not change the message.
+func ignoreNotModified(err error) error {
+	if err != nil && notModifiedPattern.MatchString(err.Error()) {
+		return nil
+	}
+
+	return err
+}
@@ -1,12 +1,20 @@
 package configurable
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
+	"unicode/utf8"
 
 	matcher "github.com/br0-space/bot-matcher"
 )
 
+// commandPattern matches the command names Telegram accepts.
+var commandPattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,32}$`)
+
+// maxDescriptionLength is the maximum length of a command description Telegram accepts.
+const maxDescriptionLength = 256
+
 type Config struct {
 	matcher.Config
 
@@ -63,3 +71,27 @@ func (c Config) Help() []matcher.HelpStruct {
 		Example:     "/" + cmd,
 	}}
 }
+
+// Validate reports configured values that would result in a broken command: a command that is not
+// 1-32 letters, digits or underscores, or a description longer than Telegram accepts.
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.CommandText != "" && !commandPattern.MatchString(c.CommandText) {
+		errs = append(errs, &matcher.ConfigError{
+			Path: "",
+			Key:  "command",
+			Err:  fmt.Errorf("invalid command %q: use 1-32 letters, digits or underscores", c.CommandText),
+		})
+	}
+
+	if utf8.RuneCountInString(c.Description) > maxDescriptionLength {
+		errs = append(errs, &matcher.ConfigError{
+			Path: "",
+			Key:  "description",
+			Err:  fmt.Errorf("description longer than %d characters", maxDescriptionLength),
+		})
+	}
+
+	return errors.Join(errs...)
+}
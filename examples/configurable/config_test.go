@@ -1,6 +1,7 @@
 package configurable_test
 
 import (
+	"strings"
 	"testing"
 
 	matcher "github.com/br0-space/bot-matcher"
@@ -91,3 +92,16 @@ func TestConfig_Help(t *testing.T) {
 		Example:     "/configurable",
 	}, help[0])
 }
+
+// TestConfig_Validate verifies that invalid commands and overly long descriptions are reported per key.
+func TestConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, configurable.Config{}.Validate())
+	require.NoError(t, configurable.Config{CommandText: "hello_2"}.Validate())
+
+	err := configurable.Config{CommandText: "a b", Description: strings.Repeat("x", 257)}.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `key command: invalid command "a b"`)
+	assert.Contains(t, err.Error(), "key description: description longer than 256 characters")
+}
@@ -18,35 +18,48 @@ type Matcher struct {
 // MakeMatcher constructs a new configurable matcher using values from config/configurable.yaml.
 // It loads the command, reply, and description from the config, builds the matching pattern accordingly,
 // and wires the base matcher with that pattern and a generated help entry.
-// If the config cannot be loaded, it uses a default configuration with empty values (which trigger defaults in Config methods).
-func MakeMatcher() Matcher {
-	cfgs, err := matcher.LoadMatcherConfig[Config](identifier)
-
-	var cfg Config
+// Per-chat configs from config/{chatID}/configurable.yml are wired as well, so the reply text and the
+// enabled state can differ per chat.
+// Configs are loaded in strict mode and validated, see Config.Validate. The given options are passed to
+// LoadMatcherConfig, e.g. to read the configs from another directory or an embedded file system.
+// It returns the error of LoadMatcherConfig, listing every invalid file and key, so that a typo in a config
+// fails loudly at startup instead of silently falling back to defaults.
+func MakeMatcher(opts ...matcher.LoadOption) (Matcher, error) {
+	cfgs, err := matcher.LoadMatcherConfig[Config](identifier, append(opts, matcher.WithStrict())...)
 	if err != nil {
-		// If config loading fails, use a default config
-		// The Config methods will provide sensible defaults
-		cfg = Config{}
-	} else {
-		cfg = cfgs[0]
+		return Matcher{}, err
 	}
 
+	return makeMatcherFromConfigs(cfgs), nil
+}
+
+// MakeReloadingMatcher constructs a configurable matcher from the given reloadable config handle. The matcher
+// is rebuilt whenever the config is reloaded, so changes to the command, reply, description or enabled
+// state take effect without restarting the bot. Call cfg.Watch to reload on file changes.
+func MakeReloadingMatcher(cfg *matcher.ReloadableConfig[Config]) matcher.ReloadingMatcher[Matcher] {
+	return matcher.MakeReloadingMatcher(cfg, makeMatcherFromConfigs)
+}
+
+// makeMatcherFromConfigs builds the matcher from the given per-chat configs, deriving the pattern and help
+// entry from the fallback config under key 0.
+func makeMatcherFromConfigs(cfgs map[int64]Config) Matcher {
+	cfg := cfgs[0]
 	pattern := cfg.Pattern()
 	help := cfg.Help()
 
 	return Matcher{
-		WithCustomConfigType: matcher.MakeMatcherWithCustomConfigType(identifier, pattern, help, cfg),
+		WithCustomConfigType: matcher.MakeMatcherWithCustomConfigType(identifier, pattern, help, cfg).WithTypedConfigs(cfgs),
 	}
 }
 
 // Process checks whether the message matches the configured command and replies with the
-// configured reply text. If the message does not match, it returns an error.
+// configured reply text for the message's chat. If the message does not match, it returns an error.
 func (m Matcher) Process(messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
 	if !m.DoesMatch(messageIn) {
 		return nil, errors.New("message does not match")
 	}
 
-	replyText := m.Config().Reply()
+	replyText := m.ConfigFor(messageIn.Chat.ID).Reply()
 
 	return []telegramclient.MessageStruct{
 		telegramclient.Reply(replyText, messageIn.ID),
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"testing/fstest"
 
 	matcher "github.com/br0-space/bot-matcher"
 	"github.com/br0-space/bot-matcher/examples/configurable"
@@ -39,7 +40,8 @@ func TestMatcher_Defaults(t *testing.T) { //nolint:paralleltest
 	// empty config file; all values default in accessors
 	writeConfigFile(t, "")
 
-	m := configurable.MakeMatcher()
+	m, err := configurable.MakeMatcher()
+	require.NoError(t, err)
 
 	// DoesMatch cases mirror the ping tests, but for /configurable
 	type tc struct {
@@ -95,7 +97,8 @@ func TestMatcher_CustomCommandAndReply(t *testing.T) { //nolint:paralleltest
 	// Provide explicit command, reply and description
 	writeConfigFile(t, "command: hello\nreply: world\ndescription: Says world\n")
 
-	m := configurable.MakeMatcher()
+	m, err := configurable.MakeMatcher()
+	require.NoError(t, err)
 
 	// The matcher should honor the configured command and reply.
 	// It should match the configured command, not the default one.
@@ -129,33 +132,18 @@ func TestMatcher_CustomCommandAndReply(t *testing.T) { //nolint:paralleltest
 	}, help[0])
 }
 
-// TestMatcher_MissingConfig verifies that the matcher gracefully handles missing config files.
-// When the config cannot be loaded, the matcher should use default values.
+// TestMatcher_MissingConfig verifies that a missing config file fails loudly instead of falling back to defaults.
 func TestMatcher_MissingConfig(t *testing.T) { //nolint:paralleltest
 	// Create a temp dir without any config files
 	dir := t.TempDir()
 
 	t.Chdir(dir)
 
-	// MakeMatcher should not panic when config is missing
-	m := configurable.MakeMatcher()
-
-	// Should use defaults
-	assert.True(t, m.DoesMatch(newTestMessage("/configurable")))
-	assert.False(t, m.DoesMatch(newTestMessage("/hello")))
-
-	replies, err := m.Process(newTestMessage("/configurable"))
-	require.NoError(t, err)
-	assert.Len(t, replies, 1)
-	assert.Equal(t, "unconfigured reply", replies[0].Text)
-
-	help := m.Help()
-	require.Len(t, help, 1)
-	assert.Equal(t, "configurable", help[0].Command)
-	assert.Equal(t, "Responds with a configured reply", help[0].Description)
+	_, err := configurable.MakeMatcher()
+	require.ErrorContains(t, err, "config/configurable.yml")
 }
 
-// TestMatcher_InvalidConfig verifies that the matcher handles invalid YAML gracefully.
+// TestMatcher_InvalidConfig verifies that invalid configs are reported with all problems at once.
 func TestMatcher_InvalidConfig(t *testing.T) { //nolint:paralleltest
 	// Create a temp dir and change to it
 	dir := t.TempDir()
@@ -164,20 +152,93 @@ func TestMatcher_InvalidConfig(t *testing.T) { //nolint:paralleltest
 
 	// Create config directory and write invalid YAML directly
 	configDir := filepath.Join(dir, "config")
-	require.NoError(t, os.MkdirAll(configDir, 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(configDir, "789"), 0o755))
 
 	invalidYAML := "command: hello\nreply:\n  nested:\n    invalid: indentation\n  breaks: yaml"
-	configFile := filepath.Join(configDir, "configurable.yml")
-	require.NoError(t, os.WriteFile(configFile, []byte(invalidYAML), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "configurable.yml"), []byte(invalidYAML), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "789", "configurable.yml"), []byte("replly: typo\n"), 0o600))
 
-	// MakeMatcher should not panic with invalid config, should fall back to defaults
-	m := configurable.MakeMatcher()
+	_, err := configurable.MakeMatcher()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "config/configurable.yml")
+	assert.Contains(t, err.Error(), "replly")
+}
 
-	// Should use defaults since config couldn't be loaded
-	assert.True(t, m.DoesMatch(newTestMessage("/configurable")))
+// TestMatcher_PerChatConfig verifies that the reply and enabled state are resolved per chat.
+func TestMatcher_PerChatConfig(t *testing.T) { //nolint:paralleltest
+	dir := t.TempDir()
 
-	replies, err := m.Process(newTestMessage("/configurable"))
+	t.Chdir(dir)
+
+	chatDir := filepath.Join(dir, "config", "789")
+	require.NoError(t, os.MkdirAll(chatDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config", "configurable.yml"), []byte("reply: fallback\ndescription: Says fallback\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(chatDir, "configurable.yml"), []byte("Enabled: false\nreply: chat\n"), 0o600))
+
+	m, err := configurable.MakeMatcher()
+	require.NoError(t, err)
+
+	// TestWebhookMessage uses chat ID 789
+	msgIn := newTestMessage("/configurable")
+	assert.False(t, m.IsEnabledFor(msgIn.Chat.ID))
+	assert.Equal(t, "Says fallback", m.ConfigFor(msgIn.Chat.ID).Description) // inherited from the fallback
+
+	replies, err := m.Process(msgIn)
+	require.NoError(t, err)
+	require.Len(t, replies, 1)
+	assert.Equal(t, "chat", replies[0].Text)
+
+	msgIn.Chat.ID = 1
+	assert.True(t, m.IsEnabledFor(msgIn.Chat.ID))
+
+	replies, err = m.Process(msgIn)
+	require.NoError(t, err)
+	require.Len(t, replies, 1)
+	assert.Equal(t, "fallback", replies[0].Text)
+}
+
+// TestMakeReloadingMatcher verifies that the command, pattern and help are rebuilt after a reload.
+func TestMakeReloadingMatcher(t *testing.T) { //nolint:paralleltest
+	dir := t.TempDir()
+
+	t.Chdir(dir)
+
+	path := filepath.Join(dir, "config", "configurable.yml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte("command: hello\nreply: world\n"), 0o600))
+
+	cfg, err := matcher.NewReloadableConfig[configurable.Config]("configurable")
+	require.NoError(t, err)
+
+	m := configurable.MakeReloadingMatcher(cfg)
+	assert.True(t, m.DoesMatch(newTestMessage("/hello")))
+
+	require.NoError(t, os.WriteFile(path, []byte("command: hi\nreply: there\n"), 0o600))
+	require.NoError(t, cfg.Reload())
+
+	assert.False(t, m.DoesMatch(newTestMessage("/hello")))
+	assert.True(t, m.DoesMatch(newTestMessage("/hi")))
+	assert.Equal(t, "hi", m.Help()[0].Command)
+
+	replies, err := m.Process(newTestMessage("/hi"))
+	require.NoError(t, err)
+	require.Len(t, replies, 1)
+	assert.Equal(t, "there", replies[0].Text)
+}
+
+// TestMatcher_WithFS verifies that the configs can be read from an in-memory file system.
+func TestMatcher_WithFS(t *testing.T) {
+	t.Parallel()
+
+	m, err := configurable.MakeMatcher(matcher.WithFS(fstest.MapFS{
+		"config/configurable.yml": &fstest.MapFile{Data: []byte("command: hello\nreply: world\n")},
+	}))
+	require.NoError(t, err)
+
+	assert.True(t, m.DoesMatch(newTestMessage("/hello")))
+
+	replies, err := m.Process(newTestMessage("/hello"))
 	require.NoError(t, err)
-	assert.Len(t, replies, 1)
-	assert.Equal(t, "unconfigured reply", replies[0].Text)
+	require.Len(t, replies, 1)
+	assert.Equal(t, "world", replies[0].Text)
 }
@@ -0,0 +1,289 @@
+package matcher
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	telegramclient "github.com/br0-space/bot-telegramclient"
+)
+
+// maxInlineResults is the maximum number of results Telegram accepts per answer to an inline query.
+const maxInlineResults = 50
+
+// defaultInlineCacheTime is how long Telegram caches answers to inline queries by default.
+const defaultInlineCacheTime = 300 * time.Second
+
+// Create structs that mimic the inline query of an update and the body of answerInlineQuery
+// https://core.telegram.org/bots/api#inlinequery
+// https://core.telegram.org/bots/api#answerinlinequery
+
+// InlineQueryStruct is sent when a user types "@bot query" in any chat.
+type InlineQueryStruct struct {
+	ID    string                                  `json:"id"`
+	From  telegramclient.WebhookMessageUserStruct `json:"from"`
+	Query string                                  `json:"query"`
+	// Offset is the offset of the requested page of results, as returned in the NextOffset of the previous
+	// answer, or empty for the first page.
+	Offset string `json:"offset"`
+	// ChatType is the type of the chat the query was sent from, e.g. "private" or "supergroup".
+	ChatType string `json:"chat_type"` //nolint:tagliatelle
+}
+
+// message returns the query as a message from its sender without chat, with the query as text, as passed
+// to HandleError and used to check permissions.
+func (q InlineQueryStruct) message() telegramclient.WebhookMessageStruct {
+	return telegramclient.WebhookMessageStruct{
+		ID:      0,
+		From:    q.From,
+		Chat:    telegramclient.WebhookMessageChatStruct{ID: 0, Type: q.ChatType, Username: ""},
+		Text:    q.Query,
+		Date:    0,
+		Photo:   nil,
+		Caption: "",
+	}
+}
+
+// InlineQueryResultStruct is a single result of an inline query, e.g. an article or a photo.
+// https://core.telegram.org/bots/api#inlinequeryresult
+type InlineQueryResultStruct struct {
+	Type                string                         `json:"type"`
+	ID                  string                         `json:"id"`
+	Title               string                         `json:"title,omitempty"`
+	Description         string                         `json:"description,omitempty"`
+	URL                 string                         `json:"url,omitempty"`
+	PhotoURL            string                         `json:"photo_url,omitempty"`             //nolint:tagliatelle
+	ThumbnailURL        string                         `json:"thumbnail_url,omitempty"`         //nolint:tagliatelle
+	InputMessageContent *InputTextMessageContentStruct `json:"input_message_content,omitempty"` //nolint:tagliatelle
+	// Score ranks the result among the results of all matchers, higher scores first. Results of equal score
+	// keep the priority and registration order of their matchers. It is not sent to Telegram.
+	Score float64 `json:"-"`
+}
+
+// InputTextMessageContentStruct is the text message sent when the user chooses a result.
+type InputTextMessageContentStruct struct {
+	MessageText string `json:"message_text"`         //nolint:tagliatelle
+	ParseMode   string `json:"parse_mode,omitempty"` //nolint:tagliatelle
+}
+
+// ArticleResult returns an article result with the given ID and title that sends the given text when chosen.
+func ArticleResult(id string, title string, text string) InlineQueryResultStruct {
+	return InlineQueryResultStruct{
+		Type:                "article",
+		ID:                  id,
+		Title:               title,
+		Description:         "",
+		URL:                 "",
+		PhotoURL:            "",
+		ThumbnailURL:        "",
+		InputMessageContent: &InputTextMessageContentStruct{MessageText: text, ParseMode: ""},
+		Score:               0,
+	}
+}
+
+// InlineAnswerStruct is the answer to an inline query.
+type InlineAnswerStruct struct {
+	InlineQueryID string                    `json:"inline_query_id"` //nolint:tagliatelle
+	Results       []InlineQueryResultStruct `json:"results"`
+	CacheTime     int                       `json:"cache_time"`  //nolint:tagliatelle
+	IsPersonal    bool                      `json:"is_personal"` //nolint:tagliatelle
+	NextOffset    string                    `json:"next_offset"` //nolint:tagliatelle
+}
+
+// InlineInterface is an optional extension of Interface for matchers answering inline queries.
+type InlineInterface interface {
+	Interface
+	// DoesMatchInline reports whether the matcher has results for the inline query.
+	DoesMatchInline(query InlineQueryStruct) bool
+	// ProcessInlineQuery returns all results of the matcher for the inline query. The Registry takes care
+	// of ranking and paging, so the offset of the query can be ignored.
+	ProcessInlineQuery(ctx context.Context, query InlineQueryStruct) ([]InlineQueryResultStruct, error)
+}
+
+// InlineAnswererInterface is an optional extension of telegramclient.ClientInterface for clients that can
+// answer inline queries. Without it, inline queries are processed but not answered.
+type InlineAnswererInterface interface {
+	AnswerInlineQuery(answer InlineAnswerStruct) error
+}
+
+// WithInlineCacheTime sets how long Telegram may cache answers to inline queries, 300s by default. Answers
+// are always cached per user, as permissions and results may depend on the sender.
+func WithInlineCacheTime(cacheTime time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.inlineCache = cacheTime
+	}
+}
+
+// inlineBatch collects the results of a single matcher for an inline query.
+type inlineBatch struct {
+	results []InlineQueryResultStruct
+}
+
+// ProcessInlineQuery answers an inline query with the results of all matching matchers.
+// It is a shortcut for ProcessInlineQueryContext with a background context.
+func (r *Registry) ProcessInlineQuery(query InlineQueryStruct) {
+	r.ProcessInlineQueryContext(context.Background(), query)
+}
+
+// ProcessInlineQueryContext answers an inline query with the results of all matchers implementing
+// InlineInterface whose DoesMatchInline returns true. Inline queries have no chat, so matchers must be
+// enabled in their global config; quarantined matchers and matchers the sender is not permitted to use are
+// skipped. Matching matchers are executed concurrently with a context bounded by their timeout and are
+// abandoned once it expires, errors are logged and reported to HandleError. The results are merged, ranked by score and paged by the query's
+// offset, at most 50 per answer, see InlineQueryResultStruct. The query is always answered, provided the
+// Telegram client implements InlineAnswererInterface.
+func (r *Registry) ProcessInlineQueryContext(ctx context.Context, query InlineQueryStruct) {
+	r.log.Debugf("Processing inline query from %s: %s", query.From.Username, query.Query)
+
+	var (
+		waitGroup sync.WaitGroup
+		batches   []*inlineBatch
+		roles     senderRoles
+	)
+
+	messageIn := query.message()
+
+	for _, reg := range r.matchers {
+		im, ok := as[InlineInterface](reg.matcher)
+		if !ok || !r.matchInline(ctx, im, query, &roles) {
+			continue
+		}
+
+		batch := &inlineBatch{results: nil}
+		batches = append(batches, batch)
+
+		waitGroup.Add(1)
+
+		task := func(ctx context.Context) {
+			defer waitGroup.Done()
+			defer r.recoverMatcher(im)
+
+			results, err := r.processInline(ctx, im, query)
+			if err != nil {
+				r.handleError(im, messageIn, err)
+
+				return
+			}
+
+			batch.results = results
+		}
+
+		if err := r.dispatch(ctx, im.Identifier(), task); err != nil {
+			waitGroup.Done()
+			r.handleError(im, messageIn, fmt.Errorf("%w: %w", errNotDispatched, err))
+		}
+	}
+
+	waitGroup.Wait()
+
+	r.answerInlineQuery(pageInlineResults(query, mergeInlineResults(batches), r.inlineCache))
+}
+
+// matchInline reports whether an inline matcher has to be executed for the query: it must be enabled in
+// its global config, not quarantined, the sender must be permitted to use it and DoesMatchInline must
+// return true. Panics are recovered and count as no match.
+func (r *Registry) matchInline(
+	ctx context.Context,
+	im InlineInterface,
+	query InlineQueryStruct,
+	roles *senderRoles,
+) (matched bool) {
+	defer r.recoverMatcher(im)
+
+	if !r.shouldRunMatcher(im, 0) || !im.DoesMatchInline(query) {
+		return false
+	}
+
+	permitted, err := r.checkPermissions(ctx, im, query.message(), roles)
+	if err != nil {
+		r.log.Errorf("Matcher %s will not be executed for inline query: %s", im.Identifier(), err)
+
+		return false
+	}
+
+	return permitted
+}
+
+// processInline calls ProcessInlineQuery, see callMatcher.
+func (r *Registry) processInline(
+	ctx context.Context,
+	im InlineInterface,
+	query InlineQueryStruct,
+) ([]InlineQueryResultStruct, error) {
+	return callMatcher(ctx, r, im.Identifier(), func(ctx context.Context) ([]InlineQueryResultStruct, error) {
+		return im.ProcessInlineQuery(ctx, query)
+	})
+}
+
+// mergeInlineResults flattens the results of all matchers in priority and registration order and sorts
+// them by descending score. Results with an ID already used by a previous result are dropped, as Telegram
+// rejects answers with duplicate IDs.
+func mergeInlineResults(batches []*inlineBatch) []InlineQueryResultStruct {
+	results := []InlineQueryResultStruct{}
+	seen := map[string]bool{}
+
+	for _, batch := range batches {
+		for _, result := range batch.results {
+			if seen[result.ID] {
+				continue
+			}
+
+			seen[result.ID] = true
+
+			results = append(results, result)
+		}
+	}
+
+	slices.SortStableFunc(results, func(a, b InlineQueryResultStruct) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+
+	return results
+}
+
+// pageInlineResults returns the answer to the query with the page of results starting at the query's
+// offset. An invalid offset is treated as the first page.
+func pageInlineResults(
+	query InlineQueryStruct,
+	results []InlineQueryResultStruct,
+	cacheTime time.Duration,
+) InlineAnswerStruct {
+	offset, err := strconv.Atoi(query.Offset)
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	offset = min(offset, len(results))
+	end := min(offset+maxInlineResults, len(results))
+
+	nextOffset := ""
+	if end < len(results) {
+		nextOffset = strconv.Itoa(end)
+	}
+
+	return InlineAnswerStruct{
+		InlineQueryID: query.ID,
+		Results:       results[offset:end],
+		CacheTime:     int(cacheTime / time.Second),
+		IsPersonal:    true,
+		NextOffset:    nextOffset,
+	}
+}
+
+// answerInlineQuery sends the answer if the Telegram client implements InlineAnswererInterface.
+func (r *Registry) answerInlineQuery(answer InlineAnswerStruct) {
+	answerer, ok := r.telegram.(InlineAnswererInterface)
+	if !ok {
+		r.log.Debugf("Inline query %s not answered: client cannot answer inline queries", answer.InlineQueryID)
+
+		return
+	}
+
+	if err := answerer.AnswerInlineQuery(answer); err != nil {
+		r.log.Errorf("Error while answering inline query %s: %s", answer.InlineQueryID, err)
+	}
+}
@@ -0,0 +1,287 @@
+package matcher_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// inlineTelegramClient is a fakeTelegramClient that also records answered inline queries.
+type inlineTelegramClient struct {
+	fakeTelegramClient
+
+	answers []matcher.InlineAnswerStruct
+}
+
+// AnswerInlineQuery records the answer for inspection in tests.
+func (f *inlineTelegramClient) AnswerInlineQuery(answer matcher.InlineAnswerStruct) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.answers = append(f.answers, answer)
+
+	return nil
+}
+
+// searchMatcher answers inline queries starting with its prefix with a fixed number of scored results.
+// The query "boom" panics and "fail" fails.
+type searchMatcher struct {
+	echoMatcher
+
+	prefix string
+	count  int
+	score  float64
+}
+
+// makeSearchMatcher returns a searchMatcher that matches no messages.
+func makeSearchMatcher(identifier string, prefix string, count int, score float64) searchMatcher {
+	return searchMatcher{
+		echoMatcher: echoMatcher{Matcher: matcher.MakeMatcher(identifier, regexp.MustCompile(`^$`), nil)},
+		prefix:      prefix,
+		count:       count,
+		score:       score,
+	}
+}
+
+// DoesMatchInline reports whether the query starts with the matcher's prefix.
+func (m searchMatcher) DoesMatchInline(query matcher.InlineQueryStruct) bool {
+	return strings.HasPrefix(query.Query, m.prefix)
+}
+
+// ProcessInlineQuery returns the matcher's results, with IDs made of its identifier and a counter.
+func (m searchMatcher) ProcessInlineQuery(
+	_ context.Context,
+	query matcher.InlineQueryStruct,
+) ([]matcher.InlineQueryResultStruct, error) {
+	switch query.Query {
+	case "boom":
+		panic("boom")
+	case "fail":
+		return nil, errors.New("failed")
+	}
+
+	results := make([]matcher.InlineQueryResultStruct, 0, m.count)
+
+	for i := range m.count {
+		result := matcher.ArticleResult(m.Identifier()+strconv.Itoa(i), m.Identifier(), query.Query)
+		result.Score = m.score
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// inlineQuery returns a test inline query with the given text and offset.
+func inlineQuery(query string, offset string) matcher.InlineQueryStruct {
+	return matcher.InlineQueryStruct{
+		ID:       "q1",
+		From:     telegramclient.TestWebhookMessageUser(false),
+		Query:    query,
+		Offset:   offset,
+		ChatType: "private",
+	}
+}
+
+// resultIDs returns the IDs of the results of an answer.
+func resultIDs(answer matcher.InlineAnswerStruct) []string {
+	ids := make([]string, 0, len(answer.Results))
+	for _, result := range answer.Results {
+		ids = append(ids, result.ID)
+	}
+
+	return ids
+}
+
+// TestRegistry_ProcessInlineQuery_MergesResults verifies that the results of all matching matchers are
+// merged and ranked by score, keeping the priority order for equal scores.
+func TestRegistry_ProcessInlineQuery_MergesResults(t *testing.T) {
+	t.Parallel()
+
+	client := &inlineTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithInlineCacheTime(time.Minute))
+	reg.Register(makeEchoMatcher("echo"))
+	reg.Register(makeSearchMatcher("a", "", 2, 1))
+	reg.Register(makeSearchMatcher("b", "", 1, 2))
+	reg.Register(makeSearchMatcher("c", "", 1, 1), matcher.WithPriority(10))
+	reg.Register(makeSearchMatcher("d", "other", 1, 5))
+
+	reg.ProcessInlineQuery(inlineQuery("cats", ""))
+
+	require.Len(t, client.answers, 1)
+	assert.Equal(t, []string{"b0", "c0", "a0", "a1"}, resultIDs(client.answers[0]))
+	assert.Equal(t, "q1", client.answers[0].InlineQueryID)
+	assert.Equal(t, 60, client.answers[0].CacheTime)
+	assert.Empty(t, client.answers[0].NextOffset)
+	assert.Empty(t, client.sentTexts())
+}
+
+// TestRegistry_ProcessInlineQuery_Pages verifies that answers contain at most 50 results and that the
+// offset selects the page.
+func TestRegistry_ProcessInlineQuery_Pages(t *testing.T) {
+	t.Parallel()
+
+	client := &inlineTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client)
+	reg.Register(makeSearchMatcher("a", "", 70, 0))
+	reg.Register(makeSearchMatcher("b", "", 50, 0))
+
+	reg.ProcessInlineQuery(inlineQuery("cats", ""))
+	reg.ProcessInlineQuery(inlineQuery("cats", "50"))
+	reg.ProcessInlineQuery(inlineQuery("cats", "100"))
+	reg.ProcessInlineQuery(inlineQuery("cats", "invalid"))
+	reg.ProcessInlineQuery(inlineQuery("cats", "500"))
+
+	require.Len(t, client.answers, 5)
+	assert.Len(t, client.answers[0].Results, 50)
+	assert.Equal(t, "50", client.answers[0].NextOffset)
+	assert.Equal(t, "a50", client.answers[1].Results[0].ID)
+	assert.Equal(t, "b29", client.answers[1].Results[49].ID)
+	assert.Equal(t, "100", client.answers[1].NextOffset)
+	assert.Len(t, client.answers[2].Results, 20)
+	assert.Empty(t, client.answers[2].NextOffset)
+	assert.Equal(t, resultIDs(client.answers[0]), resultIDs(client.answers[3]))
+	assert.Empty(t, client.answers[4].Results)
+}
+
+// TestRegistry_ProcessInlineQuery_Errors verifies that failing matchers contribute no results while the
+// query is still answered, and that duplicate result IDs are dropped.
+func TestRegistry_ProcessInlineQuery_Errors(t *testing.T) {
+	t.Parallel()
+
+	client := &inlineTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithPanicThreshold(1))
+	reg.Register(makeSearchMatcher("a", "", 1, 0))
+	reg.Register(makeSearchMatcher("a", "", 2, 0))
+	reg.Register(makeSearchMatcher("b", "b", 1, 0))
+
+	reg.ProcessInlineQuery(inlineQuery("fail", ""))
+	reg.ProcessInlineQuery(inlineQuery("cats", ""))
+	reg.ProcessInlineQuery(inlineQuery("boom", ""))
+
+	require.Len(t, client.answers, 3)
+	assert.Empty(t, client.answers[0].Results)
+	assert.Equal(t, []string{"a0", "a1"}, resultIDs(client.answers[1]))
+	assert.Empty(t, client.answers[2].Results)
+	assert.True(t, reg.IsQuarantined("a"))
+}
+
+// TestRegistry_ProcessInlineQuery_Concurrent verifies that matchers are executed concurrently.
+func TestRegistry_ProcessInlineQuery_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	client := &inlineTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client)
+
+	var started sync.WaitGroup
+
+	started.Add(2)
+
+	for _, identifier := range []string{"a", "b"} {
+		reg.Register(blockingSearchMatcher{searchMatcher: makeSearchMatcher(identifier, "", 1, 0), started: &started})
+	}
+
+	reg.ProcessInlineQuery(inlineQuery("cats", ""))
+
+	require.Len(t, client.answers, 1)
+	assert.Equal(t, []string{"a0", "b0"}, resultIDs(client.answers[0]))
+}
+
+// blockingSearchMatcher is a searchMatcher that waits until all blocking matchers have started.
+type blockingSearchMatcher struct {
+	searchMatcher
+
+	started *sync.WaitGroup
+}
+
+// ProcessInlineQuery waits for the other matchers before returning its results.
+func (m blockingSearchMatcher) ProcessInlineQuery(
+	ctx context.Context,
+	query matcher.InlineQueryStruct,
+) ([]matcher.InlineQueryResultStruct, error) {
+	m.started.Done()
+	m.started.Wait()
+
+	return m.searchMatcher.ProcessInlineQuery(ctx, query)
+}
+
+// hungSearchMatcher is a searchMatcher whose ProcessInlineQuery ignores its context and blocks until
+// release is closed.
+type hungSearchMatcher struct {
+	searchMatcher
+
+	release chan struct{}
+}
+
+// ProcessInlineQuery blocks until the matcher is released.
+func (m hungSearchMatcher) ProcessInlineQuery(
+	ctx context.Context,
+	query matcher.InlineQueryStruct,
+) ([]matcher.InlineQueryResultStruct, error) {
+	<-m.release
+
+	return m.searchMatcher.ProcessInlineQuery(ctx, query)
+}
+
+// recordingSearchMatcher is a searchMatcher recording all errors passed to HandleError.
+type recordingSearchMatcher struct {
+	searchMatcher
+	*errorRecorder
+}
+
+// HandleError records the error.
+func (m recordingSearchMatcher) HandleError(messageIn telegramclient.WebhookMessageStruct, identifier string, err error) {
+	m.errorRecorder.HandleError(messageIn, identifier, err)
+}
+
+// TestRegistry_ProcessInlineQuery_NotDispatched verifies that matchers that could not be dispatched are
+// reported to their HandleError while the query is still answered.
+func TestRegistry_ProcessInlineQuery_NotDispatched(t *testing.T) {
+	t.Parallel()
+
+	client := &inlineTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithWorkerPool(1, 1))
+
+	m := recordingSearchMatcher{searchMatcher: makeSearchMatcher("a", "", 1, 0), errorRecorder: &errorRecorder{}}
+	reg.Register(m)
+
+	reg.Close()
+	reg.ProcessInlineQuery(inlineQuery("cats", ""))
+
+	require.Len(t, client.answers, 1)
+	assert.Empty(t, client.answers[0].Results)
+
+	handled := m.handledErrors()
+	require.Len(t, handled, 1)
+	assert.Contains(t, handled[0].Error(), "could not be dispatched")
+}
+
+// TestRegistry_ProcessInlineQuery_Deadline verifies that a matcher ignoring its deadline is abandoned, so
+// the query is still answered with the results of the other matchers.
+func TestRegistry_ProcessInlineQuery_Deadline(t *testing.T) {
+	t.Parallel()
+
+	client := &inlineTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithMatcherTimeout("hung", 20*time.Millisecond))
+
+	hung := hungSearchMatcher{searchMatcher: makeSearchMatcher("hung", "", 1, 0), release: make(chan struct{})}
+	defer close(hung.release)
+
+	reg.Register(hung)
+	reg.Register(makeSearchMatcher("a", "", 1, 0))
+
+	reg.ProcessInlineQuery(inlineQuery("cats", ""))
+
+	require.Len(t, client.answers, 1)
+	assert.Equal(t, []string{"a0"}, resultIDs(client.answers[0]))
+}
@@ -1,6 +1,8 @@
 package matcher
 
 import (
+	"context"
+
 	telegramclient "github.com/br0-space/bot-telegramclient"
 )
 
@@ -14,3 +16,46 @@ type Interface interface {
 	Process(messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error)
 	HandleError(messageIn telegramclient.WebhookMessageStruct, identifier string, err error)
 }
+
+// ChatAwareInterface is an optional extension of Interface for matchers whose enabled state
+// can differ per chat. The Registry prefers IsEnabledFor over IsEnabled when it is implemented.
+// The base Matcher implements it, so every matcher embedding it supports per-chat configs.
+type ChatAwareInterface interface {
+	IsEnabledFor(chatID int64) bool
+}
+
+// ContextInterface is an optional extension of Interface for matchers that support cancellation.
+// The Registry calls ProcessContext instead of Process when it is implemented and cancels ctx once
+// the matcher's deadline expires. Existing matchers are adapted automatically, see AdaptContext.
+type ContextInterface interface {
+	Interface
+	ProcessContext(ctx context.Context, messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error)
+}
+
+// WrapperInterface is an optional extension of Interface for matchers wrapping another matcher, like
+// ReloadingMatcher. The Registry looks up optional extensions the wrapper does not implement itself on the
+// wrapped matcher, so wrappers only need to implement Interface and the extensions they change.
+type WrapperInterface interface {
+	Unwrap() Interface
+}
+
+// as returns m as T if it implements T, or otherwise the first matcher implementing T it wraps, see
+// WrapperInterface.
+func as[T any](m Interface) (T, bool) {
+	for m != nil {
+		if t, ok := m.(T); ok {
+			return t, true
+		}
+
+		w, ok := m.(WrapperInterface)
+		if !ok {
+			break
+		}
+
+		m = w.Unwrap()
+	}
+
+	var zero T
+
+	return zero, false
+}
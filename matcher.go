@@ -2,22 +2,36 @@ package matcher
 
 import (
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
 
 	logger "github.com/br0-space/bot-logger"
 	telegramclient "github.com/br0-space/bot-telegramclient"
 )
 
 type Matcher struct {
-	log        logger.Interface
-	identifier string
-	regexp     *regexp.Regexp
-	help       []HelpStruct
-	cfg        *Config
+	log         logger.Interface
+	identifier  string
+	regexp      *regexp.Regexp
+	help        []HelpStruct
+	cfg         *Config
+	chatCfgs    map[int64]*Config
+	cooldowns   Cooldowns
+	permissions Permissions
+	storage     *storageSlot
+	kinds       []UpdateKind
 }
 
 type Config struct {
-	enabled *bool
+	enabled     *bool
+	cooldowns   *cooldownsConfig
+	permissions *permissionsConfig
+}
+
+// isEnabled reports whether the config enables the matcher, defaulting to true if unset.
+func (c Config) isEnabled() bool {
+	return c.enabled == nil || *c.enabled
 }
 
 type HelpStruct struct {
@@ -35,11 +49,16 @@ func MakeMatcher(
 	help []HelpStruct,
 ) Matcher {
 	return Matcher{
-		log:        logger.New(),
-		identifier: identifier,
-		regexp:     pattern,
-		help:       help,
-		cfg:        nil,
+		log:         logger.New(),
+		identifier:  identifier,
+		regexp:      pattern,
+		help:        help,
+		cfg:         nil,
+		chatCfgs:    nil,
+		cooldowns:   Cooldowns{},
+		permissions: Permissions{Allow: nil, Deny: nil},
+		storage:     &storageSlot{mu: sync.RWMutex{}, storage: nil},
+		kinds:       nil,
 	}
 }
 
@@ -50,6 +69,19 @@ func (m Matcher) WithConfig(cfg *Config) Matcher {
 	return m
 }
 
+// WithChatConfigs returns a copy of the Matcher with the provided per-chat configurations applied.
+// The entry stored under chatID 0 is used as the fallback config, matching the layout returned
+// by LoadMatcherConfig.
+func (m Matcher) WithChatConfigs(cfgs map[int64]*Config) Matcher {
+	m.chatCfgs = cfgs
+
+	if cfg, ok := cfgs[0]; ok {
+		m.cfg = cfg
+	}
+
+	return m
+}
+
 func (m Matcher) Config() Config {
 	if m.cfg == nil {
 		return Config{}
@@ -58,10 +90,41 @@ func (m Matcher) Config() Config {
 	return *m.cfg
 }
 
+// ConfigFor returns the config for the given chat.
+// If there is no chat-specific config, it falls back to Config.
+func (m Matcher) ConfigFor(chatID int64) Config {
+	if cfg, ok := m.chatCfgs[chatID]; ok && cfg != nil {
+		return *cfg
+	}
+
+	return m.Config()
+}
+
+// ConfiguredChatIDs returns the sorted IDs of the chats with a chat-specific config.
+func (m Matcher) ConfiguredChatIDs() []int64 {
+	chatIDs := make([]int64, 0, len(m.chatCfgs))
+
+	for chatID := range m.chatCfgs {
+		if chatID != 0 {
+			chatIDs = append(chatIDs, chatID)
+		}
+	}
+
+	slices.Sort(chatIDs)
+
+	return chatIDs
+}
+
 // IsEnabled reports whether the matcher is enabled.
 // If no config is present or the enabled flag is not set, it defaults to true.
 func (m Matcher) IsEnabled() bool {
-	return m.Config().enabled != nil && *m.Config().enabled || m.Config().enabled == nil // default to true
+	return m.Config().isEnabled()
+}
+
+// IsEnabledFor reports whether the matcher is enabled in the given chat.
+// It uses the chat-specific config if present and falls back to IsEnabled otherwise.
+func (m Matcher) IsEnabledFor(chatID int64) bool {
+	return m.ConfigFor(chatID).isEnabled()
 }
 
 // Identifier returns the unique identifier of the matcher.
@@ -96,6 +159,7 @@ func (m Matcher) CommandMatch(messageIn telegramclient.WebhookMessageStruct) []s
 
 // InlineMatches returns all matches of the pattern in the message's text or caption.
 // The returned matches are trimmed and an empty slice is returned if there are none.
+// It is unrelated to inline queries, see InlineInterface.
 func (m Matcher) InlineMatches(messageIn telegramclient.WebhookMessageStruct) []string {
 	matches := m.regexp.FindAllString(messageIn.TextOrCaption(), -1)
 	if matches == nil {
@@ -121,7 +185,8 @@ func (m Matcher) HandleError(_ telegramclient.WebhookMessageStruct, identifier s
 type WithCustomConfigType[T any] struct {
 	Matcher
 
-	cfg T
+	cfg  T
+	cfgs map[int64]T
 }
 
 // MakeMatcherWithCustomConfigType constructs a new MatcherWithCustomConfig[T] matcher from the given base inputs
@@ -149,7 +214,42 @@ func (m WithCustomConfigType[T]) WithTypedConfig(cfg T) WithCustomConfigType[T]
 	return m
 }
 
+// WithTypedConfigs returns a copy with the per-chat typed configs applied, as returned by
+// LoadMatcherConfig. The entry under chatID 0 becomes the fallback config. If T embeds
+// matcher.Config, the base Matcher is wired per chat as well so IsEnabledFor works.
+func (m WithCustomConfigType[T]) WithTypedConfigs(cfgs map[int64]T) WithCustomConfigType[T] {
+	if cfg, ok := cfgs[0]; ok {
+		m = m.WithTypedConfig(cfg)
+	}
+
+	m.cfgs = cfgs
+
+	chatCfgs := make(map[int64]*Config, len(cfgs))
+
+	for chatID, cfg := range cfgs {
+		if c, ok := any(&cfg).(interface{ GetEmbeddedMatcherConfigPtr() *Config }); ok {
+			chatCfgs[chatID] = c.GetEmbeddedMatcherConfigPtr()
+		}
+	}
+
+	if len(chatCfgs) > 0 {
+		m.Matcher = m.WithChatConfigs(chatCfgs)
+	}
+
+	return m
+}
+
 // Config returns the typed configuration value.
 func (m WithCustomConfigType[T]) Config() T {
 	return m.cfg
 }
+
+// ConfigFor returns the typed configuration for the given chat.
+// If there is no chat-specific config, it falls back to Config.
+func (m WithCustomConfigType[T]) ConfigFor(chatID int64) T {
+	if cfg, ok := m.cfgs[chatID]; ok {
+		return cfg
+	}
+
+	return m.cfg
+}
@@ -210,3 +210,51 @@ func TestWithCustomConfigType_WithTypedConfig_Immutable(t *testing.T) {
 	assert.True(t, m0.IsEnabled())
 	assert.False(t, m1.IsEnabled())
 }
+
+// TestMatcher_IsEnabledFor_PerChatConfigs verifies that chat-specific configs take precedence
+// and that chats without an entry fall back to the config stored under key 0.
+func TestMatcher_IsEnabledFor_PerChatConfigs(t *testing.T) {
+	t.Parallel()
+
+	trueVal := true
+	falseVal := false
+
+	fallback := &matcher.Config{}
+	setConfigEnabled(fallback, &trueVal)
+
+	disabled := &matcher.Config{}
+	setConfigEnabled(disabled, &falseVal)
+
+	m := matcher.MakeMatcher("id", regexp.MustCompile(`.`), nil).
+		WithChatConfigs(map[int64]*matcher.Config{0: fallback, 123: disabled})
+
+	assert.True(t, m.IsEnabled())
+	assert.True(t, m.IsEnabledFor(0))
+	assert.False(t, m.IsEnabledFor(123))
+	assert.True(t, m.IsEnabledFor(456)) // no entry -> fallback
+	assert.Equal(t, *disabled, m.ConfigFor(123))
+	assert.Equal(t, *fallback, m.ConfigFor(456))
+}
+
+// TestWithCustomConfigType_WithTypedConfigs verifies that per-chat typed configs are returned by
+// ConfigFor and wire the base matcher's IsEnabledFor.
+func TestWithCustomConfigType_WithTypedConfigs(t *testing.T) {
+	t.Parallel()
+
+	falseVal := false
+	chatCfg := embeddingCfg{Flag: "chat"}
+	setConfigEnabled(&chatCfg.Config, &falseVal)
+
+	fallback := embeddingCfg{Flag: "fallback"}
+
+	m := matcher.MakeMatcherWithCustomConfigType("x", regexp.MustCompile(`.`), nil, embeddingCfg{}).
+		WithTypedConfigs(map[int64]embeddingCfg{0: fallback, 123: chatCfg})
+
+	assert.Equal(t, fallback, m.Config())
+	assert.Equal(t, fallback, m.ConfigFor(456))
+	assert.Equal(t, chatCfg, m.ConfigFor(123))
+
+	assert.True(t, m.IsEnabled())
+	assert.True(t, m.IsEnabledFor(456))
+	assert.False(t, m.IsEnabledFor(123))
+}
@@ -0,0 +1,288 @@
+// Package admin provides a ready-made matcher for the /matcher command, which lets chat admins list, enable,
+// disable and configure matchers in their chat at runtime. Changes are written to the per-chat config files,
+// so they survive a restart.
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+)
+
+// identifier is the unique name of this matcher.
+const identifier = "admin"
+
+// pattern matches /matcher, optionally with a bot username suffix and arguments.
+var pattern = regexp.MustCompile(`(?i)^/(matcher)(@\w+)?($| )`)
+
+// help describes how to use this matcher and can be rendered in help messages.
+var help = []matcher.HelpStruct{{
+	Command:     "matcher",
+	Description: "Lists, enables, disables or configures matchers in this chat (admins only)",
+	Usage:       "/matcher list | enable <matcher> | disable <matcher> | set <matcher> <key> <value>",
+	Example:     `/matcher set configurable reply "Hello there"`,
+}}
+
+const (
+	listTemplate   = "*Matchers in this chat*\n\n%s"
+	enabledLine    = "✅ %s"
+	disabledLine   = "❌ %s"
+	enabledReply   = "Matcher %s is now enabled in this chat."
+	disabledReply  = "Matcher %s is now disabled in this chat."
+	setReply       = "Set %s of matcher %s to %q in this chat."
+	unknownMatcher = "Unknown matcher %s. Use /matcher list to list all matchers."
+	cannotDisable  = "The admin matcher cannot be disabled."
+	notAuthorized  = "⛔ Only chat admins can change matcher settings."
+)
+
+var (
+	// errUnknownAction is returned for actions other than list, enable, disable and set.
+	errUnknownAction = errors.New("unknown action")
+	// errMissingArguments is returned when an action lacks its arguments.
+	errMissingArguments = errors.New("missing arguments")
+	// errTooManyArguments is returned when an action is given more arguments than it takes.
+	errTooManyArguments = errors.New("too many arguments")
+)
+
+// Source provides the matchers that can be managed. *matcher.Registry implements it.
+type Source interface {
+	Matchers() []matcher.Interface
+	IsEnabledFor(m matcher.Interface, chatID int64) bool
+}
+
+// Store persists per-chat matcher settings. *matcher.ConfigStore implements it.
+type Store interface {
+	SetEnabled(identifier string, chatID int64, enabled bool) error
+	Set(identifier string, chatID int64, key string, value any) error
+}
+
+// Matcher is the /matcher matcher. It embeds the base matcher and manages the matchers of its Source,
+// persisting changes in its Store.
+type Matcher struct {
+	matcher.Matcher
+
+	source   Source
+	store    Store
+	resolver matcher.RoleResolverInterface
+}
+
+// args are the arguments of the /matcher command.
+type args struct {
+	Action  string `command:"arg,required"`
+	Matcher string `command:"arg"`
+	Key     string `command:"arg"`
+	Value   string `command:"arg"`
+}
+
+// MakeMatcher constructs a new admin.Matcher managing the matchers of the given source, usually the Registry
+// it is registered with, and persisting changes in the given store, usually the ConfigStore registered
+// with the same Registry. Without WithRoleResolver or WithAllowedUsers, changes are only allowed in
+// private chats.
+func MakeMatcher(source Source, store Store) Matcher {
+	return Matcher{
+		Matcher:  matcher.MakeMatcher(identifier, pattern, help),
+		source:   source,
+		store:    store,
+		resolver: nil,
+	}
+}
+
+// WithRoleResolver returns a copy of the Matcher that allows users with matcher.RoleAdmin, as resolved by
+// the given resolver, to change settings, e.g. the resolver registered with the Registry or a
+// matcher.AdministratorResolver.
+func (m Matcher) WithRoleResolver(resolver matcher.RoleResolverInterface) Matcher {
+	m.resolver = resolver
+
+	return m
+}
+
+// WithAllowedUsers returns a copy of the Matcher that additionally allows the given users to change
+// settings in any chat.
+func (m Matcher) WithAllowedUsers(userIDs ...int64) Matcher {
+	allowed := matcher.NewStaticRoleResolver(map[int64]map[matcher.Role][]int64{0: {matcher.RoleAdmin: userIDs}})
+
+	if m.resolver == nil {
+		m.resolver = allowed
+	} else {
+		m.resolver = matcher.CombineRoleResolvers(m.resolver, allowed)
+	}
+
+	return m
+}
+
+// Process handles the /matcher command. It is a shortcut for ProcessContext with a background context.
+func (m Matcher) Process(messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+	return m.ProcessContext(context.Background(), messageIn)
+}
+
+// ProcessContext handles the /matcher command. Listing the matchers is allowed for everyone, changes
+// are restricted to authorized users, see MakeMatcher. The administrator lookup stops once ctx is done.
+func (m Matcher) ProcessContext(
+	ctx context.Context,
+	messageIn telegramclient.WebhookMessageStruct,
+) ([]telegramclient.MessageStruct, error) {
+	if !m.DoesMatch(messageIn) {
+		return nil, errors.New("message does not match")
+	}
+
+	var a args
+	if _, err := m.ParseCommand(messageIn, &a); err != nil {
+		return usageReply(messageIn, err)
+	}
+
+	action := strings.ToLower(a.Action)
+	if action == "list" {
+		return reply(messageIn, m.list(messageIn.Chat.ID)), nil
+	}
+
+	if action != "enable" && action != "disable" && action != "set" {
+		return usageReply(messageIn, fmt.Errorf("%w %q", errUnknownAction, a.Action))
+	}
+
+	switch {
+	case a.Matcher == "" || action == "set" && (a.Key == "" || a.Value == ""):
+		return usageReply(messageIn, fmt.Errorf("%w for %s", errMissingArguments, action))
+	case action != "set" && a.Key != "":
+		return usageReply(messageIn, fmt.Errorf("%w for %s", errTooManyArguments, action))
+	case action == "set" && !matcher.ConfigKeyPattern.MatchString(strings.ToLower(a.Key)):
+		return usageReply(messageIn, fmt.Errorf("%w %q", matcher.ErrInvalidConfigKey, a.Key))
+	}
+
+	authorized, err := m.isAuthorized(ctx, messageIn)
+	if err != nil {
+		return nil, err
+	}
+
+	if !authorized {
+		return reply(messageIn, telegramclient.EscapeMarkdown(notAuthorized)), nil
+	}
+
+	target, ok := m.find(a.Matcher)
+	if !ok {
+		return reply(messageIn, telegramclient.EscapeMarkdown(fmt.Sprintf(unknownMatcher, a.Matcher))), nil
+	}
+
+	return m.change(messageIn, target, action, strings.ToLower(a.Key), a.Value)
+}
+
+// change applies an enable, disable or set action to the target matcher in the message's chat.
+func (m Matcher) change(
+	messageIn telegramclient.WebhookMessageStruct,
+	target string,
+	action string,
+	key string,
+	value string,
+) ([]telegramclient.MessageStruct, error) {
+	chatID := messageIn.Chat.ID
+
+	if action == "set" && key == "enabled" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return usageReply(messageIn, fmt.Errorf("invalid value %q for enabled: use true or false", value))
+		}
+
+		action = "disable"
+		if enabled {
+			action = "enable"
+		}
+	}
+
+	var text string
+
+	switch action {
+	case "enable":
+		if err := m.store.SetEnabled(target, chatID, true); err != nil {
+			return nil, err
+		}
+
+		text = fmt.Sprintf(enabledReply, target)
+	case "disable":
+		if target == m.Identifier() {
+			return reply(messageIn, telegramclient.EscapeMarkdown(cannotDisable)), nil
+		}
+
+		if err := m.store.SetEnabled(target, chatID, false); err != nil {
+			return nil, err
+		}
+
+		text = fmt.Sprintf(disabledReply, target)
+	default:
+		if err := m.store.Set(target, chatID, key, value); err != nil {
+			return nil, err
+		}
+
+		text = fmt.Sprintf(setReply, key, target, value)
+	}
+
+	return reply(messageIn, telegramclient.EscapeMarkdown(text)), nil
+}
+
+// list renders all matchers of the source with their enabled state in the given chat.
+func (m Matcher) list(chatID int64) string {
+	lines := []string{}
+
+	for _, mm := range m.source.Matchers() {
+		line := disabledLine
+		if m.source.IsEnabledFor(mm, chatID) {
+			line = enabledLine
+		}
+
+		lines = append(lines, telegramclient.EscapeMarkdown(fmt.Sprintf(line, mm.Identifier())))
+	}
+
+	return fmt.Sprintf(listTemplate, strings.Join(lines, "\n"))
+}
+
+// find returns the identifier of the matcher with the given identifier (case-insensitive).
+func (m Matcher) find(name string) (string, bool) {
+	for _, mm := range m.source.Matchers() {
+		if strings.EqualFold(mm.Identifier(), name) {
+			return mm.Identifier(), true
+		}
+	}
+
+	return "", false
+}
+
+// isAuthorized reports whether the sender may change settings in the message's chat: in private chats, or
+// if the resolver grants the sender matcher.RoleAdmin in the chat.
+func (m Matcher) isAuthorized(ctx context.Context, messageIn telegramclient.WebhookMessageStruct) (bool, error) {
+	if messageIn.Chat.Type == "private" {
+		return true, nil
+	}
+
+	if m.resolver == nil {
+		return false, nil
+	}
+
+	roles, err := m.resolver.RolesFor(ctx, messageIn.Chat.ID, messageIn.From.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve roles: %w", err)
+	}
+
+	return slices.Contains(roles, matcher.RoleAdmin), nil
+}
+
+// usageReply renders err as a usage reply built from the matcher's help entry.
+func usageReply(messageIn telegramclient.WebhookMessageStruct, err error) ([]telegramclient.MessageStruct, error) {
+	var usageErr *matcher.UsageError
+	if !errors.As(err, &usageErr) {
+		usageErr = &matcher.UsageError{Command: "matcher", Help: help, Err: err}
+	}
+
+	return []telegramclient.MessageStruct{usageErr.Reply(messageIn.ID)}, nil
+}
+
+// reply wraps the given Markdown text into a reply to the incoming message.
+func reply(messageIn telegramclient.WebhookMessageStruct, text string) []telegramclient.MessageStruct {
+	return []telegramclient.MessageStruct{
+		telegramclient.MarkdownReply(text, messageIn.ID),
+	}
+}
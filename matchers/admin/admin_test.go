@@ -0,0 +1,242 @@
+// Package admin_test contains tests for the admin matcher.
+package admin_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	"github.com/br0-space/bot-matcher/examples/ping"
+	"github.com/br0-space/bot-matcher/matchers/admin"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// administrators is a fake matcher.ChatAdministratorsInterface returning a fixed list of user IDs or an error.
+type administrators struct {
+	ids []int64
+	err error
+}
+
+// ChatAdministrators returns the configured user IDs or error.
+func (a administrators) ChatAdministrators(_ int64) ([]int64, error) {
+	return a.ids, a.err
+}
+
+// newAdminMatcher returns an admin matcher managing a registry with the admin and ping matchers, backed
+// by a ConfigStore in a temporary directory, along with the registry and the store.
+func newAdminMatcher(t *testing.T, configure func(admin.Matcher) admin.Matcher) (admin.Matcher, *matcher.Registry, *matcher.ConfigStore) {
+	t.Helper()
+
+	store := matcher.NewConfigStore(matcher.WithDir(t.TempDir()))
+	reg := matcher.NewRegistry(logger.New(), telegramclient.NewMockClient(), matcher.WithConfigStore(store))
+	m := configure(admin.MakeMatcher(reg, store))
+
+	reg.Register(m)
+	reg.Register(ping.MakeMatcher())
+
+	return m, reg, store
+}
+
+// process runs the admin matcher for the given text sent by a user in a chat of the given type and returns
+// the reply text.
+func process(t *testing.T, m admin.Matcher, text string, chatType string) string {
+	t.Helper()
+
+	msg := telegramclient.TestWebhookMessage(text)
+	msg.Chat.Type = chatType
+
+	require.True(t, m.DoesMatch(msg))
+
+	replies, err := m.Process(msg)
+	require.NoError(t, err)
+	require.Len(t, replies, 1)
+	assert.Equal(t, int64(123), replies[0].ReplyToMessageID)
+
+	return replies[0].Text
+}
+
+// TestMatcher_DoesMatch ensures that the matcher only responds to /matcher.
+func TestMatcher_DoesMatch(t *testing.T) {
+	t.Parallel()
+
+	m, _, _ := newAdminMatcher(t, func(m admin.Matcher) admin.Matcher { return m })
+
+	assert.True(t, m.DoesMatch(telegramclient.TestWebhookMessage("/matcher list")))
+	assert.True(t, m.DoesMatch(telegramclient.TestWebhookMessage("/matcher@bot list")))
+	assert.False(t, m.DoesMatch(telegramclient.TestWebhookMessage("/matchers")))
+	assert.False(t, m.DoesMatch(telegramclient.TestWebhookMessage("matcher list")))
+}
+
+// TestMatcher_Process_EnableDisable ensures that changes in private chats are persisted and honored by the
+// registry.
+func TestMatcher_Process_EnableDisable(t *testing.T) {
+	t.Parallel()
+
+	m, reg, store := newAdminMatcher(t, func(m admin.Matcher) admin.Matcher { return m })
+	chatID := telegramclient.TestWebhookMessageChat().ID
+
+	assert.Equal(t, "*Matchers in this chat*\n\n✅ admin\n✅ ping", process(t, m, "/matcher list", "group"))
+
+	assert.Equal(t, "Matcher ping is now disabled in this chat\\.", process(t, m, "/matcher disable PING", "private"))
+	assert.Len(t, reg.MatchersFor(chatID), 1)
+	assert.Equal(t, "*Matchers in this chat*\n\n✅ admin\n❌ ping", process(t, m, "/matcher list", "private"))
+
+	enabled, ok := store.EnabledFor("ping", chatID)
+	assert.True(t, ok)
+	assert.False(t, enabled)
+
+	assert.Equal(t, "Matcher ping is now enabled in this chat\\.", process(t, m, "/matcher set ping enabled true", "private"))
+	assert.Len(t, reg.MatchersFor(chatID), 2)
+
+	assert.Equal(t, "The admin matcher cannot be disabled\\.", process(t, m, "/matcher disable admin", "private"))
+	assert.Equal(t, "Unknown matcher pong\\. Use /matcher list to list all matchers\\.", process(t, m, "/matcher enable pong", "private"))
+}
+
+// TestMatcher_Process_Set ensures that arbitrary keys are written to the per-chat config.
+func TestMatcher_Process_Set(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store := matcher.NewConfigStore(matcher.WithDir(dir))
+	reg := matcher.NewRegistry(logger.New(), telegramclient.NewMockClient())
+	m := admin.MakeMatcher(reg, store)
+
+	reg.Register(m)
+	reg.Register(ping.MakeMatcher())
+
+	assert.Equal(t,
+		"Set reply of matcher ping to \"Hello there\" in this chat\\.",
+		process(t, m, `/matcher set ping Reply "Hello there"`, "private"),
+	)
+
+	content, err := os.ReadFile(filepath.Join(dir, "config", "789", "ping.yml"))
+	require.NoError(t, err)
+	assert.Equal(t, "reply: Hello there\n", string(content))
+
+	assert.Contains(t, process(t, m, "/matcher set ping bad-key x", "private"), "invalid config key")
+}
+
+// TestMatcher_Process_Authorization ensures that changes in groups are restricted to allowlisted users and
+// chat administrators, while listing is allowed for everyone.
+func TestMatcher_Process_Authorization(t *testing.T) {
+	t.Parallel()
+
+	userID := telegramclient.TestWebhookMessageUser(false).ID
+
+	tests := []struct {
+		name      string
+		configure func(admin.Matcher) admin.Matcher
+		want      string
+	}{
+		{
+			name:      "no admins",
+			configure: func(m admin.Matcher) admin.Matcher { return m },
+			want:      "⛔ Only chat admins can change matcher settings\\.",
+		},
+		{
+			name:      "allowlisted",
+			configure: func(m admin.Matcher) admin.Matcher { return m.WithAllowedUsers(1, userID) },
+			want:      "Matcher ping is now disabled in this chat\\.",
+		},
+		{
+			name: "administrator",
+			configure: func(m admin.Matcher) admin.Matcher {
+				return m.WithRoleResolver(matcher.NewAdministratorResolver(administrators{ids: []int64{userID}, err: nil}, time.Minute, nil))
+			},
+			want: "Matcher ping is now disabled in this chat\\.",
+		},
+		{
+			name: "allowlisted besides administrators",
+			configure: func(m admin.Matcher) admin.Matcher {
+				return m.WithRoleResolver(matcher.NewAdministratorResolver(administrators{ids: []int64{1}, err: nil}, time.Minute, nil)).
+					WithAllowedUsers(userID)
+			},
+			want: "Matcher ping is now disabled in this chat\\.",
+		},
+		{
+			name: "other administrators",
+			configure: func(m admin.Matcher) admin.Matcher {
+				return m.WithRoleResolver(matcher.NewAdministratorResolver(administrators{ids: []int64{1}, err: nil}, time.Minute, nil))
+			},
+			want: "⛔ Only chat admins can change matcher settings\\.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			m, _, _ := newAdminMatcher(t, tt.configure)
+
+			assert.Equal(t, tt.want, process(t, m, "/matcher disable ping", "supergroup"))
+			assert.Contains(t, process(t, m, "/matcher list", "supergroup"), "ping")
+		})
+	}
+}
+
+// TestMatcher_Process_AdministratorsError ensures that failing to look up the administrators is an error.
+func TestMatcher_Process_AdministratorsError(t *testing.T) {
+	t.Parallel()
+
+	m, _, _ := newAdminMatcher(t, func(m admin.Matcher) admin.Matcher {
+		return m.WithRoleResolver(matcher.NewAdministratorResolver(administrators{ids: nil, err: errors.New("boom")}, time.Minute, nil))
+	})
+
+	msg := telegramclient.TestWebhookMessage("/matcher disable ping")
+	msg.Chat.Type = "group"
+
+	_, err := m.Process(msg)
+	require.ErrorContains(t, err, "boom")
+}
+
+// hangingAdministrators is a fake matcher.ChatAdministratorsInterface whose lookups never return.
+type hangingAdministrators struct{}
+
+// ChatAdministrators blocks forever.
+func (hangingAdministrators) ChatAdministrators(_ int64) ([]int64, error) {
+	select {}
+}
+
+// TestMatcher_ProcessContext_StopsLookupOnCancel ensures that a hanging administrator lookup is abandoned
+// once the context passed to ProcessContext is done.
+func TestMatcher_ProcessContext_StopsLookupOnCancel(t *testing.T) {
+	t.Parallel()
+
+	m, _, _ := newAdminMatcher(t, func(m admin.Matcher) admin.Matcher {
+		return m.WithRoleResolver(matcher.NewAdministratorResolver(hangingAdministrators{}, time.Minute, nil))
+	})
+
+	msg := telegramclient.TestWebhookMessage("/matcher disable ping")
+	msg.Chat.Type = "group"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := m.ProcessContext(ctx, msg)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// TestMatcher_Process_Usage ensures that invalid commands are answered with the usage.
+func TestMatcher_Process_Usage(t *testing.T) {
+	t.Parallel()
+
+	m, _, _ := newAdminMatcher(t, func(m admin.Matcher) admin.Matcher { return m })
+
+	for _, text := range []string{
+		"/matcher",
+		"/matcher rename ping",
+		"/matcher enable",
+		"/matcher disable ping now",
+		"/matcher set ping reply",
+		"/matcher set ping enabled maybe",
+	} {
+		assert.Contains(t, process(t, m, text, "private"), "/matcher list", text)
+	}
+}
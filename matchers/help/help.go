@@ -0,0 +1,183 @@
+// Package help provides a ready-made matcher for the /help command. It lists the commands of all matchers
+// enabled in the current chat, based on their help entries, and shows usage and examples for a single command.
+package help
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+)
+
+// identifier is the unique name of this matcher.
+const identifier = "help"
+
+// defaultPageSize is the number of commands listed per page unless configured otherwise.
+const defaultPageSize = 20
+
+// pattern matches /help, optionally with a bot username suffix and arguments.
+var pattern = regexp.MustCompile(`(?i)^/(help)(@\w+)?($| )`)
+
+// help describes how to use this matcher and can be rendered in help messages.
+var help = []matcher.HelpStruct{{
+	Command:     "help",
+	Description: "Lists all commands or shows details for a command",
+	Usage:       "/help [command|page]",
+	Example:     "/help ping",
+}}
+
+const (
+	listTemplate    = "*Available commands* \\(page %d/%d\\)\n\n%s\n\n%s"
+	listFooter      = "Use /help <command> for details"
+	nextPageFooter  = " or /help %d for the next page"
+	detailsTemplate = "*/%s*\n%s"
+	noCommands      = "No commands available in this chat."
+	unknownCommand  = "Unknown command /%s. Use /help to list all commands."
+	invalidPage     = "There is no page %d. Use /help to list all commands."
+)
+
+// Source provides the matchers whose help entries are listed. *matcher.Registry implements it.
+type Source interface {
+	MatchersFor(chatID int64) []matcher.Interface
+}
+
+// Matcher is the /help matcher. It embeds the base matcher and lists the help entries of the matchers
+// provided by its Source.
+type Matcher struct {
+	matcher.Matcher
+
+	source   Source
+	pageSize int
+}
+
+// args are the arguments of the /help command.
+type args struct {
+	Topic string `command:"arg"`
+}
+
+// MakeMatcher constructs a new help.Matcher listing the matchers of the given source, usually the Registry
+// it is registered with.
+func MakeMatcher(source Source) Matcher {
+	return Matcher{
+		Matcher:  matcher.MakeMatcher(identifier, pattern, help),
+		source:   source,
+		pageSize: defaultPageSize,
+	}
+}
+
+// WithPageSize returns a copy of the Matcher listing the given number of commands per page.
+func (m Matcher) WithPageSize(pageSize int) Matcher {
+	m.pageSize = max(pageSize, 1)
+
+	return m
+}
+
+// Process handles the /help command. Without arguments or with a page number, it lists the commands of all
+// matchers enabled in the chat. With a command name, it shows the command's description, usage and example.
+func (m Matcher) Process(messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+	if !m.DoesMatch(messageIn) {
+		return nil, errors.New("message does not match")
+	}
+
+	var a args
+	if _, err := m.ParseCommand(messageIn, &a); err != nil {
+		var usageErr *matcher.UsageError
+		if errors.As(err, &usageErr) {
+			return []telegramclient.MessageStruct{usageErr.Reply(messageIn.ID)}, nil
+		}
+
+		return nil, err
+	}
+
+	entries := m.entries(messageIn.Chat.ID)
+
+	topic := strings.TrimPrefix(a.Topic, "/")
+	if topic == "" {
+		return reply(messageIn, m.list(entries, 1)), nil
+	}
+
+	if page, err := strconv.Atoi(topic); err == nil {
+		return reply(messageIn, m.list(entries, page)), nil
+	}
+
+	return reply(messageIn, details(entries, topic)), nil
+}
+
+// entries returns the help entries with a command of all matchers enabled in the chat, sorted by command.
+// A leading slash of the command is removed, as it is added when rendering.
+func (m Matcher) entries(chatID int64) []matcher.HelpStruct {
+	var entries []matcher.HelpStruct
+
+	for _, mm := range m.source.MatchersFor(chatID) {
+		for _, entry := range mm.Help() {
+			entry.Command = strings.TrimPrefix(entry.Command, "/")
+			if entry.Command != "" {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	slices.SortStableFunc(entries, func(a, b matcher.HelpStruct) int {
+		return strings.Compare(strings.ToLower(a.Command), strings.ToLower(b.Command))
+	})
+
+	return entries
+}
+
+// list renders the given page of the command list.
+func (m Matcher) list(entries []matcher.HelpStruct, page int) string {
+	if len(entries) == 0 {
+		return telegramclient.EscapeMarkdown(noCommands)
+	}
+
+	pages := (len(entries) + m.pageSize - 1) / m.pageSize
+	if page < 1 || page > pages {
+		return telegramclient.EscapeMarkdown(fmt.Sprintf(invalidPage, page))
+	}
+
+	lines := make([]string, 0, m.pageSize)
+	for _, entry := range entries[(page-1)*m.pageSize : min(page*m.pageSize, len(entries))] {
+		lines = append(lines, telegramclient.EscapeMarkdown(fmt.Sprintf("/%s – %s", entry.Command, entry.Description)))
+	}
+
+	footer := listFooter
+	if page < pages {
+		footer += fmt.Sprintf(nextPageFooter, page+1)
+	}
+
+	return fmt.Sprintf(listTemplate, page, pages, strings.Join(lines, "\n"), telegramclient.EscapeMarkdown(footer+"."))
+}
+
+// details renders the help entry for the given command.
+func details(entries []matcher.HelpStruct, command string) string {
+	for _, entry := range entries {
+		if !strings.EqualFold(entry.Command, command) {
+			continue
+		}
+
+		lines := []string{telegramclient.EscapeMarkdown(entry.Description)}
+		if entry.Usage != "" {
+			lines = append(lines, "", "*Usage:* "+telegramclient.EscapeMarkdown(entry.Usage))
+		}
+
+		if entry.Example != "" {
+			lines = append(lines, "*Example:* "+telegramclient.EscapeMarkdown(entry.Example))
+		}
+
+		return fmt.Sprintf(detailsTemplate, telegramclient.EscapeMarkdown(entry.Command), strings.Join(lines, "\n"))
+	}
+
+	return telegramclient.EscapeMarkdown(fmt.Sprintf(unknownCommand, command))
+}
+
+// reply wraps the given Markdown text into a reply to the incoming message.
+func reply(messageIn telegramclient.WebhookMessageStruct, text string) []telegramclient.MessageStruct {
+	return []telegramclient.MessageStruct{
+		telegramclient.MarkdownReply(text, messageIn.ID),
+	}
+}
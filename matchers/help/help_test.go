@@ -0,0 +1,179 @@
+// Package help_test contains tests for the help matcher.
+package help_test
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	"github.com/br0-space/bot-matcher/examples/null"
+	"github.com/br0-space/bot-matcher/examples/ping"
+	"github.com/br0-space/bot-matcher/matchers/help"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// disabledInChat wraps the ping matcher and disables it in a single chat.
+type disabledInChat struct {
+	ping.Matcher
+
+	chatID int64
+}
+
+// IsEnabledFor disables the matcher in the configured chat.
+func (m disabledInChat) IsEnabledFor(chatID int64) bool {
+	return chatID != m.chatID
+}
+
+// commandMatcher is a matcher with a single help entry for the given command.
+type commandMatcher struct {
+	matcher.Matcher
+}
+
+// Process is never called in these tests.
+func (m commandMatcher) Process(_ telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+	return nil, nil
+}
+
+// newHelpMatcher returns a help matcher listing the matchers of a registry with the help, ping and null
+// matchers and the given extra matchers registered.
+func newHelpMatcher(pageSize int, extra ...matcher.Interface) help.Matcher {
+	reg := matcher.NewRegistry(logger.New(), telegramclient.NewMockClient())
+	m := help.MakeMatcher(reg).WithPageSize(pageSize)
+
+	reg.Register(m)
+	reg.Register(disabledInChat{Matcher: ping.MakeMatcher(), chatID: 1})
+	reg.Register(null.MakeMatcher())
+
+	for _, e := range extra {
+		reg.Register(e)
+	}
+
+	return m
+}
+
+// process runs the help matcher for the given text in the given chat and returns the reply text.
+func process(t *testing.T, m help.Matcher, text string, chatID int64) string {
+	t.Helper()
+
+	msg := telegramclient.TestWebhookMessage(text)
+	msg.Chat.ID = chatID
+
+	require.True(t, m.DoesMatch(msg))
+
+	replies, err := m.Process(msg)
+	require.NoError(t, err)
+	require.Len(t, replies, 1)
+	assert.Equal(t, int64(123), replies[0].ReplyToMessageID)
+	assert.Equal(t, "MarkdownV2", replies[0].ParseMode)
+
+	return replies[0].Text
+}
+
+// TestMatcher_DoesMatch ensures that the matcher only responds to /help.
+func TestMatcher_DoesMatch(t *testing.T) {
+	t.Parallel()
+
+	m := newHelpMatcher(20)
+
+	for in, expected := range map[string]bool{
+		"":              false,
+		"help":          false,
+		"/helpme":       false,
+		"/help":         true,
+		"/help ping":    true,
+		"/help@bot":     true,
+		"/help@bot foo": true,
+	} {
+		assert.Equal(t, expected, m.DoesMatch(telegramclient.TestWebhookMessage(in)), in)
+	}
+}
+
+// TestMatcher_Process_List verifies that all enabled matchers with a command are listed.
+func TestMatcher_Process_List(t *testing.T) {
+	t.Parallel()
+
+	m := newHelpMatcher(20)
+
+	text := process(t, m, "/help", 789)
+	assert.Equal(t, "*Available commands* \\(page 1/1\\)\n\n"+
+		"/help – Lists all commands or shows details for a command\n"+
+		"/ping – Responds with \"pong\"\n\n"+
+		"Use /help <command\\> for details\\.", text)
+
+	// ping is disabled in chat 1
+	text = process(t, m, "/help", 1)
+	assert.NotContains(t, text, "/ping")
+	assert.Contains(t, text, "/help")
+}
+
+// TestMatcher_Process_Pagination verifies that long lists are split into pages.
+func TestMatcher_Process_Pagination(t *testing.T) {
+	t.Parallel()
+
+	extra := make([]matcher.Interface, 0, 3)
+	for i := range 3 {
+		command := fmt.Sprintf("cmd%d", i)
+		extra = append(extra, commandMatcher{Matcher: matcher.MakeMatcher(command, regexp.MustCompile(`^$`), []matcher.HelpStruct{{
+			Command:     command,
+			Description: "Command " + command,
+		}})})
+	}
+
+	m := newHelpMatcher(2, extra...)
+
+	page1 := process(t, m, "/help", 789)
+	assert.Contains(t, page1, "page 1/3")
+	assert.Contains(t, page1, "/cmd0")
+	assert.Contains(t, page1, "/cmd1")
+	assert.NotContains(t, page1, "/cmd2")
+	assert.Contains(t, page1, "or /help 2 for the next page")
+
+	page3 := process(t, m, "/help 3", 789)
+	assert.Contains(t, page3, "page 3/3")
+	assert.Contains(t, page3, "/ping")
+	assert.NotContains(t, page3, "next page")
+
+	assert.Contains(t, process(t, m, "/help 4", 789), "There is no page 4")
+}
+
+// TestMatcher_Process_Details verifies the details of a single command.
+func TestMatcher_Process_Details(t *testing.T) {
+	t.Parallel()
+
+	m := newHelpMatcher(20)
+
+	assert.Equal(t, "*/ping*\nResponds with \"pong\"\n\n*Usage:* /ping\n*Example:* /ping", process(t, m, "/help /ping", 789))
+	assert.Contains(t, process(t, m, "/help PING", 789), "*/ping*")
+
+	// disabled in chat 1
+	assert.Contains(t, process(t, m, "/help ping", 1), "Unknown command /ping")
+}
+
+// TestMatcher_Process_SlashCommand verifies that commands declared with a leading slash are listed and
+// found like commands without one.
+func TestMatcher_Process_SlashCommand(t *testing.T) {
+	t.Parallel()
+
+	m := newHelpMatcher(20, commandMatcher{Matcher: matcher.MakeMatcher("karma", regexp.MustCompile(`^$`), []matcher.HelpStruct{{
+		Command:     "/karma",
+		Description: "Shows karma",
+	}})})
+
+	text := process(t, m, "/help", 789)
+	assert.Contains(t, text, "\n/karma – Shows karma")
+	assert.NotContains(t, text, "//karma")
+	assert.Contains(t, process(t, m, "/help karma", 789), "*/karma*")
+}
+
+// TestMatcher_Process_TooManyArguments verifies that invalid arguments are answered with the usage.
+func TestMatcher_Process_TooManyArguments(t *testing.T) {
+	t.Parallel()
+
+	text := process(t, newHelpMatcher(20), "/help ping pong", 789)
+	assert.Contains(t, text, "too many arguments")
+	assert.Contains(t, text, "*Usage:* /help \\[command\\|page\\]")
+}
@@ -0,0 +1,49 @@
+package matcher
+
+import (
+	"context"
+
+	telegramclient "github.com/br0-space/bot-telegramclient"
+)
+
+// ProcessFunc executes a matcher for an incoming message and returns the outgoing messages.
+type ProcessFunc func(ctx context.Context, messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error)
+
+// Middleware wraps the execution of the matcher with the given identifier. It returns a ProcessFunc that
+// typically does some work before and/or after calling next, e.g. logging, timing or auth checks.
+// A middleware can modify the incoming message before passing it on, modify the outgoing messages and
+// the error returned by next, or return early without calling next at all.
+//
+// Middlewares only wrap the execution: they run after the Registry decided that the matcher is enabled
+// and matches the message, and inside the matcher's timeout and panic recovery.
+type Middleware func(identifier string, next ProcessFunc) ProcessFunc
+
+// WithMiddleware adds middlewares wrapping the execution of every registered matcher. Middlewares are
+// applied in the given order: the first one is the outermost, i.e. it is called first and returns last.
+// Middlewares added with WithMiddleware are applied outside of per-matcher middlewares.
+func WithMiddleware(middlewares ...Middleware) RegistryOption {
+	return func(r *Registry) {
+		r.middlewares = append(r.middlewares, middlewares...)
+	}
+}
+
+// WithMatcherMiddleware adds middlewares wrapping the execution of this matcher only.
+// They are applied in the given order, inside of the middlewares added with WithMiddleware.
+func WithMatcherMiddleware(middlewares ...Middleware) RegisterOption {
+	return func(reg *registration) {
+		reg.middlewares = append(reg.middlewares, middlewares...)
+	}
+}
+
+// chain builds the ProcessFunc executing a registered matcher wrapped in all middlewares.
+func (r *Registry) chain(reg registration) ProcessFunc {
+	handler := AdaptContext(reg.matcher).ProcessContext
+	identifier := reg.matcher.Identifier()
+
+	middlewares := append(append([]Middleware{}, r.middlewares...), reg.middlewares...)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](identifier, handler)
+	}
+
+	return handler
+}
@@ -0,0 +1,136 @@
+package matcher_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// callRecorder records the order in which middlewares are entered and left.
+type callRecorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+// record appends a call to the recorder.
+func (c *callRecorder) record(call string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls = append(c.calls, call)
+}
+
+// recordingMiddleware returns a middleware recording when it is entered and left.
+func (c *callRecorder) recordingMiddleware(name string) matcher.Middleware {
+	return func(identifier string, next matcher.ProcessFunc) matcher.ProcessFunc {
+		return func(ctx context.Context, messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+			c.record(name + ">" + identifier)
+			defer c.record(name + "<" + identifier)
+
+			return next(ctx, messageIn)
+		}
+	}
+}
+
+// TestRegistry_Process_MiddlewareOrder verifies that global middlewares wrap per-matcher middlewares
+// and that both are applied in the given order.
+func TestRegistry_Process_MiddlewareOrder(t *testing.T) {
+	t.Parallel()
+
+	rec := &callRecorder{}
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(
+		logger.New(),
+		client,
+		matcher.WithMiddleware(rec.recordingMiddleware("g1"), rec.recordingMiddleware("g2")),
+	)
+
+	reg.Register(makeEchoMatcher("echo"), matcher.WithMatcherMiddleware(rec.recordingMiddleware("m1")))
+
+	reg.Process(telegramclient.TestWebhookMessage("hello"))
+
+	assert.Equal(t, []string{"g1>echo", "g2>echo", "m1>echo", "m1<echo", "g2<echo", "g1<echo"}, rec.calls)
+	assert.Equal(t, []string{"hello"}, client.sentTexts())
+}
+
+// TestRegistry_Process_MiddlewareModifiesMessages verifies that middlewares can modify the incoming message
+// and the outgoing messages, and only wrap the matchers they were registered for.
+func TestRegistry_Process_MiddlewareModifiesMessages(t *testing.T) {
+	t.Parallel()
+
+	normalize := func(_ string, next matcher.ProcessFunc) matcher.ProcessFunc {
+		return func(ctx context.Context, messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+			messageIn.Text = strings.ToLower(messageIn.Text)
+
+			messagesOut, err := next(ctx, messageIn)
+			for i := range messagesOut {
+				messagesOut[i].Text += "!"
+			}
+
+			return messagesOut, err
+		}
+	}
+
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client)
+	reg.Register(makeEchoMatcher("normalized"), matcher.WithMatcherMiddleware(normalize))
+	reg.Register(makeIdentifierMatcher("plain", `.`))
+
+	reg.Process(telegramclient.TestWebhookMessage("HELLO"))
+
+	assert.ElementsMatch(t, []string{"hello!", "plain"}, client.sentTexts())
+}
+
+// TestRegistry_Process_MiddlewareShortCircuits verifies that a middleware can skip the matcher entirely.
+func TestRegistry_Process_MiddlewareShortCircuits(t *testing.T) {
+	t.Parallel()
+
+	deny := func(identifier string, next matcher.ProcessFunc) matcher.ProcessFunc {
+		return func(ctx context.Context, messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+			if identifier == "secret" {
+				return []telegramclient.MessageStruct{telegramclient.Reply("denied", messageIn.ID)}, nil
+			}
+
+			return next(ctx, messageIn)
+		}
+	}
+
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithMiddleware(deny))
+	reg.Register(makeIdentifierMatcher("secret", `.`))
+	reg.Register(makeIdentifierMatcher("public", `.`))
+
+	reg.Process(telegramclient.TestWebhookMessage("hello"))
+
+	assert.ElementsMatch(t, []string{"denied", "public"}, client.sentTexts())
+}
+
+// TestRegistry_Process_MiddlewarePanicIsRecovered verifies that panics in middlewares are handled like
+// panics in the matcher itself.
+func TestRegistry_Process_MiddlewarePanicIsRecovered(t *testing.T) {
+	t.Parallel()
+
+	boom := func(_ string, _ matcher.ProcessFunc) matcher.ProcessFunc {
+		return func(_ context.Context, _ telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+			panic("boom")
+		}
+	}
+
+	m := makePanickingMatcher("panic", false)
+
+	reg := matcher.NewRegistry(logger.New(), &fakeTelegramClient{}, matcher.WithMiddleware(boom))
+	reg.Register(m)
+
+	require.NotPanics(t, func() { reg.Process(telegramclient.TestWebhookMessage("hello")) })
+
+	errs := m.handledErrors()
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "panic: boom")
+}
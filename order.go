@@ -0,0 +1,59 @@
+package matcher
+
+import (
+	"context"
+	"slices"
+
+	telegramclient "github.com/br0-space/bot-telegramclient"
+)
+
+// ReplyOrder determines when and in which order the Registry sends the replies of the matchers
+// executed for a message, see WithReplyOrder.
+type ReplyOrder int
+
+const (
+	// ReplyOrderStreaming sends the replies of each matcher as soon as it finished. Replies of different
+	// matchers are sent in the order the matchers finish, which can vary between runs. This is the default.
+	ReplyOrderStreaming ReplyOrder = iota
+	// ReplyOrderPriority waits for all matchers and sends their replies ordered by descending priority
+	// and then by registration order, i.e. the order in which matchers are evaluated.
+	ReplyOrderPriority
+	// ReplyOrderRegistration waits for all matchers and sends their replies in the order the matchers
+	// were registered, regardless of their priority.
+	ReplyOrderRegistration
+)
+
+// WithReplyOrder sets when and in which order the replies of the matchers executed for a message are sent.
+// With ReplyOrderPriority or ReplyOrderRegistration, ProcessContext collects the replies of all matchers,
+// including error replies, and sends them one matcher after another once the last matcher finished or
+// timed out, so the order in the chat is deterministic. Replies of a single matcher always keep their order.
+func WithReplyOrder(order ReplyOrder) RegistryOption {
+	return func(r *Registry) {
+		r.replyOrder = order
+	}
+}
+
+// replyBatch holds the replies of a matcher executed for a message until they are sent.
+type replyBatch struct {
+	reg         registration
+	messagesOut []telegramclient.MessageStruct
+}
+
+// sendBatches sends the collected replies of all matchers to a message in the configured order. The
+// batches are expected in evaluation order, i.e. ordered by priority.
+func (r *Registry) sendBatches(
+	ctx context.Context,
+	kind UpdateKind,
+	messageIn telegramclient.WebhookMessageStruct,
+	batches []*replyBatch,
+) {
+	if r.replyOrder == ReplyOrderRegistration {
+		slices.SortStableFunc(batches, func(a, b *replyBatch) int {
+			return a.reg.sequence - b.reg.sequence
+		})
+	}
+
+	for _, batch := range batches {
+		r.sendReplies(ctx, kind, messageIn, batch.reg.matcher.Identifier(), batch.messagesOut)
+	}
+}
@@ -0,0 +1,103 @@
+package matcher_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// delayedMatcher is a test matcher that replies with its identifier twice after a delay, or fails.
+type delayedMatcher struct {
+	matcher.Matcher
+
+	delay time.Duration
+	fail  bool
+}
+
+// makeDelayedMatcher returns a delayedMatcher with the given identifier that matches every message.
+func makeDelayedMatcher(identifier string, delay time.Duration, fail bool) delayedMatcher {
+	return delayedMatcher{
+		Matcher: matcher.MakeMatcher(identifier, regexp.MustCompile(`.`), nil),
+		delay:   delay,
+		fail:    fail,
+	}
+}
+
+// Process sleeps for the delay and replies with the identifier, or returns an error.
+func (m delayedMatcher) Process(messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+	time.Sleep(m.delay)
+
+	if m.fail {
+		return nil, errors.New("failed")
+	}
+
+	return []telegramclient.MessageStruct{
+		telegramclient.Reply(m.Identifier()+"1", messageIn.ID),
+		telegramclient.Reply(m.Identifier()+"2", messageIn.ID),
+	}, nil
+}
+
+// TestRegistry_Process_ReplyOrder verifies that replies are sent in a deterministic order regardless of
+// the order in which the matchers finish.
+func TestRegistry_Process_ReplyOrder(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		order matcher.ReplyOrder
+		want  []string
+	}{
+		{
+			name:  "priority",
+			order: matcher.ReplyOrderPriority,
+			want:  []string{"b1", "b2", "a1", "a2", "⚠️ *Error in matcher \"c\"*\n\nfailed", "d1", "d2"},
+		},
+		{
+			name:  "registration",
+			order: matcher.ReplyOrderRegistration,
+			want:  []string{"a1", "a2", "b1", "b2", "⚠️ *Error in matcher \"c\"*\n\nfailed", "d1", "d2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &fakeTelegramClient{}
+			reg := matcher.NewRegistry(logger.New(), client, matcher.WithReplyOrder(tt.order))
+			reg.Register(makeDelayedMatcher("a", 30*time.Millisecond, false))
+			reg.Register(makeDelayedMatcher("b", 20*time.Millisecond, false), matcher.WithPriority(10))
+			reg.Register(makeDelayedMatcher("c", 10*time.Millisecond, true))
+			reg.Register(makeDelayedMatcher("d", 0, false))
+
+			for range 3 {
+				client.sentMsg = nil
+
+				reg.Process(telegramclient.TestWebhookMessage("hello"))
+
+				assert.Equal(t, tt.want, client.sentTexts())
+			}
+		})
+	}
+}
+
+// TestRegistry_Process_ReplyOrderStreaming verifies that replies are sent as soon as each matcher finished
+// by default, keeping the order of the replies of a single matcher.
+func TestRegistry_Process_ReplyOrderStreaming(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client)
+	reg.Register(makeDelayedMatcher("a", 100*time.Millisecond, false))
+	reg.Register(makeDelayedMatcher("b", 0, false))
+
+	reg.Process(telegramclient.TestWebhookMessage("hello"))
+
+	assert.Equal(t, []string{"b1", "b2", "a1", "a2"}, client.sentTexts())
+}
@@ -0,0 +1,444 @@
+package matcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	telegramclient "github.com/br0-space/bot-telegramclient"
+)
+
+// configKeyPermissions is the config key overriding the permissions of a matcher.
+const configKeyPermissions = "permissions"
+
+// defaultRoleResolverTimeout bounds resolving the roles of a sender unless set with WithRoleResolverTimeout.
+const defaultRoleResolverTimeout = 10 * time.Second
+
+// errLookupPanic is reported for a lookup of chat administrators whose client panicked.
+var errLookupPanic = errors.New("lookup panicked")
+
+// defaultPermissionDeniedReply is the reply to messages from users who may not use a matcher, unless
+// configured otherwise with WithPermissionDeniedReply.
+const defaultPermissionDeniedReply = "⛔ You are not allowed to use this command."
+
+// Role is a role a user has in a chat, e.g. RoleAdmin or a custom role like "moderator" assigned through
+// a StaticRoleResolver. Roles are resolved per message by the RoleResolverInterface given to WithRoleResolver.
+type Role string
+
+// RoleAdmin is the role of chat administrators, see AdministratorResolver.
+const RoleAdmin Role = "admin"
+
+// Permissions restrict who may use a matcher. The zero value allows everyone.
+type Permissions struct {
+	// Allow lists the roles allowed to use the matcher: the sender needs at least one of them.
+	// If empty, everyone not denied is allowed.
+	Allow []Role `mapstructure:"allow"`
+	// Deny lists the roles that may not use the matcher, even if they have an allowed role, e.g. a
+	// "blocked" role assigned to spammers.
+	Deny []Role `mapstructure:"deny"`
+}
+
+// empty reports whether the permissions allow everyone without resolving roles.
+func (p Permissions) empty() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0
+}
+
+// permits reports whether a user with the given roles may use the matcher.
+func (p Permissions) permits(roles []Role) bool {
+	for _, role := range roles {
+		if slices.Contains(p.Deny, role) {
+			return false
+		}
+	}
+
+	if len(p.Allow) == 0 {
+		return true
+	}
+
+	for _, role := range roles {
+		if slices.Contains(p.Allow, role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// permissionsConfig is the "permissions" key of a matcher config. Keys that are not set keep the
+// permissions the matcher was made with, see Matcher.WithPermissions.
+type permissionsConfig struct {
+	Allow *[]Role `mapstructure:"allow"`
+	Deny  *[]Role `mapstructure:"deny"`
+}
+
+// apply returns the permissions with the configured values applied.
+func (c *permissionsConfig) apply(permissions Permissions) Permissions {
+	if c == nil {
+		return permissions
+	}
+
+	if c.Allow != nil {
+		permissions.Allow = *c.Allow
+	}
+
+	if c.Deny != nil {
+		permissions.Deny = *c.Deny
+	}
+
+	return permissions
+}
+
+// PermissionInterface is an optional extension of Interface for matchers restricted to some users. The
+// Registry resolves the roles of the sender and checks the permissions returned for the chat of every
+// message before executing the matcher. The base Matcher implements it, see Matcher.WithPermissions.
+type PermissionInterface interface {
+	PermissionsFor(chatID int64) Permissions
+}
+
+// WithPermissions returns a copy of the Matcher restricted by the given permissions, e.g. to chat admins:
+//
+//	m.WithPermissions(matcher.Permissions{Allow: []matcher.Role{matcher.RoleAdmin}})
+//
+// The "permissions" key of the matcher's config overrides them, see PermissionsFor.
+func (m Matcher) WithPermissions(permissions Permissions) Matcher {
+	m.permissions = permissions
+
+	return m
+}
+
+// PermissionsFor returns the permissions in the given chat: the permissions the matcher was made with,
+// overridden by the "allow" and "deny" keys below "permissions" in the chat's config, if set.
+func (m Matcher) PermissionsFor(chatID int64) Permissions {
+	return m.ConfigFor(chatID).permissions.apply(m.permissions)
+}
+
+// RoleResolverInterface resolves the roles of a user in a chat.
+type RoleResolverInterface interface {
+	RolesFor(ctx context.Context, chatID int64, userID int64) ([]Role, error)
+}
+
+// WithRoleResolver sets the resolver for the roles of senders, which the Registry checks against the
+// permissions of matchers, see PermissionInterface. Without a resolver, senders have no roles, so
+// matchers allowing only some roles are never executed.
+func WithRoleResolver(resolver RoleResolverInterface) RegistryOption {
+	return func(r *Registry) {
+		r.roles = resolver
+	}
+}
+
+// WithRoleResolverTimeout sets the deadline for resolving the roles of a sender. It applies in addition to
+// the timeout of the matcher being checked, so that a hanging resolver cannot stall an update even if the
+// matcher has no timeout. It defaults to 10 seconds; a timeout of zero disables it.
+func WithRoleResolverTimeout(timeout time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.rolesTimeout = timeout
+	}
+}
+
+// WithPermissionDeniedReply sets the plain text reply to messages from users who may not use a matcher.
+// An empty text drops such messages silently.
+func WithPermissionDeniedReply(text string) RegistryOption {
+	return func(r *Registry) {
+		r.deniedReply = text
+	}
+}
+
+// senderRoles holds the roles of the sender of a message, resolved once they are needed first.
+type senderRoles struct {
+	resolved bool
+	roles    []Role
+	err      error
+}
+
+// checkPermissions reports whether the sender of the message may use the matcher, resolving the sender's
+// roles if the matcher has permissions. Resolving is bounded by the matcher's timeout; roles that could not
+// be resolved in time are resolved again for the next matcher. A panic in PermissionsFor is recovered and
+// denies the message.
+func (r *Registry) checkPermissions(
+	ctx context.Context,
+	m Interface,
+	messageIn telegramclient.WebhookMessageStruct,
+	roles *senderRoles,
+) (permitted bool, err error) {
+	defer r.recoverMatcher(m)
+
+	pm, ok := as[PermissionInterface](m)
+	if !ok {
+		return true, nil
+	}
+
+	permissions := pm.PermissionsFor(messageIn.Chat.ID)
+	if permissions.empty() {
+		return true, nil
+	}
+
+	if !roles.resolved {
+		r.resolveRoles(ctx, m, messageIn, roles)
+	}
+
+	if roles.err != nil {
+		return false, fmt.Errorf("failed to resolve roles: %w", roles.err)
+	}
+
+	if !permissions.permits(roles.roles) {
+		r.log.Debugf("Matcher %s will not be executed: user %d is not permitted in chat %d",
+			m.Identifier(), messageIn.From.ID, messageIn.Chat.ID)
+
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// resolveRoles resolves the roles of the sender of the message with a context bounded by the matcher's
+// timeout and the role resolver timeout. Unless the matcher's timeout expired, the result is kept for the
+// other matchers of the message.
+func (r *Registry) resolveRoles(
+	ctx context.Context,
+	m Interface,
+	messageIn telegramclient.WebhookMessageStruct,
+	roles *senderRoles,
+) {
+	if r.roles == nil {
+		roles.resolved = true
+
+		return
+	}
+
+	matcherCtx, cancel := r.matcherContext(ctx, m.Identifier())
+	defer cancel()
+
+	rolesCtx := matcherCtx
+
+	if r.rolesTimeout > 0 {
+		var cancelRoles context.CancelFunc
+
+		rolesCtx, cancelRoles = context.WithTimeout(matcherCtx, r.rolesTimeout)
+		defer cancelRoles()
+	}
+
+	roles.roles, roles.err = r.roles.RolesFor(rolesCtx, messageIn.Chat.ID, messageIn.From.ID)
+	roles.resolved = matcherCtx.Err() == nil || ctx.Err() != nil
+}
+
+// CombineRoleResolvers returns a resolver granting the roles of all given resolvers. It fails if any of
+// them fails.
+func CombineRoleResolvers(resolvers ...RoleResolverInterface) RoleResolverInterface {
+	return combinedRoleResolver(resolvers)
+}
+
+// combinedRoleResolver grants the roles of all its resolvers.
+type combinedRoleResolver []RoleResolverInterface
+
+// RolesFor returns the roles granted by any of the resolvers.
+func (c combinedRoleResolver) RolesFor(ctx context.Context, chatID int64, userID int64) ([]Role, error) {
+	var roles []Role
+
+	for _, resolver := range c {
+		resolved, err := resolver.RolesFor(ctx, chatID, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, role := range resolved {
+			if !slices.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	return roles, nil
+}
+
+// rolesConfig is the config of a StaticRoleResolver, read from config/roles.yml.
+type rolesConfig struct {
+	Roles map[Role][]int64 `mapstructure:"roles"`
+}
+
+// StaticRoleResolver grants roles to fixed lists of user IDs, per chat or in all chats.
+type StaticRoleResolver struct {
+	roles map[int64]map[Role][]int64
+}
+
+// NewStaticRoleResolver returns a resolver granting the listed users their roles, keyed by chat ID like
+// the configs returned by LoadMatcherConfig: the lists under key 0 apply in chats without lists of their own.
+func NewStaticRoleResolver(roles map[int64]map[Role][]int64) *StaticRoleResolver {
+	return &StaticRoleResolver{roles: roles}
+}
+
+// LoadStaticRoleResolver reads the role lists from config/roles.yml and config/{chatID}/roles.yml, using
+// LoadMatcherConfig with the given options, e.g.:
+//
+//	roles:
+//	  admin: [12345]
+//	  blocked: [666]
+//
+// Per-chat files are merged with the fallback role by role, so a chat file only lists the roles it overrides.
+func LoadStaticRoleResolver(opts ...LoadOption) (*StaticRoleResolver, error) {
+	cfgs, err := LoadMatcherConfig[rolesConfig]("roles", opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[int64]map[Role][]int64, len(cfgs))
+	for chatID, cfg := range cfgs {
+		roles[chatID] = cfg.Roles
+	}
+
+	return NewStaticRoleResolver(roles), nil
+}
+
+// RolesFor returns the roles whose lists for the chat contain the user.
+func (s *StaticRoleResolver) RolesFor(_ context.Context, chatID int64, userID int64) ([]Role, error) {
+	lists, ok := s.roles[chatID]
+	if !ok {
+		lists = s.roles[0]
+	}
+
+	var roles []Role
+
+	for role, userIDs := range lists {
+		if slices.Contains(userIDs, userID) {
+			roles = append(roles, role)
+		}
+	}
+
+	slices.Sort(roles)
+
+	return roles, nil
+}
+
+// ChatAdministratorsInterface is an optional extension of the Telegram client for looking up the user IDs
+// of the administrators of a chat, e.g. with the Bot API method getChatAdministrators.
+type ChatAdministratorsInterface interface {
+	ChatAdministrators(chatID int64) ([]int64, error)
+}
+
+// administratorsEntry is a cached list of chat administrators.
+type administratorsEntry struct {
+	userIDs []int64
+	expires time.Time
+}
+
+// administratorsLookup is a lookup of the administrators of a chat in flight, shared by all callers asking
+// for the chat until it completes. done is closed once userIDs and err are set.
+type administratorsLookup struct {
+	done    chan struct{}
+	userIDs []int64
+	err     error
+}
+
+// AdministratorResolver grants RoleAdmin to the administrators of a chat, looked up through the Telegram
+// client and cached. In private chats, the user is the administrator of the chat with their own ID.
+// Concurrent lookups of the same chat share a single request, and callers stop waiting for it once their
+// context is done.
+type AdministratorResolver struct {
+	client ChatAdministratorsInterface
+	ttl    time.Duration
+	clock  Clock
+
+	mu      sync.Mutex
+	cache   map[int64]administratorsEntry
+	lookups map[int64]*administratorsLookup
+}
+
+// NewAdministratorResolver returns a resolver looking up the administrators of chats with the given client
+// and caching them for ttl. A nil clock uses the system clock.
+func NewAdministratorResolver(client ChatAdministratorsInterface, ttl time.Duration, clock Clock) *AdministratorResolver {
+	if clock == nil {
+		clock = systemClock{}
+	}
+
+	return &AdministratorResolver{
+		client:  client,
+		ttl:     ttl,
+		clock:   clock,
+		mu:      sync.Mutex{},
+		cache:   map[int64]administratorsEntry{},
+		lookups: map[int64]*administratorsLookup{},
+	}
+}
+
+// RolesFor returns RoleAdmin if the user is an administrator of the chat.
+func (a *AdministratorResolver) RolesFor(ctx context.Context, chatID int64, userID int64) ([]Role, error) {
+	if chatID == userID {
+		return []Role{RoleAdmin}, nil
+	}
+
+	admins, err := a.administrators(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Contains(admins, userID) {
+		return []Role{RoleAdmin}, nil
+	}
+
+	return nil, nil
+}
+
+// administrators returns the cached administrators of the chat, looking them up if necessary. It returns
+// ctx.Err() if ctx is done before the lookup completes; the lookup itself carries on for other callers.
+func (a *AdministratorResolver) administrators(ctx context.Context, chatID int64) ([]int64, error) {
+	a.mu.Lock()
+
+	if entry, ok := a.cache[chatID]; ok && a.clock.Now().Before(entry.expires) {
+		a.mu.Unlock()
+
+		return entry.userIDs, nil
+	}
+
+	lookup, ok := a.lookups[chatID]
+	if !ok {
+		lookup = &administratorsLookup{done: make(chan struct{}), userIDs: nil, err: nil}
+		a.lookups[chatID] = lookup
+
+		go a.lookUp(chatID, lookup)
+	}
+
+	a.mu.Unlock()
+
+	select {
+	case <-lookup.done:
+		return lookup.userIDs, lookup.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// lookUp looks up the administrators of the chat through the client, caches them on success and
+// completes the lookup.
+func (a *AdministratorResolver) lookUp(chatID int64, lookup *administratorsLookup) {
+	defer close(lookup.done)
+
+	userIDs, err := a.chatAdministrators(chatID)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.lookups, chatID)
+
+	if err != nil {
+		lookup.err = fmt.Errorf("failed to look up administrators of chat %d: %w", chatID, err)
+
+		return
+	}
+
+	a.cache[chatID] = administratorsEntry{userIDs: userIDs, expires: a.clock.Now().Add(a.ttl)}
+	lookup.userIDs = userIDs
+}
+
+// chatAdministrators looks up the administrators of the chat through the client. A panic of the client is
+// recovered and returned as an error, so that the lookup still completes.
+func (a *AdministratorResolver) chatAdministrators(chatID int64) (userIDs []int64, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			userIDs, err = nil, fmt.Errorf("%w: %v", errLookupPanic, v)
+		}
+	}()
+
+	return a.client.ChatAdministrators(chatID)
+}
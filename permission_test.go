@@ -0,0 +1,331 @@
+package matcher_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAdministrators is a matcher.ChatAdministratorsInterface counting its lookups.
+type fakeAdministrators struct {
+	mu      sync.Mutex
+	admins  map[int64][]int64
+	err     error
+	lookups int
+	// block, if not nil, delays every lookup until it is closed.
+	block chan struct{}
+}
+
+// ChatAdministrators returns the administrators of the chat or the configured error.
+func (f *fakeAdministrators) ChatAdministrators(chatID int64) ([]int64, error) {
+	f.mu.Lock()
+	f.lookups++
+	block := f.block
+	f.mu.Unlock()
+
+	if block != nil {
+		<-block
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.admins[chatID], f.err
+}
+
+// panickingAdministrators is a matcher.ChatAdministratorsInterface whose lookups panic.
+type panickingAdministrators struct{}
+
+// ChatAdministrators panics.
+func (panickingAdministrators) ChatAdministrators(_ int64) ([]int64, error) {
+	panic("boom")
+}
+
+// newPermissionRegistry returns a registry with the given options and an echo matcher with the given permissions.
+func newPermissionRegistry(permissions matcher.Permissions, opts ...matcher.RegistryOption) (*matcher.Registry, *fakeTelegramClient) {
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, opts...)
+
+	m := makeEchoMatcher("echo")
+	m.Matcher = m.WithPermissions(permissions)
+	reg.Register(m)
+
+	return reg, client
+}
+
+// TestRegistry_Process_Permissions verifies that the Registry only executes matchers the sender is
+// permitted to use and answers everyone else with a uniform reply.
+func TestRegistry_Process_Permissions(t *testing.T) {
+	t.Parallel()
+
+	resolver := matcher.NewStaticRoleResolver(map[int64]map[matcher.Role][]int64{
+		0: {matcher.RoleAdmin: {1}, "moderator": {2}, "blocked": {3}},
+		5: {"moderator": {1}},
+	})
+	denied := "⛔ You are not allowed to use this command."
+
+	tests := []struct {
+		name        string
+		permissions matcher.Permissions
+		chatID      int64
+		userID      int64
+		want        []string
+	}{
+		{"everyone", matcher.Permissions{}, 1, 4, []string{"hello"}},
+		{"admin", matcher.Permissions{Allow: []matcher.Role{matcher.RoleAdmin}}, 1, 1, []string{"hello"}},
+		{"not admin", matcher.Permissions{Allow: []matcher.Role{matcher.RoleAdmin}}, 1, 2, []string{denied}},
+		{"any allowed role", matcher.Permissions{Allow: []matcher.Role{matcher.RoleAdmin, "moderator"}}, 1, 2, []string{"hello"}},
+		{"per-chat roles", matcher.Permissions{Allow: []matcher.Role{matcher.RoleAdmin}}, 5, 1, []string{denied}},
+		{"denied", matcher.Permissions{Deny: []matcher.Role{"blocked"}}, 1, 3, []string{denied}},
+		{"not denied", matcher.Permissions{Deny: []matcher.Role{"blocked"}}, 1, 4, []string{"hello"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			reg, client := newPermissionRegistry(tt.permissions, matcher.WithRoleResolver(resolver))
+			reg.Process(messageFrom(tt.chatID, tt.userID))
+
+			assert.Equal(t, tt.want, client.sentTexts())
+		})
+	}
+}
+
+// TestRegistry_Process_PermissionDeniedReply verifies that the reply can be changed or disabled and that
+// matchers with permissions are never executed without a resolver.
+func TestRegistry_Process_PermissionDeniedReply(t *testing.T) {
+	t.Parallel()
+
+	admins := matcher.Permissions{Allow: []matcher.Role{matcher.RoleAdmin}, Deny: nil}
+
+	reg, client := newPermissionRegistry(admins, matcher.WithPermissionDeniedReply("Nope"))
+	reg.Process(messageFrom(1, 1))
+	assert.Equal(t, []string{"Nope"}, client.sentTexts())
+
+	reg, client = newPermissionRegistry(admins, matcher.WithPermissionDeniedReply(""))
+	reg.Register(makeIdentifierMatcher("other", `.`))
+	reg.Process(messageFrom(1, 1))
+	assert.Equal(t, []string{"other"}, client.sentTexts())
+}
+
+// TestRegistry_Process_RoleResolverError verifies that resolver errors are reported like matcher errors.
+func TestRegistry_Process_RoleResolverError(t *testing.T) {
+	t.Parallel()
+
+	admins := &fakeAdministrators{admins: nil, err: errors.New("boom")}
+	reg, client := newPermissionRegistry(
+		matcher.Permissions{Allow: []matcher.Role{matcher.RoleAdmin}, Deny: nil},
+		matcher.WithRoleResolver(matcher.NewAdministratorResolver(admins, time.Minute, nil)),
+	)
+
+	reg.Process(messageFrom(-1, 1))
+
+	require.Len(t, client.sentTexts(), 1)
+	assert.Contains(t, client.sentTexts()[0], "failed to resolve roles")
+}
+
+// TestAdministratorResolver verifies that administrators are looked up once per chat and TTL, and that
+// users are the administrators of their private chats.
+func TestAdministratorResolver(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	admins := &fakeAdministrators{admins: map[int64][]int64{-1: {1}}, err: nil}
+	clock := &fakeClock{}
+	resolver := matcher.NewAdministratorResolver(admins, time.Minute, clock)
+
+	roles, err := resolver.RolesFor(ctx, -1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []matcher.Role{matcher.RoleAdmin}, roles)
+
+	roles, err = resolver.RolesFor(ctx, -1, 2)
+	require.NoError(t, err)
+	assert.Empty(t, roles)
+	assert.Equal(t, 1, admins.lookups)
+
+	roles, err = resolver.RolesFor(ctx, 2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []matcher.Role{matcher.RoleAdmin}, roles)
+	assert.Equal(t, 1, admins.lookups)
+
+	clock.After(time.Minute)
+
+	_, err = resolver.RolesFor(ctx, -1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, admins.lookups)
+}
+
+// TestAdministratorResolver_ConcurrentLookups verifies that concurrent callers share a single lookup per
+// chat and that callers stop waiting for it once their context is done.
+func TestAdministratorResolver_ConcurrentLookups(t *testing.T) {
+	t.Parallel()
+
+	admins := &fakeAdministrators{admins: map[int64][]int64{-1: {1}}, err: nil, block: make(chan struct{})}
+	resolver := matcher.NewAdministratorResolver(admins, time.Minute, nil)
+
+	var waitGroup sync.WaitGroup
+
+	results := make([][]matcher.Role, 3)
+	for i := range results {
+		waitGroup.Go(func() {
+			results[i], _ = resolver.RolesFor(context.Background(), -1, 1)
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := resolver.RolesFor(ctx, -1, 1)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(admins.block)
+	waitGroup.Wait()
+
+	for _, roles := range results {
+		assert.Equal(t, []matcher.Role{matcher.RoleAdmin}, roles)
+	}
+
+	assert.Equal(t, 1, admins.lookups)
+}
+
+// TestRegistry_Process_RoleResolverTimeout verifies that resolving roles is bounded by the matcher's timeout.
+func TestRegistry_Process_RoleResolverTimeout(t *testing.T) {
+	t.Parallel()
+
+	admins := &fakeAdministrators{admins: nil, err: nil, block: make(chan struct{})}
+	defer close(admins.block)
+
+	reg, client := newPermissionRegistry(
+		matcher.Permissions{Allow: []matcher.Role{matcher.RoleAdmin}, Deny: nil},
+		matcher.WithRoleResolver(matcher.NewAdministratorResolver(admins, time.Minute, nil)),
+		matcher.WithDefaultTimeout(20*time.Millisecond),
+	)
+
+	reg.Process(messageFrom(-1, 1))
+
+	require.Len(t, client.sentTexts(), 1)
+	assert.Contains(t, client.sentTexts()[0], "context deadline exceeded")
+}
+
+// TestRegistry_Process_RoleResolverDefaultTimeout verifies that resolving roles is bounded by the role
+// resolver timeout even if the matcher has no timeout, and that the result is kept for the other matchers.
+func TestRegistry_Process_RoleResolverDefaultTimeout(t *testing.T) {
+	t.Parallel()
+
+	admins := &fakeAdministrators{admins: nil, err: nil, block: make(chan struct{})}
+	defer close(admins.block)
+
+	reg, client := newPermissionRegistry(
+		matcher.Permissions{Allow: []matcher.Role{matcher.RoleAdmin}, Deny: nil},
+		matcher.WithRoleResolver(matcher.NewAdministratorResolver(admins, time.Minute, nil)),
+		matcher.WithRoleResolverTimeout(20*time.Millisecond),
+	)
+
+	second := makeEchoMatcher("second")
+	second.Matcher = second.WithPermissions(matcher.Permissions{Allow: []matcher.Role{matcher.RoleAdmin}, Deny: nil})
+	reg.Register(second)
+
+	start := time.Now()
+
+	reg.Process(messageFrom(-1, 1))
+
+	assert.Less(t, time.Since(start), time.Second)
+	require.Len(t, client.sentTexts(), 2)
+	assert.Contains(t, client.sentTexts()[0], "context deadline exceeded")
+
+	admins.mu.Lock()
+	defer admins.mu.Unlock()
+
+	assert.Equal(t, 1, admins.lookups)
+}
+
+// TestAdministratorResolver_LookupPanic verifies that a panicking lookup is reported as an error and not
+// cached.
+func TestAdministratorResolver_LookupPanic(t *testing.T) {
+	t.Parallel()
+
+	resolver := matcher.NewAdministratorResolver(panickingAdministrators{}, time.Minute, nil)
+
+	for range 2 {
+		_, err := resolver.RolesFor(context.Background(), -1, 1)
+		require.ErrorContains(t, err, "failed to look up administrators of chat -1: lookup panicked: boom")
+	}
+}
+
+// TestCombineRoleResolvers verifies that combined resolvers grant the roles of all resolvers.
+func TestCombineRoleResolvers(t *testing.T) {
+	t.Parallel()
+
+	resolver := matcher.CombineRoleResolvers(
+		matcher.NewStaticRoleResolver(map[int64]map[matcher.Role][]int64{0: {"moderator": {1}}}),
+		matcher.NewAdministratorResolver(&fakeAdministrators{admins: map[int64][]int64{-1: {1}}, err: nil}, time.Minute, nil),
+	)
+
+	roles, err := resolver.RolesFor(context.Background(), -1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []matcher.Role{"moderator", matcher.RoleAdmin}, roles)
+}
+
+// TestLoadStaticRoleResolver verifies that role lists are read from config/roles.yml and per-chat files.
+func TestLoadStaticRoleResolver(t *testing.T) {
+	t.Parallel()
+
+	resolver, err := matcher.LoadStaticRoleResolver(matcher.WithFS(fstest.MapFS{
+		"config/roles.yml":    &fstest.MapFile{Data: []byte("roles:\n  admin: [1]\n  blocked: [3]\n")},
+		"config/5/roles.yml":  &fstest.MapFile{Data: []byte("roles:\n  admin: [2]\n")},
+		"config/6/other.yml":  &fstest.MapFile{Data: []byte("foo: bar\n")},
+		"config/7/roles.json": &fstest.MapFile{Data: []byte(`{"roles": {"blocked": []}}`)},
+	}))
+	require.NoError(t, err)
+
+	roles, _ := resolver.RolesFor(context.Background(), 1, 1)
+	assert.Equal(t, []matcher.Role{matcher.RoleAdmin}, roles)
+
+	roles, _ = resolver.RolesFor(context.Background(), 5, 1)
+	assert.Empty(t, roles)
+
+	roles, _ = resolver.RolesFor(context.Background(), 5, 2)
+	assert.Equal(t, []matcher.Role{matcher.RoleAdmin}, roles)
+
+	roles, _ = resolver.RolesFor(context.Background(), 5, 3)
+	assert.Equal(t, []matcher.Role{"blocked"}, roles)
+
+	roles, _ = resolver.RolesFor(context.Background(), 7, 3)
+	assert.Empty(t, roles)
+}
+
+// TestMatcher_PermissionsFor verifies that the "permissions" key of the config overrides the permissions
+// the matcher was made with.
+func TestMatcher_PermissionsFor(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"config/perm.yml":   &fstest.MapFile{Data: []byte("permissions:\n  deny: [blocked]\n")},
+		"config/1/perm.yml": &fstest.MapFile{Data: []byte("permissions:\n  allow: []\n")},
+	}
+
+	cfgs, err := matcher.LoadMatcherConfig[reloadCfg]("perm", matcher.WithFS(fsys), matcher.WithStrict())
+	require.NoError(t, err)
+
+	m := matcher.MakeMatcherWithCustomConfigType("perm", regexp.MustCompile(`.`), nil, reloadCfg{}).WithTypedConfigs(cfgs)
+	m.Matcher = m.WithPermissions(matcher.Permissions{Allow: []matcher.Role{matcher.RoleAdmin}, Deny: nil})
+
+	assert.Equal(t, matcher.Permissions{
+		Allow: []matcher.Role{matcher.RoleAdmin},
+		Deny:  []matcher.Role{"blocked"},
+	}, m.PermissionsFor(2))
+	assert.Equal(t, matcher.Permissions{
+		Allow: []matcher.Role{},
+		Deny:  []matcher.Role{"blocked"},
+	}, m.PermissionsFor(1))
+}
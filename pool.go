@@ -0,0 +1,166 @@
+package matcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// errPoolClosed is returned when dispatching a matcher after the Registry has been closed.
+var errPoolClosed = errors.New("worker pool is closed")
+
+// defaultAbandonGracePeriod is how long a worker waits for abandoned matcher calls before it is released,
+// unless set with WithAbandonGracePeriod.
+const defaultAbandonGracePeriod = 30 * time.Second
+
+// workerPool executes tasks on a fixed number of goroutines fed by a bounded queue.
+type workerPool struct {
+	tasks   chan func()
+	workers sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// WithWorkerPool runs the Process calls of matching matchers on a pool of the given number of workers,
+// shared across all messages, instead of starting a goroutine per matching matcher.
+// Up to queueSize matchers can wait for a free worker. Once the queue is full, ProcessContext blocks
+// until a worker becomes available (back-pressure) or its context is done, in which case the matcher
+// is not executed and the error is passed to its HandleError.
+// Matcher calls abandoned after their deadline, e.g. Process calls of matchers that do not implement
+// ContextInterface, keep occupying their worker until they return or the grace period set with
+// WithAbandonGracePeriod is over, so the pool limits them as well. Call Registry.Close to stop the workers when the Registry is no longer needed.
+func WithWorkerPool(workers int, queueSize int) RegistryOption {
+	return func(r *Registry) {
+		r.pool = newWorkerPool(max(workers, 1), max(queueSize, 0))
+	}
+}
+
+// WithAbandonGracePeriod sets how long a worker of the pool configured with WithWorkerPool waits for matcher
+// calls abandoned after their deadline to return. Once the grace period is over, the worker is released
+// and the call counts towards the matcher's quarantine like a panic, see WithPanicThreshold. It defaults
+// to 30 seconds; a grace period of zero keeps the worker until the calls return.
+func WithAbandonGracePeriod(grace time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.abandonGrace = grace
+	}
+}
+
+// newWorkerPool starts a worker pool with the given number of workers and queue size.
+func newWorkerPool(workers int, queueSize int) *workerPool {
+	p := &workerPool{
+		tasks:   make(chan func(), queueSize),
+		workers: sync.WaitGroup{},
+		mu:      sync.RWMutex{},
+		closed:  false,
+	}
+
+	p.workers.Add(workers)
+
+	for range workers {
+		go func() {
+			defer p.workers.Done()
+
+			for task := range p.tasks {
+				task()
+			}
+		}()
+	}
+
+	return p
+}
+
+// submit queues a task, blocking while the queue is full until there is room or ctx is done.
+func (p *workerPool) submit(ctx context.Context, task func()) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return errPoolClosed
+	}
+
+	select {
+	case p.tasks <- task:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close stops accepting tasks and waits for the workers to finish all queued tasks.
+func (p *workerPool) close() {
+	p.mu.Lock()
+
+	if p.closed {
+		p.mu.Unlock()
+
+		return
+	}
+
+	p.closed = true
+	close(p.tasks)
+	p.mu.Unlock()
+
+	p.workers.Wait()
+}
+
+// pendingCallsKey is the context key of the *sync.WaitGroup tracking the matcher calls a task started, see
+// awaitCall.
+type pendingCallsKey struct{}
+
+// dispatch executes a task of the matcher with the given identifier in a new goroutine or, if configured,
+// on the worker pool. On the pool, the worker is only released once all matcher calls started by the task
+// returned, including calls abandoned after their deadline, so the pool bounds the number of concurrently
+// running matchers. Abandoned calls still running after the grace period are left behind, see
+// awaitAbandonedCalls.
+func (r *Registry) dispatch(ctx context.Context, identifier string, task func(ctx context.Context)) error {
+	if r.pool == nil {
+		go task(ctx)
+
+		return nil
+	}
+
+	return r.pool.submit(ctx, func() {
+		var calls sync.WaitGroup
+
+		task(context.WithValue(ctx, pendingCallsKey{}, &calls))
+		r.awaitAbandonedCalls(identifier, &calls)
+	})
+}
+
+// awaitAbandonedCalls waits for the matcher calls of a task to return, for at most the grace period set
+// with WithAbandonGracePeriod. If they are still running then, the worker is released and the matcher is
+// counted towards its quarantine, so that a hanging matcher cannot pin every worker of the pool.
+func (r *Registry) awaitAbandonedCalls(identifier string, calls *sync.WaitGroup) {
+	if r.abandonGrace <= 0 {
+		calls.Wait()
+
+		return
+	}
+
+	returned := make(chan struct{})
+
+	go func() {
+		calls.Wait()
+		close(returned)
+	}()
+
+	timer := time.NewTimer(r.abandonGrace)
+	defer timer.Stop()
+
+	select {
+	case <-returned:
+	case <-timer.C:
+		r.log.Warningf("Releasing worker of matcher %s: abandoned call still running after %s", identifier, r.abandonGrace)
+		r.recordPanic(identifier)
+	}
+}
+
+// Close stops the worker pool configured with WithWorkerPool after all queued matchers finished.
+// It is a no-op for registries without a worker pool. Messages processed after Close are not dispatched.
+func (r *Registry) Close() {
+	if r.pool != nil {
+		r.pool.close()
+	}
+}
@@ -0,0 +1,232 @@
+package matcher_test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// benchmarkMatchers is the number of matchers registered in the benchmarks, of which only one matches.
+const benchmarkMatchers = 80
+
+// TestRegistry_Process_WorkerPool verifies that matching matchers are executed on the worker pool.
+func TestRegistry_Process_WorkerPool(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithWorkerPool(2, 4))
+	t.Cleanup(reg.Close)
+
+	reg.Register(makeEchoMatcher("echo1"))
+	reg.Register(makeEchoMatcher("echo2"))
+	reg.Register(echoMatcher{Matcher: matcher.MakeMatcher("never", regexp.MustCompile(`^never$`), nil)})
+
+	var waitGroup sync.WaitGroup
+
+	for range 10 {
+		waitGroup.Go(func() {
+			reg.Process(telegramclient.TestWebhookMessage("hello"))
+		})
+	}
+
+	waitGroup.Wait()
+
+	assert.Len(t, client.sentTexts(), 20)
+}
+
+// TestRegistry_Process_WorkerPoolBackPressure verifies that dispatching blocks while all workers are busy
+// and gives up once the context is done, reporting the error through HandleError.
+func TestRegistry_Process_WorkerPoolBackPressure(t *testing.T) {
+	t.Parallel()
+
+	reg := matcher.NewRegistry(logger.New(), &fakeTelegramClient{}, matcher.WithWorkerPool(1, 0))
+	t.Cleanup(reg.Close)
+
+	busy := makeBlockingMatcher(t, "busy")
+	waiting := makeBlockingMatcher(t, "waiting")
+
+	reg.Register(busy)
+	reg.Register(waiting)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	reg.ProcessContext(ctx, telegramclient.TestWebhookMessage("hello"))
+
+	// busy occupied the only worker until its deadline expired
+	busyErrs := busy.handledErrors()
+	require.Len(t, busyErrs, 1)
+	require.ErrorIs(t, busyErrs[0], context.DeadlineExceeded)
+
+	// waiting could not be dispatched before the deadline
+	waitingErrs := waiting.handledErrors()
+	require.Len(t, waitingErrs, 1)
+	require.ErrorIs(t, waitingErrs[0], context.DeadlineExceeded)
+	assert.Contains(t, waitingErrs[0].Error(), "could not be dispatched")
+}
+
+// slowLegacyMatcher is a matcher without ProcessContext whose Process ignores deadlines. It records the
+// maximum number of concurrently running Process calls.
+type slowLegacyMatcher struct {
+	echoMatcher
+
+	running *atomic.Int32
+	peak    *atomic.Int32
+}
+
+// Process sleeps for 50ms, recording the number of concurrent calls.
+func (m slowLegacyMatcher) Process(_ telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+	running := m.running.Add(1)
+	defer m.running.Add(-1)
+
+	for {
+		peak := m.peak.Load()
+		if running <= peak || m.peak.CompareAndSwap(peak, running) {
+			break
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	return nil, nil
+}
+
+// TestRegistry_Process_WorkerPoolBoundsAbandonedCalls verifies that Process calls abandoned after their
+// deadline keep occupying their worker, so the pool limits concurrency of legacy matchers.
+func TestRegistry_Process_WorkerPoolBoundsAbandonedCalls(t *testing.T) {
+	t.Parallel()
+
+	reg := matcher.NewRegistry(logger.New(), &fakeTelegramClient{},
+		matcher.WithWorkerPool(1, 0), matcher.WithDefaultTimeout(5*time.Millisecond))
+	t.Cleanup(reg.Close)
+
+	m := slowLegacyMatcher{echoMatcher: makeEchoMatcher("slow"), running: &atomic.Int32{}, peak: &atomic.Int32{}}
+	reg.Register(m)
+
+	for range 3 {
+		reg.Process(telegramclient.TestWebhookMessage("hello"))
+	}
+
+	reg.Close()
+	assert.Equal(t, int32(1), m.peak.Load())
+}
+
+// TestRegistry_Process_WorkerPoolReleasesHungCalls verifies that workers are released once abandoned calls
+// outlast the grace period, so that hanging matchers cannot block processing, and that they count towards
+// the matcher's quarantine.
+func TestRegistry_Process_WorkerPoolReleasesHungCalls(t *testing.T) {
+	t.Parallel()
+
+	reg := matcher.NewRegistry(logger.New(), &fakeTelegramClient{},
+		matcher.WithWorkerPool(1, 0), matcher.WithDefaultTimeout(5*time.Millisecond),
+		matcher.WithAbandonGracePeriod(10*time.Millisecond), matcher.WithPanicThreshold(3))
+
+	m := makeBlockingMatcher(t, "hung")
+	reg.Register(m)
+
+	for range 3 {
+		reg.Process(telegramclient.TestWebhookMessage("hello"))
+	}
+
+	assert.Len(t, m.handledErrors(), 3)
+	assert.Eventually(t, func() bool { return reg.IsQuarantined("hung") }, time.Second, time.Millisecond)
+}
+
+// TestRegistry_Close_StopsDispatching verifies that matchers are not dispatched after Close.
+func TestRegistry_Close_StopsDispatching(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithWorkerPool(1, 1))
+
+	m := makeBlockingMatcher(t, "closed")
+	reg.Register(m)
+
+	reg.Close()
+	reg.Close() // closing twice is a no-op
+
+	reg.Process(telegramclient.TestWebhookMessage("hello"))
+
+	assert.Empty(t, client.sentTexts())
+	assert.Len(t, m.handledErrors(), 1)
+}
+
+// newBenchmarkRegistry returns a registry with benchmarkMatchers command matchers of which only /cmd0 matches
+// the benchmark message.
+func newBenchmarkRegistry(opts ...matcher.RegistryOption) *matcher.Registry {
+	reg := matcher.NewRegistry(logger.New(), telegramclient.NewMockClient(), opts...)
+
+	for i := range benchmarkMatchers {
+		pattern := regexp.MustCompile(fmt.Sprintf(`(?i)^/cmd%d(@\w+)?($| )`, i))
+		reg.Register(echoMatcher{Matcher: matcher.MakeMatcher(fmt.Sprintf("cmd%d", i), pattern, nil)})
+	}
+
+	return reg
+}
+
+// BenchmarkReference_GoroutinePerMatcher measures the previous dispatch strategy of starting a goroutine for
+// every registered matcher before evaluating DoesMatch, as a reference for the benchmarks below.
+func BenchmarkReference_GoroutinePerMatcher(b *testing.B) {
+	matchers := make([]matcher.Matcher, 0, benchmarkMatchers)
+	for i := range benchmarkMatchers {
+		pattern := regexp.MustCompile(fmt.Sprintf(`(?i)^/cmd%d(@\w+)?($| )`, i))
+		matchers = append(matchers, matcher.MakeMatcher(fmt.Sprintf("cmd%d", i), pattern, nil))
+	}
+
+	msg := telegramclient.TestWebhookMessage("/cmd0 hello")
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			var waitGroup sync.WaitGroup
+			for _, m := range matchers {
+				waitGroup.Go(func() {
+					if m.DoesMatch(msg) {
+						_, _ = echoMatcher{Matcher: m}.Process(msg)
+					}
+				})
+			}
+
+			waitGroup.Wait()
+		}
+	})
+}
+
+// BenchmarkRegistry_Process_GoroutinePerMatch measures the default strategy of starting a goroutine per
+// matching matcher.
+func BenchmarkRegistry_Process_GoroutinePerMatch(b *testing.B) {
+	reg := newBenchmarkRegistry()
+	msg := telegramclient.TestWebhookMessage("/cmd0 hello")
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			reg.Process(msg)
+		}
+	})
+}
+
+// BenchmarkRegistry_Process_WorkerPool measures dispatching matching matchers to a shared worker pool.
+func BenchmarkRegistry_Process_WorkerPool(b *testing.B) {
+	reg := newBenchmarkRegistry(matcher.WithWorkerPool(8, 64))
+	b.Cleanup(reg.Close)
+
+	msg := telegramclient.TestWebhookMessage("/cmd0 hello")
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			reg.Process(msg)
+		}
+	})
+}
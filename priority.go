@@ -0,0 +1,33 @@
+package matcher
+
+import "slices"
+
+// WithPriority registers a matcher with the given priority. Matchers with a higher priority are evaluated
+// first. The default priority is zero; negative priorities are evaluated after all default matchers.
+func WithPriority(priority int) RegisterOption {
+	return func(reg *registration) {
+		reg.priority = priority
+	}
+}
+
+// WithExclusive registers a matcher that claims every message it matches exclusively: matchers with a
+// lower priority are not executed for that message. Matchers with the same or a higher priority still
+// run concurrently as usual.
+func WithExclusive() RegisterOption {
+	return func(reg *registration) {
+		reg.exclusive = true
+	}
+}
+
+// insert adds a registration after all registrations with the same or a higher priority,
+// keeping the matchers ordered by descending priority and then by registration order.
+func (r *Registry) insert(reg registration) {
+	i := slices.IndexFunc(r.matchers, func(other registration) bool {
+		return other.priority < reg.priority
+	})
+	if i < 0 {
+		i = len(r.matchers)
+	}
+
+	r.matchers = slices.Insert(r.matchers, i, reg)
+}
@@ -0,0 +1,75 @@
+package matcher_test
+
+import (
+	"regexp"
+	"testing"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// identifierMatcher is a test matcher that replies with its identifier.
+type identifierMatcher struct {
+	matcher.Matcher
+}
+
+// makeIdentifierMatcher returns an identifierMatcher using the given pattern.
+func makeIdentifierMatcher(identifier string, pattern string) identifierMatcher {
+	return identifierMatcher{Matcher: matcher.MakeMatcher(identifier, regexp.MustCompile(pattern), nil)}
+}
+
+// Process replies with the matcher's identifier.
+func (m identifierMatcher) Process(messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+	return []telegramclient.MessageStruct{telegramclient.Reply(m.Identifier(), messageIn.ID)}, nil
+}
+
+// TestRegistry_Process_ExclusiveMatcherClaimsMessage verifies that an exclusive match skips matchers with a
+// lower priority, while matchers with the same priority still run.
+func TestRegistry_Process_ExclusiveMatcherClaimsMessage(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client)
+
+	// registered first, but evaluated last due to its default priority
+	reg.Register(makeIdentifierMatcher("inline", `\+\+`))
+	reg.Register(makeIdentifierMatcher("command", `^/karma`), matcher.WithPriority(10), matcher.WithExclusive())
+	reg.Register(makeIdentifierMatcher("audit", `.`), matcher.WithPriority(10))
+
+	reg.Process(telegramclient.TestWebhookMessage("/karma++"))
+	assert.ElementsMatch(t, []string{"command", "audit"}, client.sentTexts())
+}
+
+// TestRegistry_Process_ExclusiveMatcherWithoutMatch verifies that an exclusive matcher that does not match
+// does not claim the message.
+func TestRegistry_Process_ExclusiveMatcherWithoutMatch(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client)
+
+	reg.Register(makeIdentifierMatcher("inline", `\+\+`))
+	reg.Register(makeIdentifierMatcher("command", `^/karma`), matcher.WithPriority(10), matcher.WithExclusive())
+	reg.Register(makeIdentifierMatcher("low", `.`), matcher.WithPriority(-1))
+
+	reg.Process(telegramclient.TestWebhookMessage("foo++"))
+	assert.ElementsMatch(t, []string{"inline", "low"}, client.sentTexts())
+}
+
+// TestRegistry_Process_ExclusiveMatcherSkipsOnlyLowerPriorities verifies that higher-priority matchers are
+// unaffected by an exclusive match.
+func TestRegistry_Process_ExclusiveMatcherSkipsOnlyLowerPriorities(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client)
+
+	reg.Register(makeIdentifierMatcher("high", `.`), matcher.WithPriority(20))
+	reg.Register(makeIdentifierMatcher("exclusive", `.`), matcher.WithExclusive())
+	reg.Register(makeIdentifierMatcher("low", `.`), matcher.WithPriority(-5))
+
+	reg.Process(telegramclient.TestWebhookMessage("hello"))
+	assert.ElementsMatch(t, []string{"high", "exclusive"}, client.sentTexts())
+}
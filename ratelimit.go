@@ -0,0 +1,216 @@
+package matcher
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit is the budget of a token bucket: up to Burst messages can be sent at once, and the bucket
+// refills at Messages per Interval. The zero value means no limit.
+type RateLimit struct {
+	// Messages is the number of messages allowed per Interval.
+	Messages int
+	// Interval is the period Messages refers to.
+	Interval time.Duration
+	// Burst is the number of messages that can be sent at once. Values below 1 are treated as 1.
+	Burst int
+}
+
+// unlimited reports whether the limit is disabled.
+func (l RateLimit) unlimited() bool {
+	return l.Messages <= 0 || l.Interval <= 0
+}
+
+// RateLimits are the budgets for outgoing messages, see WithRateLimits.
+type RateLimits struct {
+	// PerChat limits the messages sent to any single chat.
+	PerChat RateLimit
+	// PerGroup additionally limits the messages sent to any single group, i.e. chats with a negative ID.
+	PerGroup RateLimit
+	// Global limits all messages sent by the bot.
+	Global RateLimit
+}
+
+// DefaultRateLimits returns the limits documented by Telegram: one message per second per chat,
+// 20 messages per minute per group and 30 messages per second overall.
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		PerChat:  RateLimit{Messages: 1, Interval: time.Second, Burst: 1},
+		PerGroup: RateLimit{Messages: 20, Interval: time.Minute, Burst: 20},
+		Global:   RateLimit{Messages: 30, Interval: time.Second, Burst: 30},
+	}
+}
+
+// WithRateLimits throttles outgoing messages to the given budgets, see DefaultRateLimits. Messages
+// exceeding a budget are queued, not dropped: sending waits until every applicable bucket has a token,
+// in the order the messages were sent. Waiting stops once the context passed to ProcessContext is done,
+// in which case the message is passed to the dead-letter sink. Retries count against the budgets as well.
+func WithRateLimits(limits RateLimits) RegistryOption {
+	return func(r *Registry) {
+		r.limiter = newRateLimiter(limits)
+	}
+}
+
+// tokenBucket is a token bucket whose balance may become negative, so that every reservation is granted
+// immediately together with the delay after which it may be used.
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full token bucket for the given limit.
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: float64(max(limit.Burst, 1)), last: now}
+}
+
+// reserve takes a token and returns how long the caller has to wait before using it.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens * float64(b.limit.Interval) / float64(b.limit.Messages))
+}
+
+// cancel returns a token taken by reserve that was not used.
+func (b *tokenBucket) cancel(now time.Time) {
+	b.refill(now)
+	b.tokens = min(b.tokens+1, float64(max(b.limit.Burst, 1)))
+}
+
+// refill adds the tokens accrued since the last call, up to the burst size.
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += float64(elapsed) * float64(b.limit.Messages) / float64(b.limit.Interval)
+		b.tokens = min(b.tokens, float64(max(b.limit.Burst, 1)))
+		b.last = now
+	}
+}
+
+// full reports whether the bucket has refilled to its burst size, i.e. no reservation is pending and it is
+// indistinguishable from a new bucket.
+func (b *tokenBucket) full(now time.Time) bool {
+	b.refill(now)
+
+	return b.tokens >= float64(max(b.limit.Burst, 1))
+}
+
+// rateLimiter holds the token buckets of the Registry: one per chat, one per group and a global one.
+// Buckets of chats and groups are removed once they have refilled, see sweep.
+type rateLimiter struct {
+	limits RateLimits
+
+	mu        sync.Mutex
+	chats     map[int64]*tokenBucket
+	groups    map[int64]*tokenBucket
+	global    *tokenBucket
+	nextSweep time.Time
+}
+
+// newRateLimiter returns a rateLimiter for the given budgets.
+func newRateLimiter(limits RateLimits) *rateLimiter {
+	return &rateLimiter{
+		limits:    limits,
+		mu:        sync.Mutex{},
+		chats:     map[int64]*tokenBucket{},
+		groups:    map[int64]*tokenBucket{},
+		global:    nil,
+		nextSweep: time.Time{},
+	}
+}
+
+// wait blocks until a message may be sent to the given chat or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context, clock Clock, chatID int64) error {
+	buckets, delay := l.reserve(clock.Now(), chatID)
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-clock.After(delay):
+		return nil
+	case <-ctx.Done():
+		l.cancel(clock.Now(), buckets)
+
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token from every bucket applying to the given chat, creating buckets as needed, and
+// returns the buckets and the longest delay among them.
+func (l *rateLimiter) reserve(now time.Time, chatID int64) ([]*tokenBucket, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	var buckets []*tokenBucket
+
+	if !l.limits.PerChat.unlimited() {
+		buckets = append(buckets, bucketFor(l.chats, chatID, l.limits.PerChat, now))
+	}
+
+	if chatID < 0 && !l.limits.PerGroup.unlimited() {
+		buckets = append(buckets, bucketFor(l.groups, chatID, l.limits.PerGroup, now))
+	}
+
+	if !l.limits.Global.unlimited() {
+		if l.global == nil {
+			l.global = newTokenBucket(l.limits.Global, now)
+		}
+
+		buckets = append(buckets, l.global)
+	}
+
+	var delay time.Duration
+	for _, bucket := range buckets {
+		delay = max(delay, bucket.reserve(now))
+	}
+
+	return buckets, delay
+}
+
+// cancel returns the tokens of an abandoned reservation.
+func (l *rateLimiter) cancel(now time.Time, buckets []*tokenBucket) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, bucket := range buckets {
+		bucket.cancel(now)
+	}
+}
+
+// sweep removes the buckets of chats and groups that have refilled to their burst size, at most once per
+// the longer of the per-chat and per-group intervals. A removed bucket is recreated full on the next
+// message, so sweeping does not change which messages are delayed. It must be called with l.mu held.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Before(l.nextSweep) {
+		return
+	}
+
+	l.nextSweep = now.Add(max(l.limits.PerChat.Interval, l.limits.PerGroup.Interval))
+
+	for _, buckets := range []map[int64]*tokenBucket{l.chats, l.groups} {
+		for chatID, bucket := range buckets {
+			if bucket.full(now) {
+				delete(buckets, chatID)
+			}
+		}
+	}
+}
+
+// bucketFor returns the bucket of the given chat, creating a full one if necessary.
+func bucketFor(buckets map[int64]*tokenBucket, chatID int64, limit RateLimit, now time.Time) *tokenBucket {
+	bucket, ok := buckets[chatID]
+	if !ok {
+		bucket = newTokenBucket(limit, now)
+		buckets[chatID] = bucket
+	}
+
+	return bucket
+}
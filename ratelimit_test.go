@@ -0,0 +1,198 @@
+package matcher_test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// burstMatcher is a test matcher that replies with a fixed number of messages.
+type burstMatcher struct {
+	matcher.Matcher
+
+	count int
+}
+
+// Process replies with count numbered messages.
+func (m burstMatcher) Process(messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+	messagesOut := make([]telegramclient.MessageStruct, 0, m.count)
+	for i := range m.count {
+		messagesOut = append(messagesOut, telegramclient.Reply(fmt.Sprint(i+1), messageIn.ID))
+	}
+
+	return messagesOut, nil
+}
+
+// newRateLimitedRegistry returns a registry with the given limits and a fake clock, with a matcher
+// replying with count messages to every message.
+func newRateLimitedRegistry(limits matcher.RateLimits, count int) (*matcher.Registry, *fakeTelegramClient, *fakeClock) {
+	client := &fakeTelegramClient{}
+	clock := &fakeClock{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithRateLimits(limits), matcher.WithClock(clock))
+	reg.Register(burstMatcher{Matcher: matcher.MakeMatcher("burst", regexp.MustCompile(`.`), nil), count: count})
+
+	return reg, client, clock
+}
+
+// messageTo returns a test message sent to the given chat.
+func messageTo(chatID int64) telegramclient.WebhookMessageStruct {
+	msg := telegramclient.TestWebhookMessage("hello")
+	msg.Chat.ID = chatID
+
+	return msg
+}
+
+// TestRegistry_Process_RateLimits verifies that replies exceeding a budget are delayed, not dropped.
+func TestRegistry_Process_RateLimits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		limits     matcher.RateLimits
+		chatIDs    []int64
+		wantDelays []time.Duration
+	}{
+		{
+			name:       "unlimited",
+			limits:     matcher.RateLimits{},
+			chatIDs:    []int64{1, 1},
+			wantDelays: nil,
+		},
+		{
+			name:       "per chat",
+			limits:     matcher.RateLimits{PerChat: matcher.RateLimit{Messages: 1, Interval: time.Second, Burst: 1}},
+			chatIDs:    []int64{1},
+			wantDelays: []time.Duration{time.Second, time.Second},
+		},
+		{
+			name:       "per chat with burst",
+			limits:     matcher.RateLimits{PerChat: matcher.RateLimit{Messages: 2, Interval: time.Second, Burst: 2}},
+			chatIDs:    []int64{1, 2},
+			wantDelays: []time.Duration{500 * time.Millisecond, 500 * time.Millisecond},
+		},
+		{
+			name:       "per group",
+			limits:     matcher.RateLimits{PerGroup: matcher.RateLimit{Messages: 2, Interval: time.Minute, Burst: 2}},
+			chatIDs:    []int64{1, -100},
+			wantDelays: []time.Duration{30 * time.Second},
+		},
+		{
+			name:       "global",
+			limits:     matcher.RateLimits{Global: matcher.RateLimit{Messages: 4, Interval: time.Second, Burst: 4}},
+			chatIDs:    []int64{1, 2},
+			wantDelays: []time.Duration{250 * time.Millisecond, 250 * time.Millisecond},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			reg, client, clock := newRateLimitedRegistry(tt.limits, 3)
+
+			for _, chatID := range tt.chatIDs {
+				reg.Process(messageTo(chatID))
+			}
+
+			assert.Equal(t, tt.wantDelays, clock.recordedDelays())
+			assert.Len(t, client.sentTexts(), 3*len(tt.chatIDs))
+			assert.Equal(t, []string{"1", "2", "3"}, client.sentTexts()[:3])
+		})
+	}
+}
+
+// TestRegistry_Process_RateLimitsRefill verifies that buckets refill over time.
+func TestRegistry_Process_RateLimitsRefill(t *testing.T) {
+	t.Parallel()
+
+	reg, client, clock := newRateLimitedRegistry(matcher.DefaultRateLimits(), 1)
+
+	reg.Process(messageTo(-100))
+	reg.Process(messageTo(-100))
+	assert.Equal(t, []time.Duration{time.Second}, clock.recordedDelays())
+
+	clock.mu.Lock()
+	clock.now = clock.now.Add(time.Minute)
+	clock.mu.Unlock()
+
+	reg.Process(messageTo(-100))
+	assert.Equal(t, []time.Duration{time.Second}, clock.recordedDelays())
+	assert.Len(t, client.sentTexts(), 3)
+}
+
+// TestRegistry_Process_RateLimitsConcurrent verifies that replies of matchers running concurrently share
+// the budget of their chat.
+func TestRegistry_Process_RateLimitsConcurrent(t *testing.T) {
+	t.Parallel()
+
+	reg, client, clock := newRateLimitedRegistry(
+		matcher.RateLimits{PerChat: matcher.RateLimit{Messages: 1, Interval: time.Second, Burst: 1}},
+		1,
+	)
+	reg.Register(makeEchoMatcher("echo"))
+
+	reg.Process(messageTo(1))
+
+	assert.Equal(t, []time.Duration{time.Second}, clock.recordedDelays())
+	assert.ElementsMatch(t, []string{"1", "hello"}, client.sentTexts())
+}
+
+// TestRegistry_Process_RateLimitsAbandoned verifies that queued replies are passed to the dead-letter sink
+// once the context is done.
+func TestRegistry_Process_RateLimitsAbandoned(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeTelegramClient{}
+	sink := &deadLetterRecorder{}
+	reg := matcher.NewRegistry(
+		logger.New(),
+		client,
+		matcher.WithRateLimits(matcher.RateLimits{PerChat: matcher.RateLimit{Messages: 1, Interval: time.Hour, Burst: 1}}),
+		matcher.WithDeadLetterSink(sink),
+	)
+	reg.Register(burstMatcher{Matcher: matcher.MakeMatcher("burst", regexp.MustCompile(`.`), nil), count: 2})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	reg.ProcessContext(ctx, messageTo(1))
+
+	assert.Equal(t, []string{"1"}, client.sentTexts())
+	require.Len(t, sink.letters, 1)
+	assert.Equal(t, "2", sink.letters[0].Message.Text)
+	assert.Equal(t, 0, sink.letters[0].Attempts)
+	require.ErrorIs(t, sink.letters[0].Err, context.DeadlineExceeded)
+}
+
+// TestRegistry_Process_RateLimitsSweep verifies that chats keep their budget after the buckets of idle
+// chats have been removed.
+func TestRegistry_Process_RateLimitsSweep(t *testing.T) {
+	t.Parallel()
+
+	reg, client, clock := newRateLimitedRegistry(
+		matcher.RateLimits{PerChat: matcher.RateLimit{Messages: 1, Interval: time.Second, Burst: 1}},
+		1,
+	)
+
+	reg.Process(messageTo(1))
+	reg.Process(messageTo(2))
+
+	clock.mu.Lock()
+	clock.now = clock.now.Add(time.Minute)
+	clock.mu.Unlock()
+
+	reg.Process(messageTo(3))
+	reg.Process(messageTo(1))
+	reg.Process(messageTo(1))
+
+	assert.Equal(t, []time.Duration{time.Second}, clock.recordedDelays())
+	assert.Len(t, client.sentTexts(), 5)
+}
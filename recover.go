@@ -0,0 +1,77 @@
+package matcher
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is the error reported for a matcher that panicked in DoesMatch or Process.
+// It carries the recovered value and the stack trace of the panicking goroutine.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+// Error returns a short description of the panic. The stack trace is available in Stack.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// recoverPanic recovers from a panic and stores it as *PanicError in err.
+// It must be deferred directly, as recover only works when called by the deferred function itself.
+func recoverPanic(err *error) {
+	if v := recover(); v != nil {
+		*err = &PanicError{Value: v, Stack: debug.Stack()}
+	}
+}
+
+// WithPanicThreshold quarantines a matcher after it panicked the given number of times in a row.
+// A successful run resets the count, so rare panics never quarantine a matcher.
+// A quarantined matcher is no longer executed until Unquarantine is called.
+// A threshold of zero (the default) never quarantines matchers.
+func WithPanicThreshold(threshold int) RegistryOption {
+	return func(r *Registry) {
+		r.panicThreshold = threshold
+	}
+}
+
+// IsQuarantined reports whether the matcher with the given identifier has been quarantined
+// because it exceeded the panic threshold.
+func (r *Registry) IsQuarantined(identifier string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.quarantined[identifier]
+}
+
+// Unquarantine re-enables a quarantined matcher and resets its panic counter.
+func (r *Registry) Unquarantine(identifier string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.quarantined, identifier)
+	delete(r.panics, identifier)
+}
+
+// recordSuccess resets the panic count of the matcher with the given identifier after it ran without
+// panicking. Calls abandoned after their deadline do not count as success, see awaitAbandonedCalls.
+func (r *Registry) recordSuccess(identifier string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.panics, identifier)
+}
+
+// recordPanic counts a panic of the matcher with the given identifier and quarantines it
+// once the panic threshold of consecutive panics is reached.
+func (r *Registry) recordPanic(identifier string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.panics[identifier]++
+
+	if r.panicThreshold > 0 && r.panics[identifier] >= r.panicThreshold && !r.quarantined[identifier] {
+		r.quarantined[identifier] = true
+		r.log.Warningf("Matcher %s quarantined after %d panics", identifier, r.panics[identifier])
+	}
+}
@@ -0,0 +1,138 @@
+package matcher_test
+
+import (
+	"regexp"
+	"testing"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// panickingMatcher is a test matcher that panics in DoesMatch or Process and records handled errors.
+type panickingMatcher struct {
+	matcher.Matcher
+	*errorRecorder
+
+	inDoesMatch bool
+}
+
+// makePanickingMatcher returns a panickingMatcher matching every message.
+func makePanickingMatcher(identifier string, inDoesMatch bool) panickingMatcher {
+	return panickingMatcher{
+		Matcher:       matcher.MakeMatcher(identifier, regexp.MustCompile(`.`), nil),
+		errorRecorder: &errorRecorder{},
+		inDoesMatch:   inDoesMatch,
+	}
+}
+
+// DoesMatch panics if configured to do so.
+func (m panickingMatcher) DoesMatch(messageIn telegramclient.WebhookMessageStruct) bool {
+	if m.inDoesMatch {
+		panic("boom in DoesMatch")
+	}
+
+	return m.Matcher.DoesMatch(messageIn)
+}
+
+// Process panics unless the message text is "ok".
+func (m panickingMatcher) Process(messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+	if messageIn.Text == "ok" {
+		return nil, nil
+	}
+
+	panic("boom in Process")
+}
+
+// HandleError records the error.
+func (m panickingMatcher) HandleError(messageIn telegramclient.WebhookMessageStruct, identifier string, err error) {
+	m.errorRecorder.HandleError(messageIn, identifier, err)
+}
+
+// TestRegistry_Process_RecoversPanics verifies that panics in DoesMatch and Process are recovered,
+// passed to HandleError as *PanicError with a stack trace and answered with an error reply.
+func TestRegistry_Process_RecoversPanics(t *testing.T) {
+	t.Parallel()
+
+	for _, inDoesMatch := range []bool{true, false} {
+		client := &fakeTelegramClient{}
+		reg := matcher.NewRegistry(logger.New(), client)
+
+		m := makePanickingMatcher("panic", inDoesMatch)
+		reg.Register(m)
+		reg.Register(makeEchoMatcher("echo"))
+
+		require.NotPanics(t, func() {
+			reg.Process(telegramclient.TestWebhookMessage("hello"))
+		})
+
+		errs := m.handledErrors()
+		require.Len(t, errs, 1)
+
+		var panicErr *matcher.PanicError
+		require.ErrorAs(t, errs[0], &panicErr)
+		assert.NotEmpty(t, panicErr.Stack)
+		assert.Contains(t, panicErr.Error(), "boom")
+
+		texts := client.sentTexts()
+		assert.Len(t, texts, 2)
+		assert.Contains(t, texts, "hello")
+		assert.False(t, reg.IsQuarantined("panic"))
+	}
+}
+
+// TestRegistry_Process_QuarantinesPanickingMatcher verifies that a matcher is no longer executed once it
+// reached the panic threshold and runs again after Unquarantine.
+func TestRegistry_Process_QuarantinesPanickingMatcher(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithPanicThreshold(2))
+
+	m := makePanickingMatcher("panic", false)
+	reg.Register(m)
+
+	msg := telegramclient.TestWebhookMessage("hello")
+
+	reg.Process(msg)
+	assert.False(t, reg.IsQuarantined("panic"))
+
+	reg.Process(msg)
+	assert.True(t, reg.IsQuarantined("panic"))
+
+	reg.Process(msg)
+	assert.Len(t, m.handledErrors(), 2)
+	assert.Len(t, client.sentTexts(), 2)
+
+	reg.Unquarantine("panic")
+	assert.False(t, reg.IsQuarantined("panic"))
+
+	reg.Process(msg)
+	assert.Len(t, m.handledErrors(), 3)
+	assert.False(t, reg.IsQuarantined("panic"))
+}
+
+// TestRegistry_Process_SuccessResetsPanicCount verifies that only consecutive panics quarantine a matcher.
+func TestRegistry_Process_SuccessResetsPanicCount(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithPanicThreshold(2))
+
+	reg.Register(makePanickingMatcher("panic", false))
+
+	panicking := telegramclient.TestWebhookMessage("hello")
+	reg.Process(panicking)
+
+	succeeding := panicking
+	succeeding.Text = "ok"
+	reg.Process(succeeding)
+
+	reg.Process(panicking)
+	assert.False(t, reg.IsQuarantined("panic"))
+
+	reg.Process(panicking)
+	assert.True(t, reg.IsQuarantined("panic"))
+}
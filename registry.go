@@ -1,8 +1,12 @@
 package matcher
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"runtime/debug"
 	"sync"
+	"time"
 
 	logger "github.com/br0-space/bot-logger"
 	telegramclient "github.com/br0-space/bot-telegramclient"
@@ -10,87 +14,419 @@ import (
 
 const errorTemplate = "⚠️ *Error in matcher \"%s\"*\n\n%s"
 
+// errDeadline is wrapped by the error reported for a matcher that did not finish before its context was done.
+var errDeadline = errors.New("matcher did not finish in time")
+
+// errNotDispatched is reported for a matching matcher that could not be dispatched, see WithWorkerPool.
+var errNotDispatched = errors.New("matcher could not be dispatched")
+
 type Registry struct {
-	log      logger.Interface
-	telegram telegramclient.ClientInterface
-	matchers []Interface
+	log            logger.Interface
+	telegram       telegramclient.ClientInterface
+	matchers       []registration
+	defaultTimeout time.Duration
+	timeouts       map[string]time.Duration
+	panicThreshold int
+	pool           *workerPool
+	abandonGrace   time.Duration
+	middlewares    []Middleware
+	configStore    *ConfigStore
+	retryPolicy    RetryPolicy
+	deadLetters    DeadLetterSinkInterface
+	limiter        *rateLimiter
+	replyOrder     ReplyOrder
+	cooldowns      *cooldownTracker
+	roles          RoleResolverInterface
+	rolesTimeout   time.Duration
+	deniedReply    string
+	dialogs        *Dialogs
+	storage        StorageInterface
+	inlineCache    time.Duration
+	replies        *replyTracker
+	clock          Clock
+
+	mu          sync.Mutex
+	panics      map[string]int
+	quarantined map[string]bool
 }
 
+// RegistryOption configures optional behavior of a Registry.
+type RegistryOption func(r *Registry)
+
 // NewRegistry creates a new Registry using the provided logger and Telegram client.
-// It initializes empty matcher storage.
+// It initializes empty matcher storage and applies the given options.
 func NewRegistry(
 	logger logger.Interface,
 	telegram telegramclient.ClientInterface,
+	opts ...RegistryOption,
 ) *Registry {
-	return &Registry{
-		log:      logger,
-		telegram: telegram,
-		matchers: []Interface{},
+	r := &Registry{
+		log:            logger,
+		telegram:       telegram,
+		matchers:       []registration{},
+		defaultTimeout: 0,
+		timeouts:       map[string]time.Duration{},
+		panicThreshold: 0,
+		pool:           nil,
+		abandonGrace:   defaultAbandonGracePeriod,
+		middlewares:    nil,
+		configStore:    nil,
+		retryPolicy:    RetryPolicy{MaxAttempts: 1, InitialBackoff: 0, MaxBackoff: 0, Multiplier: 1},
+		deadLetters:    nil,
+		limiter:        nil,
+		replyOrder:     ReplyOrderStreaming,
+		cooldowns:      newCooldownTracker(),
+		roles:          nil,
+		rolesTimeout:   defaultRoleResolverTimeout,
+		deniedReply:    defaultPermissionDeniedReply,
+		dialogs:        nil,
+		storage:        nil,
+		inlineCache:    defaultInlineCacheTime,
+		replies:        nil,
+		clock:          systemClock{},
+		mu:             sync.Mutex{},
+		panics:         map[string]int{},
+		quarantined:    map[string]bool{},
 	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
 }
 
-// Register adds a matcher to the registry.
-func (r *Registry) Register(matcher Interface) {
+// registration is a matcher registered with the Registry together with its registration options.
+type registration struct {
+	matcher     Interface
+	priority    int
+	sequence    int
+	exclusive   bool
+	middlewares []Middleware
+	handler     ProcessFunc
+}
+
+// RegisterOption configures how a single matcher is registered.
+type RegisterOption func(reg *registration)
+
+// Register adds a matcher to the registry, applying the given registration options, and passes it the
+// storage configured with WithStorage if it implements StorageAwareInterface.
+// Matchers are kept ordered by descending priority; matchers of equal priority keep their registration order.
+func (r *Registry) Register(matcher Interface, opts ...RegisterOption) {
 	r.log.Debug("Registering matcher", matcher.Identifier())
 
-	r.matchers = append(r.matchers, matcher)
+	reg := registration{
+		matcher:     matcher,
+		priority:    0,
+		sequence:    len(r.matchers),
+		exclusive:   false,
+		middlewares: nil,
+		handler:     nil,
+	}
+
+	for _, opt := range opts {
+		opt(&reg)
+	}
+
+	reg.handler = r.chain(reg)
+
+	if r.storage != nil {
+		useStorage(matcher, r.storage)
+	}
+
+	r.insert(reg)
+}
+
+// Matchers returns all registered matchers, ordered by priority and registration order.
+func (r *Registry) Matchers() []Interface {
+	matchers := make([]Interface, 0, len(r.matchers))
+	for _, reg := range r.matchers {
+		matchers = append(matchers, reg.matcher)
+	}
+
+	return matchers
+}
+
+// MatchersFor returns the registered matchers that are enabled in the given chat and not quarantined,
+// ordered by priority and registration order.
+func (r *Registry) MatchersFor(chatID int64) []Interface {
+	matchers := make([]Interface, 0, len(r.matchers))
+
+	for _, reg := range r.matchers {
+		if !r.IsQuarantined(reg.matcher.Identifier()) && r.IsEnabledFor(reg.matcher, chatID) {
+			matchers = append(matchers, reg.matcher)
+		}
+	}
+
+	return matchers
+}
+
+// registrationOf returns the registration of the matcher with the given identifier.
+func (r *Registry) registrationOf(identifier string) (registration, bool) {
+	for _, reg := range r.matchers {
+		if reg.matcher.Identifier() == identifier {
+			return reg, true
+		}
+	}
+
+	return registration{}, false
 }
 
 // Process routes an incoming message to all registered matchers concurrently.
-// It checks whether each matcher is enabled, evaluates DoesMatch, executes the matcher,
-// reports errors to the user as a Markdown reply, sends all returned messages,
-// and waits for all matchers to finish.
+// It is a shortcut for ProcessContext with a background context.
 func (r *Registry) Process(messageIn telegramclient.WebhookMessageStruct) {
-	r.log.Debugf("Processing message from %s: %s", messageIn.From.Username, messageIn.Text)
+	r.ProcessContext(context.Background(), messageIn)
+}
+
+// ProcessContext routes a new message to all registered matchers handling new messages.
+// It is a shortcut for ProcessUpdateContext with UpdateMessage.
+func (r *Registry) ProcessContext(ctx context.Context, messageIn telegramclient.WebhookMessageStruct) {
+	r.ProcessUpdateContext(ctx, UpdateMessage, messageIn)
+}
+
+// ProcessUpdateContext routes a message received with the given kind of update to all registered matchers
+// handling that kind, see UpdateKindInterface. New messages answering an active dialog of the sender are
+// routed to the dialog instead, see WithDialogs.
+// It first checks synchronously whether each matcher is enabled and evaluates DoesMatch in priority order,
+// so that only matching matchers are dispatched. Matchers the sender is not permitted to use or whose
+// cooldowns are exceeded are skipped, see Permissions and Cooldowns. Once an exclusive matcher matched, matchers with a lower
+// priority are skipped. Those are executed concurrently with a context derived from ctx and
+// bounded by the matcher's timeout, either in their own goroutine or on the worker pool configured with
+// WithWorkerPool. Errors are reported to the user as a Markdown reply, all returned messages are sent,
+// either as soon as each matcher finished or in a deterministic order, see WithReplyOrder, or edited in
+// place of the matcher's previous replies, see WithReplyEditing, and
+// ProcessUpdateContext waits for all dispatched matchers to finish or time out.
+func (r *Registry) ProcessUpdateContext(ctx context.Context, kind UpdateKind, messageIn telegramclient.WebhookMessageStruct) {
+	r.log.Debugf("Processing %s from %s: %s", kind, messageIn.From.Username, messageIn.Text)
+
+	if kind == UpdateMessage && r.continueDialog(ctx, messageIn) {
+		return
+	}
 
-	var waitGroup sync.WaitGroup
-	waitGroup.Add(len(r.matchers))
+	var (
+		waitGroup sync.WaitGroup
+		batches   []*replyBatch
+		roles     senderRoles
+	)
+
+	claimed := false
+	claimedPriority := 0
+
+	for _, reg := range r.matchers {
+		m := reg.matcher
+
+		if claimed && reg.priority < claimedPriority {
+			r.log.Debugf("Matcher %s will not be executed: message claimed by an exclusive matcher", m.Identifier())
+
+			continue
+		}
+
+		matched, matchErr := r.matchMatcher(m, kind, messageIn)
+		if !matched {
+			continue
+		}
 
-	for _, m := range r.matchers {
-		go func(m Interface) {
+		execute, replies, matchErr := r.admit(ctx, m, messageIn, &roles, matchErr)
+
+		if reg.exclusive && !claimed {
+			claimed = true
+			claimedPriority = reg.priority
+		}
+
+		if !execute && len(replies) == 0 {
+			continue
+		}
+
+		waitGroup.Add(1)
+
+		batch := &replyBatch{reg: reg, messagesOut: nil}
+		if r.replyOrder != ReplyOrderStreaming {
+			batches = append(batches, batch)
+		}
+
+		task := func(ctx context.Context) {
 			defer waitGroup.Done()
+			defer r.recoverMatcher(m)
+
+			var messagesOut []telegramclient.MessageStruct
+			if execute {
+				messagesOut = r.executeMatcher(ctx, reg, messageIn, matchErr)
+			} else {
+				messagesOut = replies
+			}
+
+			if r.replyOrder != ReplyOrderStreaming {
+				batch.messagesOut = messagesOut
 
-			chatID := messageIn.Chat.ID
-			if !r.shouldRunMatcher(m, chatID) {
 				return
 			}
 
-			messagesOut := r.executeMatcher(m, messageIn)
-			r.sendMessages(chatID, messagesOut)
-		}(m)
+			r.sendReplies(ctx, kind, messageIn, m.Identifier(), messagesOut)
+		}
+
+		if err := r.dispatch(ctx, m.Identifier(), task); err != nil {
+			waitGroup.Done()
+			r.handleError(m, messageIn, fmt.Errorf("%w: %w", errNotDispatched, err))
+		}
 	}
 
 	waitGroup.Wait()
+
+	r.sendBatches(ctx, kind, messageIn, batches)
+}
+
+// matchMatcher reports whether a matcher has to be executed for a message: it must handle the kind of update,
+// be enabled for the chat and DoesMatch must return true. A panic in DoesMatch is returned as error and counts as a match, so that
+// executeMatcher reports it. Panics in other methods are recovered and count as no match.
+func (r *Registry) matchMatcher(
+	m Interface,
+	kind UpdateKind,
+	messageIn telegramclient.WebhookMessageStruct,
+) (matched bool, err error) {
+	defer r.recoverMatcher(m)
+
+	if !handlesUpdateKind(m, kind) {
+		return false, nil
+	}
+
+	if !r.shouldRunMatcher(m, messageIn.Chat.ID) {
+		return false, nil
+	}
+
+	matches, err := doesMatch(m, messageIn)
+	if !matches && err == nil {
+		return false, nil
+	}
+
+	r.log.Debugf("Matcher %s will be executed for chat %d", m.Identifier(), messageIn.Chat.ID)
+
+	return true, err
+}
+
+// admit decides whether a matching matcher is executed for the message: the sender must be permitted to
+// use it and its cooldowns must not be exceeded. Otherwise, it returns the replies to send instead, if any.
+// An error of DoesMatch is passed through, and an error resolving the sender's roles is returned the same
+// way, so that executeMatcher reports it.
+func (r *Registry) admit(
+	ctx context.Context,
+	m Interface,
+	messageIn telegramclient.WebhookMessageStruct,
+	roles *senderRoles,
+	matchErr error,
+) (bool, []telegramclient.MessageStruct, error) {
+	if matchErr != nil {
+		return true, nil, matchErr
+	}
+
+	permitted, err := r.checkPermissions(ctx, m, messageIn, roles)
+	if err != nil {
+		return true, nil, err
+	}
+
+	if !permitted {
+		if r.deniedReply == "" {
+			return false, nil, nil
+		}
+
+		return false, []telegramclient.MessageStruct{telegramclient.Reply(r.deniedReply, messageIn.ID)}, nil
+	}
+
+	allowed, notify := r.checkCooldowns(m, messageIn)
+	if !allowed && notify {
+		return false, cooldownReply(m, messageIn), nil
+	}
+
+	return allowed, nil, nil
+}
+
+// checkCooldowns enforces the cooldowns of a matching matcher, see cooldownTracker.check. A panic in
+// CooldownsFor is recovered and does not keep the matcher from being executed.
+func (r *Registry) checkCooldowns(
+	m Interface,
+	messageIn telegramclient.WebhookMessageStruct,
+) (allowed bool, notify bool) {
+	allowed = true
+
+	defer r.recoverMatcher(m)
+
+	allowed, notify = r.cooldowns.check(m, messageIn, r.clock.Now())
+	if !allowed {
+		r.log.Debugf("Matcher %s will not be executed: cooldown exceeded in chat %d", m.Identifier(), messageIn.Chat.ID)
+	}
+
+	return allowed, notify
 }
 
 // shouldRunMatcher encapsulates the decision logic and logging to determine if a matcher
 // should be executed for a particular chat.
 func (r *Registry) shouldRunMatcher(m Interface, chatID int64) bool {
-	if !m.IsEnabled() {
-		r.log.Debugf("Matcher %s will not be executed: disabled", m.Identifier())
+	if r.IsQuarantined(m.Identifier()) {
+		r.log.Debugf("Matcher %s will not be executed: quarantined", m.Identifier())
 
 		return false
 	}
 
-	r.log.Debugf("Matcher %s will be executed for chat %d", m.Identifier(), chatID)
+	if !r.IsEnabledFor(m, chatID) {
+		r.log.Debugf("Matcher %s will not be executed: disabled for chat %d", m.Identifier(), chatID)
+
+		return false
+	}
 
 	return true
 }
 
-// executeMatcher runs DoesMatch and Process and normalizes/augments the output
-// by appending a Markdown error reply if Process returned an error.
-func (r *Registry) executeMatcher(m Interface, messageIn telegramclient.WebhookMessageStruct) []telegramclient.MessageStruct {
-	if !m.DoesMatch(messageIn) {
-		return nil
+// IsEnabledFor reports whether the matcher is enabled in the given chat. The "enabled" key of the chat's
+// config file in the ConfigStore registered with WithConfigStore takes precedence, otherwise the matcher's
+// own config is used, see isEnabledFor.
+func (r *Registry) IsEnabledFor(m Interface, chatID int64) bool {
+	if r.configStore != nil {
+		if enabled, ok := r.configStore.EnabledFor(m.Identifier(), chatID); ok {
+			return enabled
+		}
+	}
+
+	return isEnabledFor(m, chatID)
+}
+
+// isEnabledFor resolves the enabled state of a matcher for a chat. It uses IsEnabledFor if the
+// matcher implements ChatAwareInterface and falls back to the chat-agnostic IsEnabled otherwise.
+func isEnabledFor(m Interface, chatID int64) bool {
+	if cm, ok := as[ChatAwareInterface](m); ok {
+		return cm.IsEnabledFor(chatID)
+	}
+
+	return m.IsEnabled()
+}
+
+// executeMatcher runs Process for a matching matcher and normalizes/augments the output
+// by appending a Markdown error reply if either DoesMatch (reported as matchErr) or Process failed.
+// Panics and expired deadlines are also passed to the matcher's HandleError.
+func (r *Registry) executeMatcher(
+	ctx context.Context,
+	reg registration,
+	messageIn telegramclient.WebhookMessageStruct,
+	matchErr error,
+) []telegramclient.MessageStruct {
+	m := reg.matcher
+
+	var messagesOut []telegramclient.MessageStruct
+
+	err := matchErr
+	if err == nil {
+		messagesOut, err = r.process(ctx, reg, messageIn)
+	}
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) && !errors.Is(err, errDeadline) {
+		r.recordSuccess(m.Identifier())
 	}
 
-	messagesOut, err := m.Process(messageIn)
 	if messagesOut == nil {
 		messagesOut = []telegramclient.MessageStruct{}
 	}
 
 	if err != nil {
-		r.log.Errorf("Error in matcher %s: %s", m.Identifier(), err)
+		r.handleError(m, messageIn, err)
 		messagesOut = append(
 			messagesOut,
 			telegramclient.MarkdownReply(
@@ -107,11 +443,49 @@ func (r *Registry) executeMatcher(m Interface, messageIn telegramclient.WebhookM
 	return messagesOut
 }
 
-// sendMessages delivers all messages to the given chat ID and logs errors individually.
-func (r *Registry) sendMessages(chatID int64, messagesOut []telegramclient.MessageStruct) {
-	for _, messageOut := range messagesOut {
-		if err := r.telegram.SendMessage(chatID, messageOut); err != nil {
-			r.log.Error("Error while sending message:", err)
-		}
+// doesMatch calls the matcher's DoesMatch and returns a *PanicError if it panics.
+func doesMatch(m Interface, messageIn telegramclient.WebhookMessageStruct) (matches bool, err error) {
+	defer recoverPanic(&err)
+
+	return m.DoesMatch(messageIn), nil
+}
+
+// process calls the matcher's ProcessContext, wrapped in its middlewares, see callMatcher.
+func (r *Registry) process(
+	ctx context.Context,
+	reg registration,
+	messageIn telegramclient.WebhookMessageStruct,
+) ([]telegramclient.MessageStruct, error) {
+	return callMatcher(ctx, r, reg.matcher.Identifier(), func(ctx context.Context) ([]telegramclient.MessageStruct, error) {
+		return reg.handler(ctx, messageIn)
+	})
+}
+
+// handleError logs an error of a matcher. Panics, expired deadlines and failed dispatches are failures the
+// matcher could not report itself, so they are also passed to its HandleError, and panics count towards
+// quarantine. A panic in HandleError is recovered.
+func (r *Registry) handleError(m Interface, messageIn telegramclient.WebhookMessageStruct, err error) {
+	defer r.recoverMatcher(m)
+
+	r.log.Errorf("Error in matcher %s: %s", m.Identifier(), err)
+
+	var panicErr *PanicError
+
+	switch {
+	case errors.As(err, &panicErr):
+		r.log.Errorf("Stack trace of matcher %s:\n%s", m.Identifier(), panicErr.Stack)
+		r.recordPanic(m.Identifier())
+		m.HandleError(messageIn, m.Identifier(), err)
+	case errors.Is(err, errDeadline), errors.Is(err, errNotDispatched):
+		m.HandleError(messageIn, m.Identifier(), err)
+	}
+}
+
+// recoverMatcher is deferred wherever a matcher is called. It recovers from panics outside of
+// DoesMatch and Process, e.g. in IsEnabledFor or HandleError, so they cannot crash the bot either.
+func (r *Registry) recoverMatcher(m Interface) {
+	if v := recover(); v != nil {
+		r.log.Errorf("Recovered from panic in matcher %s: %v\n%s", m.Identifier(), v, debug.Stack())
+		r.recordPanic(m.Identifier())
 	}
 }
@@ -1,6 +1,7 @@
 package matcher_test
 
 import (
+	"regexp"
 	"sync"
 	"testing"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/br0-space/bot-matcher/examples/ping"
 	telegramclient "github.com/br0-space/bot-telegramclient"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // fakeTelegramClient is a minimal test double that records sent messages.
@@ -30,6 +32,58 @@ func (f *fakeTelegramClient) SendMessage(chatID int64, msg telegramclient.Messag
 	return nil
 }
 
+// echoMatcher is a test matcher that replies with the incoming text.
+type echoMatcher struct {
+	matcher.Matcher
+}
+
+// Process replies with the incoming text.
+func (m echoMatcher) Process(messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+	return []telegramclient.MessageStruct{
+		telegramclient.Reply(messageIn.Text, messageIn.ID),
+	}, nil
+}
+
+// makeEchoMatcher returns an echoMatcher with the given identifier that matches every message.
+func makeEchoMatcher(identifier string) echoMatcher {
+	return echoMatcher{Matcher: matcher.MakeMatcher(identifier, regexp.MustCompile(`.`), nil)}
+}
+
+// sentTexts returns the texts of all recorded messages.
+func (f *fakeTelegramClient) sentTexts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	texts := make([]string, 0, len(f.sentMsg))
+	for _, msg := range f.sentMsg {
+		texts = append(texts, msg.Text)
+	}
+
+	return texts
+}
+
+// errorRecorder records all errors passed to HandleError. Test matchers embed it to override HandleError.
+type errorRecorder struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+// HandleError records the error.
+func (e *errorRecorder) HandleError(_ telegramclient.WebhookMessageStruct, _ string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.errs = append(e.errs, err)
+}
+
+// handledErrors returns a copy of all errors passed to HandleError.
+func (e *errorRecorder) handledErrors() []error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]error{}, e.errs...)
+}
+
 // TestRegistry_Process_WithPingAndNull verifies that only the ping matcher responds and the null matcher never does.
 func TestRegistry_Process_WithPingAndNull(t *testing.T) {
 	t.Parallel()
@@ -64,3 +118,66 @@ func TestRegistry_Process_WithPingAndNull(t *testing.T) {
 		assert.Equal(t, expected.Text, client.sentMsg[0].Text)
 	}
 }
+
+// TestRegistry_Process_HonorsPerChatConfig verifies that a matcher disabled in a chat's config is
+// not executed for that chat while still running in other chats.
+func TestRegistry_Process_HonorsPerChatConfig(t *testing.T) {
+	t.Parallel()
+
+	falseVal := false
+	disabled := &matcher.Config{}
+	setConfigEnabled(disabled, &falseVal)
+
+	msg := telegramclient.TestWebhookMessage("hello")
+
+	m := makeEchoMatcher("echo")
+	m.Matcher = m.WithChatConfigs(map[int64]*matcher.Config{msg.Chat.ID: disabled})
+
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client)
+	reg.Register(m)
+
+	reg.Process(msg)
+	assert.Empty(t, client.sentTexts())
+
+	other := msg
+	other.Chat.ID = msg.Chat.ID + 1
+	reg.Process(other)
+	assert.Equal(t, []string{"hello"}, client.sentTexts())
+}
+
+// TestRegistry_MatchersFor verifies that MatchersFor returns the matchers enabled in a chat in priority order
+// and omits disabled and quarantined matchers.
+func TestRegistry_MatchersFor(t *testing.T) {
+	t.Parallel()
+
+	falseVal := false
+	disabled := &matcher.Config{}
+	setConfigEnabled(disabled, &falseVal)
+
+	msg := telegramclient.TestWebhookMessage("hello")
+
+	chatDisabled := makeEchoMatcher("chat-disabled")
+	chatDisabled.Matcher = chatDisabled.WithChatConfigs(map[int64]*matcher.Config{msg.Chat.ID: disabled})
+
+	reg := matcher.NewRegistry(logger.New(), &fakeTelegramClient{}, matcher.WithPanicThreshold(1))
+	reg.Register(makeEchoMatcher("low"))
+	reg.Register(makeEchoMatcher("high"), matcher.WithPriority(10))
+	reg.Register(chatDisabled)
+	reg.Register(makePanickingMatcher("panic", false))
+
+	reg.Process(msg)
+	require.True(t, reg.IsQuarantined("panic"))
+
+	identifiers := func(matchers []matcher.Interface) []string {
+		ids := make([]string, 0, len(matchers))
+		for _, m := range matchers {
+			ids = append(ids, m.Identifier())
+		}
+
+		return ids
+	}
+
+	assert.Equal(t, []string{"high", "low"}, identifiers(reg.MatchersFor(msg.Chat.ID)))
+	assert.Equal(t, []string{"high", "low", "chat-disabled"}, identifiers(reg.MatchersFor(msg.Chat.ID+1)))
+}
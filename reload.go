@@ -0,0 +1,328 @@
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logger "github.com/br0-space/bot-logger"
+	"github.com/fsnotify/fsnotify"
+)
+
+// defaultReloadDebounce is the time to wait for further file changes before reloading.
+const defaultReloadDebounce = 100 * time.Millisecond
+
+var (
+	// errAlreadyWatching is returned when Watch is called on a ReloadableConfig or ConfigStore that is already watched.
+	errAlreadyWatching = errors.New("config is already watched")
+	// errWatchUnsupported is returned when Watch is called on a ReloadableConfig or ConfigStore reading from an fs.FS.
+	errWatchUnsupported = errors.New("configs read with WithFS cannot be watched, use WithDir")
+)
+
+// reloadOptions holds the settings of a ReloadableConfig.
+type reloadOptions struct {
+	debounce time.Duration
+	load     []LoadOption
+}
+
+// ReloadOption configures optional behavior of a ReloadableConfig.
+type ReloadOption func(o *reloadOptions)
+
+// WithReloadDebounce sets how long Watch waits for further changes before reloading, so that editors
+// writing a file in several steps trigger a single reload. It defaults to 100ms.
+func WithReloadDebounce(debounce time.Duration) ReloadOption {
+	return func(o *reloadOptions) {
+		o.debounce = debounce
+	}
+}
+
+// WithLoadOptions passes the given options to LoadMatcherConfig on every load, e.g. WithStrict.
+// Configs failing validation are not swapped in, so the last valid configs are kept.
+func WithLoadOptions(opts ...LoadOption) ReloadOption {
+	return func(o *reloadOptions) {
+		o.load = append(o.load, opts...)
+	}
+}
+
+// ReloadableConfig is a handle to the per-chat configs of a matcher, as returned by LoadMatcherConfig,
+// that can be reloaded while the bot is running. The configs are swapped atomically, so Configs always
+// returns a complete set of either the old or the new configs. If reloading fails, the last good configs
+// are kept and the error is reported to the OnError handlers.
+type ReloadableConfig[T any] struct {
+	identifier string
+	log        logger.Interface
+	opts       reloadOptions
+	configs    atomic.Pointer[map[int64]T]
+	reloadMu   sync.Mutex
+
+	mu       sync.Mutex
+	onReload []func(cfgs map[int64]T)
+	onError  []func(err error)
+	watcher  *fsnotify.Watcher
+	timer    *time.Timer
+}
+
+// NewReloadableConfig loads the configs of the matcher with the given identifier, see LoadMatcherConfig,
+// and returns a handle to reload them. It returns an error if the initial load fails.
+func NewReloadableConfig[T any](identifier string, opts ...ReloadOption) (*ReloadableConfig[T], error) {
+	c := &ReloadableConfig[T]{
+		identifier: identifier,
+		log:        logger.New(),
+		opts:       reloadOptions{debounce: defaultReloadDebounce, load: nil},
+		configs:    atomic.Pointer[map[int64]T]{},
+		reloadMu:   sync.Mutex{},
+		mu:         sync.Mutex{},
+		onReload:   nil,
+		onError:    nil,
+		watcher:    nil,
+		timer:      nil,
+	}
+
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+
+	cfgs, err := LoadMatcherConfig[T](identifier, c.opts.load...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.configs.Store(&cfgs)
+
+	return c, nil
+}
+
+// Configs returns the current configs keyed by chat ID. The returned map must not be modified.
+func (c *ReloadableConfig[T]) Configs() map[int64]T {
+	return *c.configs.Load()
+}
+
+// OnReload registers a handler called with the new configs after every successful reload.
+// Handlers are called in registration order. A panicking handler is reported to the OnError handlers.
+func (c *ReloadableConfig[T]) OnReload(handler func(cfgs map[int64]T)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onReload = append(c.onReload, handler)
+}
+
+// OnError registers a handler called with the error of every failed reload.
+func (c *ReloadableConfig[T]) OnError(handler func(err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onError = append(c.onError, handler)
+}
+
+// Reload reads the configs again and swaps them in if they could be loaded.
+// On failure, the current configs are kept and the error is returned and passed to the OnError handlers.
+// Concurrent calls are serialized, so the configs read last are always the ones kept.
+func (c *ReloadableConfig[T]) Reload() error {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	cfgs, err := LoadMatcherConfig[T](c.identifier, c.opts.load...)
+	if err != nil {
+		err = fmt.Errorf("failed to reload config of matcher %s: %w", c.identifier, err)
+		c.reportError(err)
+
+		return err
+	}
+
+	c.configs.Store(&cfgs)
+	c.log.Debugf("%s: reloaded config for %d chats", c.identifier, len(cfgs))
+
+	c.mu.Lock()
+	handlers := append([]func(map[int64]T){}, c.onReload...)
+	c.mu.Unlock()
+
+	var errs []error
+
+	for _, handler := range handlers {
+		if err := callReloadHandler(handler, cfgs); err != nil {
+			err = fmt.Errorf("reload handler of matcher %s failed: %w", c.identifier, err)
+			c.reportError(err)
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// callReloadHandler calls the given reload handler and returns a *PanicError if it panics.
+func callReloadHandler[T any](handler func(map[int64]T), cfgs map[int64]T) (err error) {
+	defer recoverPanic(&err)
+
+	handler(cfgs)
+
+	return nil
+}
+
+// reportError logs a reload error and passes it to the OnError handlers.
+func (c *ReloadableConfig[T]) reportError(err error) {
+	c.log.Error(err)
+
+	c.mu.Lock()
+	handlers := append([]func(error){}, c.onError...)
+	c.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(err)
+	}
+}
+
+// Watch starts watching config/ and all config/{chatID}/ directories, including ones created later,
+// and reloads the configs whenever a config file of the matcher is written, created, renamed or removed.
+// The directories are resolved from the load options, see WithDir and WithRoot. Configs read from an
+// fs.FS given with WithFS cannot be watched. Call Close to stop watching.
+func (c *ReloadableConfig[T]) Watch() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.watcher != nil {
+		return errAlreadyWatching
+	}
+
+	watcher, err := watchConfigDirs(newLoadOptions(c.opts.load...))
+	if err != nil {
+		return err
+	}
+
+	c.watcher = watcher
+
+	go c.watch(watcher)
+
+	return nil
+}
+
+// watchConfigDirs returns a watcher for the config directory and all chat directories in it, resolved from
+// the load options. Configs read from an fs.FS given with WithFS cannot be watched.
+func watchConfigDirs(options loadOptions) (*fsnotify.Watcher, error) {
+	if options.dir == "" {
+		return nil, errWatchUnsupported
+	}
+
+	root := filepath.Join(options.dir, filepath.FromSlash(options.root))
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config watcher: %w", err)
+	}
+
+	dirs, _ := filepath.Glob(filepath.Join(root, "*"))
+	for _, dir := range append([]string{root}, dirs...) {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+
+			return nil, fmt.Errorf("failed to watch config directory %s: %w", dir, err)
+		}
+	}
+
+	return watcher, nil
+}
+
+// watchCreatedDir starts watching the directory created with the given event, e.g. a new chat directory,
+// and reports whether the event created a directory.
+func watchCreatedDir(watcher *fsnotify.Watcher, event fsnotify.Event) (bool, error) {
+	if !event.Has(fsnotify.Create) {
+		return false, nil
+	}
+
+	if info, err := os.Stat(event.Name); err != nil || !info.IsDir() {
+		return false, nil
+	}
+
+	if err := watcher.Add(event.Name); err != nil {
+		return true, fmt.Errorf("failed to watch config directory %s: %w", event.Name, err)
+	}
+
+	return true, nil
+}
+
+// Close stops watching the config files. Pending reloads are discarded.
+func (c *ReloadableConfig[T]) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+
+	if c.watcher == nil {
+		return nil
+	}
+
+	err := c.watcher.Close()
+	c.watcher = nil
+
+	return err
+}
+
+// watch handles the events of the given watcher until it is closed.
+func (c *ReloadableConfig[T]) watch(watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			c.handleEvent(watcher, event)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			c.reportError(fmt.Errorf("failed to watch config of matcher %s: %w", c.identifier, err))
+		}
+	}
+}
+
+// handleEvent starts watching newly created chat directories and schedules a reload for changes to
+// the matcher's config files.
+func (c *ReloadableConfig[T]) handleEvent(watcher *fsnotify.Watcher, event fsnotify.Event) {
+	if created, err := watchCreatedDir(watcher, event); created {
+		if err != nil {
+			c.reportError(err)
+		}
+
+		// files may have been created before the directory was watched
+		c.scheduleReload()
+
+		return
+	}
+
+	if strings.TrimSuffix(filepath.Base(event.Name), filepath.Ext(event.Name)) != c.identifier {
+		return
+	}
+
+	if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Rename) ||
+		event.Has(fsnotify.Remove) {
+		c.scheduleReload()
+	}
+}
+
+// scheduleReload reloads the configs once no further change happened for the debounce duration.
+func (c *ReloadableConfig[T]) scheduleReload() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.watcher == nil {
+		return
+	}
+
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+
+	c.timer = time.AfterFunc(c.opts.debounce, func() { _ = c.Reload() })
+}
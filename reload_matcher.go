@@ -0,0 +1,127 @@
+package matcher
+
+import (
+	"context"
+	"sync/atomic"
+
+	telegramclient "github.com/br0-space/bot-telegramclient"
+)
+
+// ReloadingMatcher is a matcher that is rebuilt whenever its ReloadableConfig is reloaded, so that state
+// derived from the config, like the pattern built from a configured command or the help entries, is
+// updated as well. It implements Interface by delegating to the matcher built last, and the Registry
+// uses the optional extensions of that matcher, see WrapperInterface. Its identifier must not change
+// between rebuilds.
+type ReloadingMatcher[M Interface] struct {
+	current *atomic.Pointer[M]
+	storage *atomic.Pointer[StorageInterface]
+}
+
+// MakeReloadingMatcher builds a matcher from the current configs using build, and rebuilds it after every
+// successful reload of cfg. If build panics, the error is reported to cfg's OnError handlers and the
+// previous matcher is kept.
+func MakeReloadingMatcher[T any, M Interface](cfg *ReloadableConfig[T], build func(cfgs map[int64]T) M) ReloadingMatcher[M] {
+	m := ReloadingMatcher[M]{current: &atomic.Pointer[M]{}, storage: &atomic.Pointer[StorageInterface]{}}
+
+	initial := build(cfg.Configs())
+	m.current.Store(&initial)
+
+	cfg.OnReload(func(cfgs map[int64]T) {
+		rebuilt := build(cfgs)
+		if storage := m.storage.Load(); storage != nil {
+			useStorage(rebuilt, *storage)
+		}
+
+		m.current.Store(&rebuilt)
+	})
+
+	return m
+}
+
+// Current returns the matcher built last.
+func (m ReloadingMatcher[M]) Current() M {
+	return *m.current.Load()
+}
+
+// Unwrap returns the matcher built last, so that the Registry uses its optional extensions, see
+// WrapperInterface.
+func (m ReloadingMatcher[M]) Unwrap() Interface {
+	return m.Current()
+}
+
+// IsEnabled reports whether the current matcher is enabled.
+func (m ReloadingMatcher[M]) IsEnabled() bool {
+	return m.Current().IsEnabled()
+}
+
+// IsEnabledFor reports whether the current matcher is enabled in the given chat, see isEnabledFor.
+func (m ReloadingMatcher[M]) IsEnabledFor(chatID int64) bool {
+	return isEnabledFor(m.Current(), chatID)
+}
+
+// ConfiguredChatIDs returns the chats the current matcher has a per-chat config for, if it supports them.
+func (m ReloadingMatcher[M]) ConfiguredChatIDs() []int64 {
+	if cm, ok := as[ChatConfiguredInterface](m.Current()); ok {
+		return cm.ConfiguredChatIDs()
+	}
+
+	return nil
+}
+
+// UseStorage passes the storage to the current matcher and every matcher rebuilt later, if they
+// implement StorageAwareInterface.
+func (m ReloadingMatcher[M]) UseStorage(storage StorageInterface) {
+	m.storage.Store(&storage)
+	useStorage(m.Current(), storage)
+}
+
+// useStorage passes the storage to m if it implements StorageAwareInterface.
+func useStorage(m Interface, storage StorageInterface) {
+	if sm, ok := as[StorageAwareInterface](m); ok {
+		sm.UseStorage(storage)
+	}
+}
+
+// Identifier returns the identifier of the current matcher.
+func (m ReloadingMatcher[M]) Identifier() string {
+	return m.Current().Identifier()
+}
+
+// Help returns the help entries of the current matcher.
+func (m ReloadingMatcher[M]) Help() []HelpStruct {
+	return m.Current().Help()
+}
+
+// DoesMatch reports whether the current matcher matches the message.
+func (m ReloadingMatcher[M]) DoesMatch(messageIn telegramclient.WebhookMessageStruct) bool {
+	return m.Current().DoesMatch(messageIn)
+}
+
+// CommandMatch returns the capturing groups of the current matcher's match against the message.
+func (m ReloadingMatcher[M]) CommandMatch(messageIn telegramclient.WebhookMessageStruct) []string {
+	return m.Current().CommandMatch(messageIn)
+}
+
+// InlineMatches returns all matches of the current matcher in the message.
+func (m ReloadingMatcher[M]) InlineMatches(messageIn telegramclient.WebhookMessageStruct) []string {
+	return m.Current().InlineMatches(messageIn)
+}
+
+// Process processes the message with the current matcher.
+func (m ReloadingMatcher[M]) Process(messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+	return m.Current().Process(messageIn)
+}
+
+// ProcessContext processes the message with the current matcher, adapted with AdaptContext if it does
+// not support cancellation itself.
+func (m ReloadingMatcher[M]) ProcessContext(
+	ctx context.Context,
+	messageIn telegramclient.WebhookMessageStruct,
+) ([]telegramclient.MessageStruct, error) {
+	return AdaptContext(m.Current()).ProcessContext(ctx, messageIn)
+}
+
+// HandleError passes the error to the current matcher's HandleError.
+func (m ReloadingMatcher[M]) HandleError(messageIn telegramclient.WebhookMessageStruct, identifier string, err error) {
+	m.Current().HandleError(messageIn, identifier, err)
+}
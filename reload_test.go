@@ -0,0 +1,192 @@
+package matcher_test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reloadCfg is the config type used by the reload tests.
+type reloadCfg struct {
+	matcher.Config
+
+	Command string `mapstructure:"command"`
+}
+
+// GetEmbeddedMatcherConfigPtr exposes the embedded matcher.Config.
+func (c reloadCfg) GetEmbeddedMatcherConfigPtr() *matcher.Config { return &c.Config }
+
+// writeReloadConfig writes the given YAML to config/{path} in dir.
+func writeReloadConfig(t *testing.T, dir string, path string, yaml string) {
+	t.Helper()
+
+	path = filepath.Join(dir, "config", path)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(yaml), 0o600))
+}
+
+// TestReloadableConfig_Reload verifies that a successful reload swaps the configs and notifies the
+// OnReload handlers, while a failed reload keeps the last good configs and notifies the OnError handlers.
+func TestReloadableConfig_Reload(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeReloadConfig(t, dir, "reload.yml", "command: one\n")
+
+	cfg, err := matcher.NewReloadableConfig[reloadCfg]("reload", matcher.WithLoadOptions(matcher.WithDir(dir)))
+	require.NoError(t, err)
+	assert.Equal(t, "one", cfg.Configs()[0].Command)
+
+	var (
+		reloaded []map[int64]reloadCfg
+		errs     []error
+	)
+
+	cfg.OnReload(func(cfgs map[int64]reloadCfg) { reloaded = append(reloaded, cfgs) })
+	cfg.OnError(func(err error) { errs = append(errs, err) })
+
+	writeReloadConfig(t, dir, "reload.yml", "command: two\n")
+	writeReloadConfig(t, dir, "42/reload.yml", "enabled: false\n")
+	require.NoError(t, cfg.Reload())
+	require.Len(t, reloaded, 1)
+	assert.Equal(t, "two", cfg.Configs()[0].Command)
+	assert.Equal(t, "two", cfg.Configs()[42].Command)
+	assert.Empty(t, errs)
+
+	writeReloadConfig(t, dir, "reload.yml", "command: [unclosed\n")
+	require.Error(t, cfg.Reload())
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "failed to reload config of matcher reload")
+	assert.Len(t, reloaded, 1)
+	assert.Equal(t, "two", cfg.Configs()[0].Command)
+}
+
+// TestReloadableConfig_Watch verifies that changes to the fallback file and to files in chat directories
+// created after Watch are picked up.
+func TestReloadableConfig_Watch(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeReloadConfig(t, dir, "reload.yml", "command: one\n")
+
+	cfg, err := matcher.NewReloadableConfig[reloadCfg]("reload",
+		matcher.WithLoadOptions(matcher.WithDir(dir)),
+		matcher.WithReloadDebounce(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Watch())
+
+	t.Cleanup(func() { _ = cfg.Close() })
+
+	require.ErrorContains(t, cfg.Watch(), "already watched")
+
+	writeReloadConfig(t, dir, "reload.yml", "command: two\n")
+	assert.Eventually(t, func() bool {
+		return cfg.Configs()[0].Command == "two"
+	}, 2*time.Second, 10*time.Millisecond)
+
+	writeReloadConfig(t, dir, "42/reload.yml", "command: chat\n")
+	assert.Eventually(t, func() bool {
+		return cfg.Configs()[42].Command == "chat"
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+// TestReloadingMatcher_RebuildsOnReload verifies that the matcher is rebuilt from the reloaded configs and
+// that a panicking build keeps the previous matcher.
+func TestReloadingMatcher_RebuildsOnReload(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeReloadConfig(t, dir, "reload.yml", "command: one\n")
+
+	cfg, err := matcher.NewReloadableConfig[reloadCfg]("reload", matcher.WithLoadOptions(matcher.WithDir(dir)))
+	require.NoError(t, err)
+
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+
+	cfg.OnError(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		errs = append(errs, err)
+	})
+
+	m := matcher.MakeReloadingMatcher(cfg, func(cfgs map[int64]reloadCfg) echoMatcher {
+		pattern := regexp.MustCompile("^/" + cfgs[0].Command + "$")
+
+		return echoMatcher{Matcher: matcher.MakeMatcherWithCustomConfigType("reload", pattern, nil, cfgs[0]).
+			WithTypedConfigs(cfgs).Matcher}
+	})
+
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client)
+	reg.Register(m)
+
+	reg.Process(telegramclient.TestWebhookMessage("/one"))
+	assert.Equal(t, []string{"/one"}, client.sentTexts())
+
+	writeReloadConfig(t, dir, "reload.yml", "command: two\n")
+	writeReloadConfig(t, dir, "789/reload.yml", "enabled: false\n")
+	require.NoError(t, cfg.Reload())
+
+	msg := telegramclient.TestWebhookMessage("/two")
+	assert.False(t, m.IsEnabledFor(msg.Chat.ID))
+	assert.Equal(t, []int64{789}, m.ConfiguredChatIDs())
+
+	msg.Chat.ID = 1
+	reg.Process(telegramclient.TestWebhookMessage("/one"))
+	reg.Process(msg)
+	assert.Equal(t, []string{"/one", "/two"}, client.sentTexts())
+
+	writeReloadConfig(t, dir, "reload.yml", "command: \"(\"\n")
+	require.Error(t, cfg.Reload())
+	assert.True(t, m.DoesMatch(msg))
+	require.Len(t, errs, 1)
+	assert.ErrorAs(t, errs[0], new(*matcher.PanicError))
+}
+
+// TestReloadableConfig_WatchRequiresDir verifies that configs read from an fs.FS cannot be watched.
+func TestReloadableConfig_WatchRequiresDir(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{"config/reload.yml": &fstest.MapFile{Data: []byte("command: one\n")}}
+
+	cfg, err := matcher.NewReloadableConfig[reloadCfg]("reload", matcher.WithLoadOptions(matcher.WithFS(fsys)))
+	require.NoError(t, err)
+	require.Error(t, cfg.Watch())
+}
+
+// TestReloadingMatcher_UnwrapsOptionalInterfaces verifies that the Registry uses the optional extensions of
+// the current matcher and that wrappers of matchers without them do not claim them.
+func TestReloadingMatcher_UnwrapsOptionalInterfaces(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := matcher.NewReloadableConfig[reloadCfg]("reload",
+		matcher.WithLoadOptions(matcher.WithFS(fstest.MapFS{"config/reload.yml": &fstest.MapFile{Data: []byte("command: one\n")}})))
+	require.NoError(t, err)
+
+	client := &answeringTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client)
+	reg.Register(matcher.MakeReloadingMatcher(cfg, func(map[int64]reloadCfg) echoMatcher {
+		return makeEchoMatcher("echo")
+	}))
+
+	menu := makeMenuMatcher("menu", "")
+	reg.Register(matcher.MakeReloadingMatcher(cfg, func(map[int64]reloadCfg) menuMatcher { return menu }))
+
+	reg.ProcessCallbackQuery(callbackQuery("menu:open"))
+	assert.Equal(t, []string{"menu"}, client.answeredTexts())
+}
@@ -0,0 +1,246 @@
+package matcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+var (
+	// errNoStorage is returned by a Storage of a matcher that has not been registered with a storage.
+	errNoStorage = errors.New("no storage configured, see WithStorage")
+	// errEmptyKey is returned for empty storage keys.
+	errEmptyKey = errors.New("empty storage key")
+)
+
+// StorageInterface is a persistent key-value store for the state of matchers, like karma counters or
+// quote collections. Keys are namespaced per matcher identifier and chat; chat ID 0 can be used for state
+// shared across chats. Implementations must be safe for concurrent use. See MemoryStorage and FileStorage.
+type StorageInterface interface {
+	// Get returns the value of the key and whether it exists.
+	Get(identifier string, chatID int64, key string) ([]byte, bool, error)
+	// Set sets the value of the key.
+	Set(identifier string, chatID int64, key string, value []byte) error
+	// Update atomically replaces the value of the key with the result of fn, which receives the current
+	// value and whether it exists. If fn returns an error, the value is left unchanged.
+	Update(identifier string, chatID int64, key string, fn func(value []byte, ok bool) ([]byte, error)) error
+	// Delete removes the key. Deleting a key that does not exist is not an error.
+	Delete(identifier string, chatID int64, key string) error
+	// Keys returns the sorted keys in the namespace.
+	Keys(identifier string, chatID int64) ([]string, error)
+}
+
+// StorageAwareInterface is an optional extension of Interface for matchers with persistent state.
+// Register passes the storage configured with WithStorage to UseStorage. The base Matcher implements it,
+// see Matcher.Storage.
+type StorageAwareInterface interface {
+	UseStorage(storage StorageInterface)
+}
+
+// WithStorage sets the storage passed to every matcher implementing StorageAwareInterface when it is registered.
+func WithStorage(storage StorageInterface) RegistryOption {
+	return func(r *Registry) {
+		r.storage = storage
+	}
+}
+
+// storageSlot holds the storage of a Matcher. It is shared by all copies of a Matcher, so that the storage
+// set by Register is also available to the copy Process is called on.
+type storageSlot struct {
+	mu      sync.RWMutex
+	storage StorageInterface
+}
+
+// UseStorage sets the storage of the matcher. It is called by Register, see WithStorage.
+func (m Matcher) UseStorage(storage StorageInterface) {
+	if m.storage == nil {
+		return
+	}
+
+	m.storage.mu.Lock()
+	defer m.storage.mu.Unlock()
+
+	m.storage.storage = storage
+}
+
+// Storage returns the matcher's storage, namespaced by its identifier. Its methods fail until the matcher
+// has been registered with a Registry configured with WithStorage.
+func (m Matcher) Storage() Storage {
+	var storage StorageInterface
+
+	if m.storage != nil {
+		m.storage.mu.RLock()
+		storage = m.storage.storage
+		m.storage.mu.RUnlock()
+	}
+
+	return Storage{storage: storage, identifier: m.identifier}
+}
+
+// Storage is the part of a StorageInterface belonging to a single matcher.
+type Storage struct {
+	storage    StorageInterface
+	identifier string
+}
+
+// Get returns the value of the key in the given chat and whether it exists.
+func (s Storage) Get(chatID int64, key string) ([]byte, bool, error) {
+	if s.storage == nil {
+		return nil, false, errNoStorage
+	}
+
+	return s.storage.Get(s.identifier, chatID, key)
+}
+
+// Set sets the value of the key in the given chat.
+func (s Storage) Set(chatID int64, key string, value []byte) error {
+	if s.storage == nil {
+		return errNoStorage
+	}
+
+	return s.storage.Set(s.identifier, chatID, key, value)
+}
+
+// Update atomically replaces the value of the key in the given chat with the result of fn.
+func (s Storage) Update(chatID int64, key string, fn func(value []byte, ok bool) ([]byte, error)) error {
+	if s.storage == nil {
+		return errNoStorage
+	}
+
+	return s.storage.Update(s.identifier, chatID, key, fn)
+}
+
+// Delete removes the key in the given chat.
+func (s Storage) Delete(chatID int64, key string) error {
+	if s.storage == nil {
+		return errNoStorage
+	}
+
+	return s.storage.Delete(s.identifier, chatID, key)
+}
+
+// Keys returns the sorted keys in the given chat.
+func (s Storage) Keys(chatID int64) ([]string, error) {
+	if s.storage == nil {
+		return nil, errNoStorage
+	}
+
+	return s.storage.Keys(s.identifier, chatID)
+}
+
+// GetJSON decodes the JSON value of the key in the given chat into target and reports whether it exists.
+func (s Storage) GetJSON(chatID int64, key string, target any) (bool, error) {
+	value, ok, err := s.Get(chatID, key)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if err := json.Unmarshal(value, target); err != nil {
+		return true, fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+
+	return true, nil
+}
+
+// SetJSON sets the value of the key in the given chat to the JSON encoding of value.
+func (s Storage) SetJSON(chatID int64, key string, value any) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+
+	return s.Set(chatID, key, encoded)
+}
+
+// namespace identifies the keys of a matcher in a chat.
+type namespace struct {
+	identifier string
+	chatID     int64
+}
+
+// MemoryStorage is a StorageInterface keeping all values in memory, e.g. for tests or state that does not
+// need to survive a restart.
+type MemoryStorage struct {
+	mu     sync.Mutex
+	values map[namespace]map[string][]byte
+}
+
+// NewMemoryStorage returns an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{mu: sync.Mutex{}, values: map[namespace]map[string][]byte{}}
+}
+
+// Get returns a copy of the value of the key and whether it exists.
+func (s *MemoryStorage) Get(identifier string, chatID int64, key string) ([]byte, bool, error) {
+	if key == "" {
+		return nil, false, errEmptyKey
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.values[namespace{identifier: identifier, chatID: chatID}][key]
+
+	return slices.Clone(value), ok, nil
+}
+
+// Set stores a copy of the value.
+func (s *MemoryStorage) Set(identifier string, chatID int64, key string, value []byte) error {
+	return s.Update(identifier, chatID, key, func([]byte, bool) ([]byte, error) { return value, nil })
+}
+
+// Update atomically replaces the value of the key with the result of fn.
+func (s *MemoryStorage) Update(
+	identifier string,
+	chatID int64,
+	key string,
+	fn func(value []byte, ok bool) ([]byte, error),
+) error {
+	if key == "" {
+		return errEmptyKey
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ns := namespace{identifier: identifier, chatID: chatID}
+	current, ok := s.values[ns][key]
+
+	value, err := fn(slices.Clone(current), ok)
+	if err != nil {
+		return err
+	}
+
+	if s.values[ns] == nil {
+		s.values[ns] = map[string][]byte{}
+	}
+
+	s.values[ns][key] = slices.Clone(value)
+
+	return nil
+}
+
+// Delete removes the key.
+func (s *MemoryStorage) Delete(identifier string, chatID int64, key string) error {
+	if key == "" {
+		return errEmptyKey
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.values[namespace{identifier: identifier, chatID: chatID}], key)
+
+	return nil
+}
+
+// Keys returns the sorted keys in the namespace.
+func (s *MemoryStorage) Keys(identifier string, chatID int64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Sorted(maps.Keys(s.values[namespace{identifier: identifier, chatID: chatID}])), nil
+}
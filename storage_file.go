@@ -0,0 +1,157 @@
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FileStorage is a StorageInterface keeping every value in a file {dir}/{identifier}/{chatID}/{key}, with
+// the identifier and key escaped for use in file names. Values are written to a temporary file first and
+// renamed, so a crash never leaves a partially written value behind.
+type FileStorage struct {
+	dir string
+
+	mu sync.Mutex
+}
+
+// NewFileStorage returns a FileStorage in the given directory, which is created when the first value is written.
+func NewFileStorage(dir string) *FileStorage {
+	return &FileStorage{dir: dir, mu: sync.Mutex{}}
+}
+
+// Get returns the value of the key and whether it exists.
+func (s *FileStorage) Get(identifier string, chatID int64, key string) ([]byte, bool, error) {
+	if key == "" {
+		return nil, false, errEmptyKey
+	}
+
+	value, err := os.ReadFile(s.file(identifier, chatID, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+
+	return value, true, nil
+}
+
+// Set writes the value atomically.
+func (s *FileStorage) Set(identifier string, chatID int64, key string, value []byte) error {
+	return s.Update(identifier, chatID, key, func([]byte, bool) ([]byte, error) { return value, nil })
+}
+
+// Update atomically replaces the value of the key with the result of fn. Updates of all keys are
+// serialized, so fn should return quickly.
+func (s *FileStorage) Update(
+	identifier string,
+	chatID int64,
+	key string,
+	fn func(value []byte, ok bool) ([]byte, error),
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok, err := s.Get(identifier, chatID, key)
+	if err != nil {
+		return err
+	}
+
+	value, err := fn(current, ok)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(s.file(identifier, chatID, key), value); err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// Delete removes the file of the key.
+func (s *FileStorage) Delete(identifier string, chatID int64, key string) error {
+	if key == "" {
+		return errEmptyKey
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.file(identifier, chatID, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err == nil {
+		err = syncDir(s.namespaceDir(identifier, chatID))
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// Keys returns the sorted keys in the namespace. Temporary files of interrupted writes are skipped.
+func (s *FileStorage) Keys(identifier string, chatID int64) ([]string, error) {
+	entries, err := os.ReadDir(s.namespaceDir(identifier, chatID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %w", err)
+	}
+
+	keys := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		key, err := url.PathUnescape(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	return keys, nil
+}
+
+// namespaceDir returns the directory holding the keys of the namespace.
+func (s *FileStorage) namespaceDir(identifier string, chatID int64) string {
+	return filepath.Join(s.dir, escapeFileName(identifier), strconv.FormatInt(chatID, 10))
+}
+
+// file returns the file holding the value of the key.
+func (s *FileStorage) file(identifier string, chatID int64, key string) string {
+	return filepath.Join(s.namespaceDir(identifier, chatID), escapeFileName(key))
+}
+
+// escapeFileName escapes s for use as a file name: path separators and other special characters are
+// percent-encoded, and so is a leading dot, so that names cannot refer to a parent directory or collide
+// with temporary files.
+func escapeFileName(s string) string {
+	escaped := url.PathEscape(s)
+	if strings.HasPrefix(escaped, ".") {
+		escaped = "%2E" + escaped[1:]
+	}
+
+	return escaped
+}
@@ -0,0 +1,207 @@
+package matcher_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// counterMatcher counts the messages per chat in its storage and replies with the count.
+type counterMatcher struct {
+	matcher.Matcher
+}
+
+// Process increments and replies with the chat's counter.
+func (m counterMatcher) Process(messageIn telegramclient.WebhookMessageStruct) ([]telegramclient.MessageStruct, error) {
+	var count int
+	if _, err := m.Storage().GetJSON(messageIn.Chat.ID, "count", &count); err != nil {
+		return nil, err
+	}
+
+	count++
+
+	if err := m.Storage().SetJSON(messageIn.Chat.ID, "count", count); err != nil {
+		return nil, err
+	}
+
+	return []telegramclient.MessageStruct{telegramclient.Reply(strconv.Itoa(count), messageIn.ID)}, nil
+}
+
+// storageBackends returns a fresh instance of every storage implementation.
+func storageBackends(t *testing.T) map[string]matcher.StorageInterface {
+	t.Helper()
+
+	return map[string]matcher.StorageInterface{
+		"memory": matcher.NewMemoryStorage(),
+		"file":   matcher.NewFileStorage(t.TempDir()),
+	}
+}
+
+// TestStorage_Backends verifies that all storage implementations get, set, update, delete and list keys
+// per matcher and chat.
+func TestStorage_Backends(t *testing.T) {
+	t.Parallel()
+
+	for name, storage := range storageBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, ok, err := storage.Get("quotes", 1, "missing")
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			require.NoError(t, storage.Set("quotes", 1, "b", []byte("two")))
+			require.NoError(t, storage.Set("quotes", 1, "a/../.x", []byte("one")))
+			require.NoError(t, storage.Set("quotes", 2, "c", []byte("other chat")))
+			require.NoError(t, storage.Set("karma", 1, "d", []byte("other matcher")))
+			require.Error(t, storage.Set("quotes", 1, "", []byte("empty")))
+
+			value, ok, err := storage.Get("quotes", 1, "a/../.x")
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, []byte("one"), value)
+
+			keys, err := storage.Keys("quotes", 1)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"a/../.x", "b"}, keys)
+
+			failed := errors.New("failed")
+			require.ErrorIs(t, storage.Update("quotes", 1, "b", func([]byte, bool) ([]byte, error) {
+				return nil, failed
+			}), failed)
+			require.NoError(t, storage.Update("quotes", 1, "b", func(value []byte, ok bool) ([]byte, error) {
+				assert.True(t, ok)
+
+				return append(value, '!'), nil
+			}))
+
+			value, _, err = storage.Get("quotes", 1, "b")
+			require.NoError(t, err)
+			assert.Equal(t, []byte("two!"), value)
+
+			require.NoError(t, storage.Delete("quotes", 1, "b"))
+			require.NoError(t, storage.Delete("quotes", 1, "b"))
+			require.Error(t, storage.Delete("quotes", 1, ""))
+
+			_, _, err = storage.Get("quotes", 1, "")
+			require.Error(t, err)
+
+			keys, err = storage.Keys("quotes", 1)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"a/../.x"}, keys)
+
+			keys, err = storage.Keys("unknown", 1)
+			require.NoError(t, err)
+			assert.Empty(t, keys)
+		})
+	}
+}
+
+// TestStorage_ConcurrentUpdates verifies that concurrent updates of the same key are not lost.
+func TestStorage_ConcurrentUpdates(t *testing.T) {
+	t.Parallel()
+
+	for name, storage := range storageBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var wg sync.WaitGroup
+
+			for range 20 {
+				wg.Go(func() {
+					assert.NoError(t, storage.Update("counter", 1, "n", func(value []byte, _ bool) ([]byte, error) {
+						return append(value, 'x'), nil
+					}))
+				})
+			}
+
+			wg.Wait()
+
+			value, _, err := storage.Get("counter", 1, "n")
+			require.NoError(t, err)
+			assert.Len(t, value, 20)
+		})
+	}
+}
+
+// TestFileStorage_Persists verifies that values survive a new FileStorage in the same directory and that
+// leftover temporary files are not listed as keys.
+func TestFileStorage_Persists(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, matcher.NewFileStorage(dir).Set("quotes", -100, "first", []byte("hello")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "quotes", "-100", ".first.123"), []byte("partial"), 0o600))
+
+	storage := matcher.NewFileStorage(dir)
+
+	value, ok, err := storage.Get("quotes", -100, "first")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("hello"), value)
+
+	keys, err := storage.Keys("quotes", -100)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first"}, keys)
+}
+
+// TestRegistry_Register_InjectsStorage verifies that registered matchers, including reloading ones, can
+// use the storage of the Registry, and that unregistered matchers fail.
+func TestRegistry_Register_InjectsStorage(t *testing.T) {
+	t.Parallel()
+
+	m := counterMatcher{Matcher: matcher.MakeMatcher("counter", regexp.MustCompile(`.`), nil)}
+	require.Error(t, m.Storage().Set(1, "count", []byte("1")))
+
+	storage := matcher.NewMemoryStorage()
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithStorage(storage))
+	reg.Register(m)
+
+	reg.Process(messageTo(1))
+	reg.Process(messageTo(1))
+	reg.Process(messageTo(2))
+	assert.Equal(t, []string{"1", "2", "1"}, client.sentTexts())
+
+	value, ok, err := storage.Get("counter", 1, "count")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("2"), value)
+}
+
+// TestReloadingMatcher_UseStorage verifies that rebuilt matchers keep the storage of the Registry.
+func TestReloadingMatcher_UseStorage(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeReloadConfig(t, dir, "reload.yml", "command: one\n")
+
+	cfg, err := matcher.NewReloadableConfig[reloadCfg]("reload", matcher.WithLoadOptions(matcher.WithDir(dir)))
+	require.NoError(t, err)
+
+	m := matcher.MakeReloadingMatcher(cfg, func(cfgs map[int64]reloadCfg) counterMatcher {
+		return counterMatcher{Matcher: matcher.MakeMatcher("reload", regexp.MustCompile("^/"+cfgs[0].Command+"$"), nil)}
+	})
+
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithStorage(matcher.NewMemoryStorage()))
+	reg.Register(m)
+
+	reg.Process(telegramclient.TestWebhookMessage("/one"))
+
+	writeReloadConfig(t, dir, "reload.yml", "command: two\n")
+	require.NoError(t, cfg.Reload())
+
+	reg.Process(telegramclient.TestWebhookMessage("/two"))
+	assert.Equal(t, []string{"1", "2"}, client.sentTexts())
+}
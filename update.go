@@ -0,0 +1,84 @@
+package matcher
+
+import (
+	"context"
+	"slices"
+
+	telegramclient "github.com/br0-space/bot-telegramclient"
+)
+
+// UpdateKind is the kind of update a message was received with.
+// https://core.telegram.org/bots/api#update
+type UpdateKind int
+
+const (
+	// UpdateMessage is a new message. Matchers handle it unless they opt out, see UpdateKindInterface.
+	UpdateMessage UpdateKind = iota
+	// UpdateEditedMessage is a new version of a message that was edited.
+	UpdateEditedMessage
+	// UpdateChannelPost is a new post in a channel.
+	UpdateChannelPost
+	// UpdateEditedChannelPost is a new version of a channel post that was edited.
+	UpdateEditedChannelPost
+)
+
+// String returns the name of the field of the update the message was received in.
+func (k UpdateKind) String() string {
+	switch k {
+	case UpdateMessage:
+		return "message"
+	case UpdateEditedMessage:
+		return "edited_message"
+	case UpdateChannelPost:
+		return "channel_post"
+	case UpdateEditedChannelPost:
+		return "edited_channel_post"
+	default:
+		return "unknown"
+	}
+}
+
+// IsEdit reports whether the kind is a new version of an edited message or channel post.
+func (k UpdateKind) IsEdit() bool {
+	return k == UpdateEditedMessage || k == UpdateEditedChannelPost
+}
+
+// UpdateKindInterface is an optional extension of Interface for matchers handling other kinds of updates
+// than new messages. Matchers not implementing it only handle UpdateMessage. The base Matcher implements
+// it, see Matcher.WithUpdateKinds.
+type UpdateKindInterface interface {
+	HandlesUpdateKind(kind UpdateKind) bool
+}
+
+// WithUpdateKinds returns a copy of the Matcher that handles the given kinds of updates instead of only
+// new messages. Include UpdateMessage to keep handling new messages.
+func (m Matcher) WithUpdateKinds(kinds ...UpdateKind) Matcher {
+	m.kinds = slices.Clone(kinds)
+
+	return m
+}
+
+// HandlesUpdateKind reports whether the matcher handles the given kind of update, see WithUpdateKinds.
+func (m Matcher) HandlesUpdateKind(kind UpdateKind) bool {
+	if m.kinds == nil {
+		return kind == UpdateMessage
+	}
+
+	return slices.Contains(m.kinds, kind)
+}
+
+// handlesUpdateKind reports whether the matcher handles the given kind of update. It uses HandlesUpdateKind
+// if the matcher implements UpdateKindInterface and only accepts new messages otherwise.
+func handlesUpdateKind(m Interface, kind UpdateKind) bool {
+	if km, ok := as[UpdateKindInterface](m); ok {
+		return km.HandlesUpdateKind(kind)
+	}
+
+	return kind == UpdateMessage
+}
+
+// ProcessUpdate routes a message received with the given kind of update to the matchers handling that kind.
+// It is a shortcut for ProcessUpdateContext with a background context.
+func (r *Registry) ProcessUpdate(kind UpdateKind, messageIn telegramclient.WebhookMessageStruct) {
+	r.ProcessUpdateContext(context.Background(), kind, messageIn)
+}
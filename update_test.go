@@ -0,0 +1,134 @@
+package matcher_test
+
+import (
+	"errors"
+	"testing"
+
+	logger "github.com/br0-space/bot-logger"
+	matcher "github.com/br0-space/bot-matcher"
+	telegramclient "github.com/br0-space/bot-telegramclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// editingTelegramClient is a fakeTelegramClient that returns IDs of sent messages and records edits.
+type editingTelegramClient struct {
+	fakeTelegramClient
+
+	nextID  int64
+	edits   map[int64]string
+	editErr error
+}
+
+// SendMessageWithID records the message and returns its ID, counting up from 1000.
+func (f *editingTelegramClient) SendMessageWithID(chatID int64, msg telegramclient.MessageStruct) (int64, error) {
+	if err := f.SendMessage(chatID, msg); err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextID++
+
+	return 1000 + f.nextID, nil
+}
+
+// EditMessageText records the new text of the message with the given ID.
+func (f *editingTelegramClient) EditMessageText(_ int64, messageID int64, msg telegramclient.MessageStruct) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.edits == nil {
+		f.edits = map[int64]string{}
+	}
+
+	f.edits[messageID] = msg.Text
+
+	return f.editErr
+}
+
+// TestRegistry_ProcessUpdate_Kinds verifies that matchers only handle new messages unless they opt in to
+// other kinds of updates.
+func TestRegistry_ProcessUpdate_Kinds(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithReplyOrder(matcher.ReplyOrderRegistration))
+
+	reg.Register(makeEchoMatcher("messages"))
+
+	channel := makeEchoMatcher("channel")
+	channel.Matcher = channel.WithUpdateKinds(matcher.UpdateChannelPost, matcher.UpdateEditedChannelPost)
+	reg.Register(channel)
+
+	edits := makeEchoMatcher("edits")
+	edits.Matcher = edits.WithUpdateKinds(matcher.UpdateMessage, matcher.UpdateEditedMessage)
+	reg.Register(edits)
+
+	reg.ProcessUpdate(matcher.UpdateMessage, telegramclient.TestWebhookMessage("new"))
+	reg.ProcessUpdate(matcher.UpdateEditedMessage, telegramclient.TestWebhookMessage("edited"))
+	reg.ProcessUpdate(matcher.UpdateChannelPost, telegramclient.TestWebhookMessage("post"))
+	reg.ProcessUpdate(matcher.UpdateEditedChannelPost, telegramclient.TestWebhookMessage("edited post"))
+
+	assert.Equal(t, []string{"new", "new", "edited", "post", "edited post"}, client.sentTexts())
+	assert.Equal(t, "edited_channel_post", matcher.UpdateEditedChannelPost.String())
+}
+
+// TestRegistry_ProcessUpdate_EditsReplies verifies that the replies to an edited message replace the
+// previous replies of the same matcher.
+func TestRegistry_ProcessUpdate_EditsReplies(t *testing.T) {
+	t.Parallel()
+
+	client := &editingTelegramClient{}
+	reg := matcher.NewRegistry(logger.New(), client,
+		matcher.WithReplyEditing(), matcher.WithReplyOrder(matcher.ReplyOrderRegistration))
+
+	for _, identifier := range []string{"a", "b"} {
+		m := makeEchoMatcher(identifier)
+		m.Matcher = m.WithUpdateKinds(matcher.UpdateMessage, matcher.UpdateEditedMessage)
+		reg.Register(m)
+	}
+
+	msg := telegramclient.TestWebhookMessage("/ping")
+	reg.ProcessUpdate(matcher.UpdateMessage, msg)
+
+	msg.Text = "/ping edited"
+	reg.ProcessUpdate(matcher.UpdateEditedMessage, msg)
+
+	assert.Equal(t, []string{"/ping", "/ping"}, client.sentTexts())
+	assert.Equal(t, map[int64]string{1001: "/ping edited", 1002: "/ping edited"}, client.edits)
+
+	other := telegramclient.TestWebhookMessage("/other")
+	other.ID = msg.ID + 1
+	reg.ProcessUpdate(matcher.UpdateEditedMessage, other)
+	assert.Equal(t, []string{"/ping", "/ping", "/other", "/other"}, client.sentTexts())
+}
+
+// TestRegistry_ProcessUpdate_IgnoresNotModified verifies that edits that would not change a reply are
+// not reported as undeliverable.
+func TestRegistry_ProcessUpdate_IgnoresNotModified(t *testing.T) {
+	t.Parallel()
+
+	var letters []matcher.DeadLetter
+
+	client := &editingTelegramClient{
+		editErr: errors.New("SendMessage failed with 400: Bad Request: message is not modified"),
+	}
+	reg := matcher.NewRegistry(logger.New(), client, matcher.WithReplyEditing(),
+		matcher.WithDeadLetterSink(matcher.DeadLetterSinkFunc(func(letter matcher.DeadLetter) {
+			letters = append(letters, letter)
+		})))
+
+	m := makeEchoMatcher("echo")
+	m.Matcher = m.WithUpdateKinds(matcher.UpdateMessage, matcher.UpdateEditedMessage)
+	reg.Register(m)
+
+	msg := telegramclient.TestWebhookMessage("/ping")
+	reg.ProcessUpdate(matcher.UpdateMessage, msg)
+	reg.ProcessUpdate(matcher.UpdateEditedMessage, msg)
+
+	require.Empty(t, letters)
+	assert.Equal(t, []string{"/ping"}, client.sentTexts())
+	assert.Len(t, client.edits, 1)
+}